@@ -1,20 +1,32 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
+	"database/sql"
 	"expvar"
 	"flag"
 	"fmt"
+	"net/netip"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/gin-gonic/gin"
 
+	adminHandler "greenlight/internal/admin/handlers"
+	adminRepo "greenlight/internal/admin/repo"
+	adminRoutes "greenlight/internal/admin/routes"
+	adminService "greenlight/internal/admin/service"
+	apikeysHandler "greenlight/internal/apikeys/handlers"
+	apikeysRepo "greenlight/internal/apikeys/repo"
+	apikeysRoutes "greenlight/internal/apikeys/routes"
+	apikeysService "greenlight/internal/apikeys/service"
 	healthcheckHandler "greenlight/internal/healthcheck/handlers"
 	healthcheckRoutes "greenlight/internal/healthcheck/routes"
 	metricsRoutes "greenlight/internal/metrics/routes"
@@ -22,18 +34,33 @@ import (
 	moviesRepo "greenlight/internal/movies/repository"
 	moviesRoutes "greenlight/internal/movies/routes"
 	moviesService "greenlight/internal/movies/service"
+	organizationsHandler "greenlight/internal/organizations/handlers"
+	organizationsRepo "greenlight/internal/organizations/repo"
+	organizationsRoutes "greenlight/internal/organizations/routes"
+	organizationsService "greenlight/internal/organizations/service"
+	permissionsCache "greenlight/internal/permissions/cache"
 	permissionsRepo "greenlight/internal/permissions/repository"
 	permissionsService "greenlight/internal/permissions/service"
 	utHandler "greenlight/internal/users/handlers"
+	usersModels "greenlight/internal/users/models"
 	usersRepo "greenlight/internal/users/repo"
 	userRoutes "greenlight/internal/users/routes"
 	usersService "greenlight/internal/users/service"
 	"greenlight/internal/vcs"
+	"greenlight/pkg/authz"
+	"greenlight/pkg/breached"
+	"greenlight/pkg/emailpolicy"
 	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/idempotency"
 	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/jwt"
 	"greenlight/pkg/mailer"
 	"greenlight/pkg/middlewares"
+	"greenlight/pkg/oidc"
+	"greenlight/pkg/ratelimit"
+	"greenlight/pkg/secretbox"
 	"greenlight/pkg/taskutils"
+	"greenlight/pkg/tracing"
 )
 
 var version = vcs.Version()
@@ -41,7 +68,11 @@ var version = vcs.Version()
 type config struct {
 	port int
 	env  string
-	db   struct {
+	log  struct {
+		level    jsonlog.Level
+		sampling jsonlog.Sampling
+	}
+	db struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -50,7 +81,12 @@ type config struct {
 	limiter struct {
 		rps     float64
 		burst   int
+		ipRPS   float64
+		ipBurst int
 		enabled bool
+		store   string
+		key     string
+		routes  map[string]ratelimit.Limit
 	}
 	smtp struct {
 		host     string
@@ -59,33 +95,227 @@ type config struct {
 		password string
 		sender   string
 	}
-	cors struct {
-		trustedOrigins []string
+	cors    middlewares.CORSConfig
+	tracing tracing.Config
+	proxies struct {
+		trusted []netip.Prefix
+	}
+	metrics struct {
+		addr string
+	}
+	auth struct {
+		tokenFormat string
+		jwt         struct {
+			keys         []string
+			signingKid   string
+			issuer       string
+			ttl          time.Duration
+			syncInterval time.Duration
+		}
+	}
+	mfa struct {
+		encryptionKey       string
+		issuer              string
+		requiredPermissions []string
+	}
+	lockout struct {
+		freeAttempts   int
+		ipFreeAttempts int
+		baseDelay      time.Duration
+		maxDelay       time.Duration
+		maxFailures    int
+		duration       time.Duration
+		window         time.Duration
+	}
+	oidc struct {
+		providers []oidc.Config
+	}
+	rbac struct {
+		defaultRole string
+		cacheTTL    time.Duration
+		cacheSize   int
+	}
+	password struct {
+		requiredClasses []usersModels.CharClass
+		rejectPersonal  bool
+		breachedFile    string
+		hashing         usersModels.PasswordHashing
+	}
+	email struct {
+		allowedDomains  []string
+		deniedDomains   []string
+		blockDisposable bool
+		checkMX         bool
+	}
+	compression middlewares.CompressConfig
+	idempotency struct {
+		ttl time.Duration
 	}
 }
 
 func main() {
-	taskutils.Logger = &jsonlog.Logger{}
 	var cfg config
 
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.Func("log-level", "Minimum log level (debug|info|warn|error|fatal|off), changeable at runtime through /v1/admin/log-level (default info)", func(val string) error {
+		var err error
+		cfg.log.level, err = jsonlog.ParseLevel(val)
+		return err
+	})
+	flag.IntVar(&cfg.log.sampling.Initial, "log-sample-initial", 0, "Lines with the same level and message, or request lines with the same route and status, written per second before sampling, 0 disables sampling")
+	flag.IntVar(&cfg.log.sampling.Thereafter, "log-sample-thereafter", 100, "Once sampling, write one in this many lines, 0 drops them all")
+	flag.StringVar(&cfg.tracing.Exporter, "trace-exporter", tracing.ExporterNone, "Where spans are sent (none|stdout|file|otlp), incoming traceparent headers are honoured either way")
+	flag.StringVar(&cfg.tracing.File, "trace-file", "traces.json", "File receiving spans with -trace-exporter=file")
+	flag.StringVar(&cfg.tracing.Endpoint, "trace-otlp-endpoint", "http://localhost:4318/v1/traces", "OTLP/HTTP traces endpoint of the collector")
+	flag.Float64Var(&cfg.tracing.SampleRatio, "trace-sample-ratio", 1, "Share of new traces recorded, between 0 and 1")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	flag.Float64Var(&cfg.limiter.ipRPS, "limiter-ip-rps", 10, "Maximum requests per second of a client IP, counted before authentication so bad credentials are limited too")
+	flag.IntVar(&cfg.limiter.ipBurst, "limiter-ip-burst", 20, "Maximum burst of a client IP, counted before authentication")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.StringVar(&cfg.limiter.store, "limiter-store", "memory", "Rate limiter storage, postgres shares the limits between instances (memory|postgres)")
+	flag.StringVar(&cfg.limiter.key, "limiter-key", "apikey", "Count requests per client IP, per user or per API key (ip|user|apikey)")
+	flag.Func("limiter-route", "Rate limit of the routes starting with a prefix as prefix=rps:burst, e.g. /v1/tokens=0.2:5 (repeatable)", func(val string) error {
+		prefix, limit, ok := strings.Cut(val, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("invalid route rate limit %q", val)
+		}
+		l, err := ratelimit.ParseLimit(limit)
+		if err != nil {
+			return err
+		}
+		if cfg.limiter.routes == nil {
+			cfg.limiter.routes = map[string]ratelimit.Limit{}
+		}
+		cfg.limiter.routes[prefix] = l
+		return nil
+	})
 	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
 	flag.StringVar(&cfg.smtp.username, "smtp-username", "21029aca184cab", "SMTP username")
 	flag.StringVar(&cfg.smtp.password, "smtp-password", "c97390a8ba10ac", "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.alexedwards.net>", "SMTP sender")
-	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
-		cfg.cors.trustedOrigins = strings.Fields(val)
+	cfg.cors.AllowedOrigins = []string{"http://localhost:9000"}
+	cfg.cors.AllowedMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+	cfg.cors.AllowedHeaders = []string{"Authorization", "Content-Type", "X-API-Key", "traceparent", middlewares.RequestIDHeader, middlewares.OrganizationHeader, middlewares.IdempotencyKeyHeader}
+	cfg.cors.ExposedHeaders = []string{"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", middlewares.RequestIDHeader, middlewares.IdempotentReplayedHeader}
+	flag.Func("cors-trusted-origins", "Trusted CORS origins, * replacing the leftmost host label matches subdomains (space separated, default http://localhost:9000)", func(val string) error {
+		cfg.cors.AllowedOrigins = strings.Fields(val)
+		return nil
+	})
+	flag.Func("cors-allowed-methods", "Methods allowed in cross-origin requests (space separated, default GET POST PUT PATCH DELETE)", func(val string) error {
+		cfg.cors.AllowedMethods = strings.Fields(val)
 		return nil
 	})
+	flag.Func("cors-allowed-headers", "Request headers allowed in cross-origin requests (space separated)", func(val string) error {
+		cfg.cors.AllowedHeaders = strings.Fields(val)
+		return nil
+	})
+	flag.Func("cors-exposed-headers", "Response headers readable by cross-origin scripts (space separated)", func(val string) error {
+		cfg.cors.ExposedHeaders = strings.Fields(val)
+		return nil
+	})
+	flag.BoolVar(&cfg.cors.AllowCredentials, "cors-allow-credentials", false, "Allow credentialed cross-origin requests")
+	flag.DurationVar(&cfg.cors.MaxAge, "cors-max-age", 10*time.Minute, "How long browsers may cache preflight responses")
+
+	flag.IntVar(&cfg.compression.MinSize, "compress-min-size", 1024, "Compress text-like response bodies of at least this many bytes with brotli, gzip or deflate")
+	flag.IntVar(&cfg.compression.Level, "compress-level", gzip.DefaultCompression, "brotli, gzip and deflate compression level (1-9, -1 for the default of each)")
+
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long responses to requests with an Idempotency-Key are kept for retries")
+
+	flag.StringVar(&cfg.metrics.addr, "metrics-addr", "", "Serve /metrics and /debug/vars unauthenticated on this separate address, e.g. localhost:9100, instead of on the API behind the metrics:read permission")
+
+	flag.Func("trusted-proxies", "CIDRs of the proxies whose Forwarded and X-Forwarded-For headers give the client IP (space separated)", func(val string) error {
+		var err error
+		cfg.proxies.trusted, err = httphelpers.ParseTrustedProxies(val)
+		return err
+	})
+
+	flag.StringVar(&cfg.auth.tokenFormat, "auth-token-format", "opaque", "Authentication token format (opaque|jwt)")
+	flag.Func("jwt-keys", "JWT keys as kid:alg:path, alg being HS256 or EdDSA (space separated)", func(val string) error {
+		cfg.auth.jwt.keys = strings.Fields(val)
+		return nil
+	})
+	flag.StringVar(&cfg.auth.jwt.signingKid, "jwt-signing-kid", "", "Key ID used to sign new JWTs, the others only verify")
+	flag.StringVar(&cfg.auth.jwt.issuer, "jwt-issuer", "greenlight", "JWT issuer claim")
+	flag.DurationVar(&cfg.auth.jwt.ttl, "jwt-ttl", 15*time.Minute, "JWT lifetime. JWTs carry the permissions held when signed, grants and revokes reach a session once it logs in again, logout and disabled users go through the denylist")
+	flag.DurationVar(&cfg.auth.jwt.syncInterval, "jwt-sync-interval", 10*time.Second, "How often revoked JWTs and disabled users are reloaded, the longest they stay usable on other instances")
+
+	flag.StringVar(&cfg.mfa.encryptionKey, "mfa-encryption-key", "", "Hex encoded 32 byte key encrypting TOTP secrets, two-factor enrolment is unavailable without it")
+	flag.StringVar(&cfg.mfa.issuer, "mfa-issuer", "Greenlight", "Issuer shown by authenticator apps")
+	cfg.mfa.requiredPermissions = []string{"movies:write"}
+	flag.Func("mfa-required-permissions", "Permissions whose routes need two-factor authentication enabled, enforced with -mfa-encryption-key set (space separated, default movies:write)", func(val string) error {
+		cfg.mfa.requiredPermissions = strings.Fields(val)
+		return nil
+	})
+
+	flag.IntVar(&cfg.lockout.freeAttempts, "lockout-free-attempts", 3, "Failed logins allowed per account before backoff starts")
+	flag.IntVar(&cfg.lockout.ipFreeAttempts, "lockout-ip-free-attempts", 20, "Failed logins allowed per client IP before backoff starts")
+	flag.DurationVar(&cfg.lockout.baseDelay, "lockout-base-delay", time.Second, "First backoff delay, doubled on each further failure")
+	flag.DurationVar(&cfg.lockout.maxDelay, "lockout-max-delay", 15*time.Minute, "Maximum backoff delay")
+	flag.IntVar(&cfg.lockout.maxFailures, "lockout-max-failures", 10, "Failed logins that lock an account")
+	flag.DurationVar(&cfg.lockout.duration, "lockout-duration", 30*time.Minute, "How long a locked account stays locked")
+	flag.DurationVar(&cfg.lockout.window, "lockout-window", time.Hour, "How long a failed login is remembered")
+
+	flag.Func("oidc-provider", "OIDC provider as name=,issuer=,client-id=,client-secret=,redirect-url= (repeatable)", func(val string) error {
+		provider, err := oidc.ParseConfig(val)
+		if err != nil {
+			return err
+		}
+		cfg.oidc.providers = append(cfg.oidc.providers, provider)
+		return nil
+	})
+
+	flag.StringVar(&cfg.rbac.defaultRole, "default-role", "viewer", "Role given to new accounts")
+	flag.DurationVar(&cfg.rbac.cacheTTL, "permissions-cache-ttl", time.Minute, "How long resolved permissions are cached")
+	flag.IntVar(&cfg.rbac.cacheSize, "permissions-cache-size", 10000, "Maximum number of users with cached permissions, 0 disables the cache")
+
+	flag.Func("email-allowed-domains", "Only accept signups from these email domains (comma separated)", func(val string) error {
+		cfg.email.allowedDomains = emailpolicy.ParseDomains(val)
+		return nil
+	})
+	flag.Func("email-denied-domains", "Refuse signups from these email domains (comma separated)", func(val string) error {
+		cfg.email.deniedDomains = emailpolicy.ParseDomains(val)
+		return nil
+	})
+	flag.BoolVar(&cfg.email.blockDisposable, "email-block-disposable", true, "Refuse disposable email providers")
+	flag.BoolVar(&cfg.email.checkMX, "email-check-mx", false, "Require email domains to have an MX record")
+
+	flag.Func("password-required-classes", "Character classes new passwords need: lower, upper, digit, symbol (comma separated)", func(val string) error {
+		for _, name := range strings.Split(val, ",") {
+			class, ok := usersModels.ParseCharClass(strings.TrimSpace(name))
+			if !ok {
+				return fmt.Errorf("unknown character class %q", name)
+			}
+			cfg.password.requiredClasses = append(cfg.password.requiredClasses, class)
+		}
+		return nil
+	})
+	flag.BoolVar(&cfg.password.rejectPersonal, "password-reject-personal", true, "Refuse passwords containing the user's name or email")
+	flag.StringVar(&cfg.password.breachedFile, "password-breached-file", "", "Sorted SHA1:COUNT file of breached passwords to refuse")
+	cfg.password.hashing = usersModels.DefaultPasswordHashing()
+	flag.StringVar(&cfg.password.hashing.Algorithm, "password-hash", cfg.password.hashing.Algorithm, "Algorithm of new password hashes (argon2id|bcrypt), other hashes are upgraded on login")
+	flag.IntVar(&cfg.password.hashing.BcryptCost, "bcrypt-cost", cfg.password.hashing.BcryptCost, "bcrypt cost of new password hashes")
+	flag.Func("argon2-memory", "argon2id memory in KiB (default 19456)", func(val string) error {
+		n, err := strconv.ParseUint(val, 10, 32)
+		cfg.password.hashing.Argon2.Memory = uint32(n)
+		return err
+	})
+	flag.Func("argon2-iterations", "argon2id iterations (default 2)", func(val string) error {
+		n, err := strconv.ParseUint(val, 10, 32)
+		cfg.password.hashing.Argon2.Iterations = uint32(n)
+		return err
+	})
+	flag.Func("argon2-parallelism", "argon2id threads (default 1)", func(val string) error {
+		n, err := strconv.ParseUint(val, 10, 8)
+		cfg.password.hashing.Argon2.Parallelism = uint8(n)
+		return err
+	})
 
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
@@ -96,9 +326,50 @@ func main() {
 		os.Exit(0)
 	}
 
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	logger := jsonlog.New(os.Stdout, cfg.log.level)
+	logger.SetSampling(cfg.log.sampling)
+	taskutils.Logger = logger
+	setDefaultSlog(logger)
+
+	cfg.tracing.ServiceName = "greenlight"
+	cfg.tracing.ServiceVersion = version
+	shutdownTracing, err := tracing.Setup(cfg.tracing)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	err = usersModels.SetPasswordHashing(cfg.password.hashing)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	err = cfg.cors.Validate()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	err = cfg.compression.Validate()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
-	var err error
+	var passwordRules []usersModels.PasswordRule
+	if len(cfg.password.requiredClasses) > 0 {
+		passwordRules = append(passwordRules, usersModels.RequireCharClasses(cfg.password.requiredClasses...))
+	}
+	if cfg.password.rejectPersonal {
+		passwordRules = append(passwordRules, usersModels.RejectPersonalInfo())
+	}
+	if cfg.password.breachedFile != "" {
+		breachedFile, err := breached.OpenFile(cfg.password.breachedFile)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		defer breachedFile.Close()
+
+		passwordRules = append(passwordRules, usersModels.RejectBreached(breached.NewChecker(breachedFile)))
+	}
+	usersModels.SetPasswordPolicy(usersModels.PasswordPolicy{Rules: passwordRules})
 
 	db, err := openDB(cfg)
 	if err != nil {
@@ -106,7 +377,18 @@ func main() {
 	}
 	defer db.Close()
 
-	engine := gin.Default()
+	httphelpers.SetTrustedProxies(cfg.proxies.trusted)
+
+	engine := gin.New()
+	trustedProxies := make([]string, len(cfg.proxies.trusted))
+	for i, prefix := range cfg.proxies.trusted {
+		trustedProxies[i] = prefix.String()
+	}
+	err = engine.SetTrustedProxies(trustedProxies)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	engine.HandleMethodNotAllowed = true
 	engine.NoRoute(gin.HandlerFunc(httphelpers.StatusNotFoundResponse))
 	engine.NoMethod(gin.HandlerFunc(httphelpers.StatusMethodNotAllowedResponse))
 
@@ -129,54 +411,262 @@ func main() {
 		MovieService: ms,
 	}
 
+	orgs := organizationsService.NewOrganizationService(organizationsRepo.NewOrganizationRepo(db), logger)
+
+	organizationsHandler := &organizationsHandler.Handler{
+		Logger:              logger,
+		Version:             version,
+		Env:                 "development",
+		OrganizationService: orgs,
+	}
+
 	ur := usersRepo.NewUserRepo(db)
 	tr := usersRepo.New(db)
-	pr := permissionsRepo.NewPermissionsRepo(db)
-	ps := permissionsService.NewPermissionsService(pr, logger)
+	pc := permissionsCache.New(cfg.rbac.cacheTTL, cfg.rbac.cacheSize)
+	pr := permissionsRepo.NewCachedPermissionsRepo(permissionsRepo.NewPermissionsRepo(db), pc)
+	taskutils.Background(func() {
+		err := pr.Listen(context.Background(), cfg.db.dsn, logger)
+		if err != nil {
+			logger.PrintError(err, map[string]string{"task": "permissions listener"})
+		}
+	})
+	ps := permissionsService.NewPermissionsService(pr, cfg.rbac.defaultRole, logger)
+
+	_, err = ps.GetRole(context.Background(), cfg.rbac.defaultRole)
+	if err != nil {
+		logger.PrintFatal(fmt.Errorf("default role %q: %w", cfg.rbac.defaultRole, err), nil)
+	}
 	mailer := mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+	ep := emailpolicy.New(emailpolicy.Config{
+		Allow:           cfg.email.allowedDomains,
+		Deny:            cfg.email.deniedDomains,
+		BlockDisposable: cfg.email.blockDisposable,
+		CheckMX:         cfg.email.checkMX,
+	})
 	us := usersService.NewUserService(ur,
 		tr,
 		logger,
 		mailer,
-		ps)
+		ps,
+		orgs,
+		ep)
 
 	ts := usersService.NewTokensService(
 		tr,
 		logger,
 	)
 
-	usersHandler := &utHandler.Handler{
+	var js utHandler.JWTService
+	if cfg.auth.tokenFormat == "jwt" {
+		keys, err := jwt.LoadKeys(cfg.auth.jwt.keys)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		keyset, err := jwt.NewKeyset(cfg.auth.jwt.signingKid, keys...)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		jwtService := usersService.NewJWTService(keyset, cfg.auth.jwt.issuer, cfg.auth.jwt.ttl, usersRepo.NewDenylistRepo(db), ps, logger)
+		taskutils.Background(func() {
+			jwtService.SyncDenylist(context.Background(), cfg.auth.jwt.syncInterval)
+		})
+		js = jwtService
+	}
+
+	var box *secretbox.Box
+	if cfg.mfa.encryptionKey != "" {
+		box, err = secretbox.NewFromHex(cfg.mfa.encryptionKey)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+	mfas := usersService.NewMFAService(usersRepo.NewMFARepo(db), box, cfg.mfa.issuer, logger)
+
+	mfaRequirement := middlewares.MFARequirement{Permissions: cfg.mfa.requiredPermissions}
+	if box != nil {
+		mfaRequirement.Checker = mfas
+	} else if len(cfg.mfa.requiredPermissions) > 0 {
+		logger.Warn("two-factor authentication is not configured, -mfa-required-permissions is not enforced")
+	}
+
+	ls := usersService.NewLockoutService(usersRepo.NewThrottleRepo(db), usersService.LockoutPolicy{
+		FreeAttempts:   cfg.lockout.freeAttempts,
+		IPFreeAttempts: cfg.lockout.ipFreeAttempts,
+		BaseDelay:      cfg.lockout.baseDelay,
+		MaxDelay:       cfg.lockout.maxDelay,
+		MaxFailures:    cfg.lockout.maxFailures,
+		LockDuration:   cfg.lockout.duration,
+		Window:         cfg.lockout.window,
+	}, logger, mailer)
+
+	var providers []*oidc.Client
+	for _, provider := range cfg.oidc.providers {
+		providers = append(providers, oidc.NewClient(provider, nil))
+	}
+	oidcs := usersService.NewOIDCService(providers, usersRepo.NewIdentityRepo(db), ur, ps, orgs, ep, logger)
+
+	aks := apikeysService.NewAPIKeyService(apikeysRepo.NewAPIKeyRepo(db), ps, logger)
+
+	apikeysHandler := &apikeysHandler.Handler{
+		Logger:        logger,
+		Version:       version,
+		Env:           "development",
+		APIKeyService: aks,
+	}
+
+	ads := adminService.NewAdminService(adminRepo.NewAdminRepo(db), ps, logger)
+
+	adminHandler := &adminHandler.Handler{
 		Logger:       logger,
 		Version:      version,
 		Env:          "development",
-		UserService:  us,
-		TokenService: ts,
+		AdminService: ads,
 	}
 
-	tokensHandler := &utHandler.TokenHandler{
+	usersHandler := &utHandler.Handler{
 		Logger:       logger,
 		Version:      version,
 		Env:          "development",
-		TokenService: ts,
 		UserService:  us,
+		TokenService: ts,
+	}
+
+	tokensHandler := &utHandler.TokenHandler{
+		Logger:              logger,
+		Version:             version,
+		Env:                 "development",
+		TokenService:        ts,
+		UserService:         us,
+		JWTService:          js,
+		MFAService:          mfas,
+		LockoutService:      ls,
+		OrganizationService: orgs,
 	}
 
+	oidcHandler := &utHandler.OIDCHandler{
+		Logger:         logger,
+		Version:        version,
+		Env:            "development",
+		OIDCService:    oidcs,
+		TokenService:   ts,
+		JWTService:     js,
+		MFAService:     mfas,
+		LockoutService: ls,
+	}
+
+	mfaHandler := &utHandler.MFAHandler{
+		Logger:     logger,
+		Version:    version,
+		Env:        "development",
+		MFAService: mfas,
+	}
+
+	var limiterStore ratelimit.Store
+	switch cfg.limiter.store {
+	case "memory":
+		limiterStore = ratelimit.NewMemoryStore()
+	case "postgres":
+		limiterStore = ratelimit.NewPostgresStore(db)
+	default:
+		logger.PrintFatal(fmt.Errorf("unknown rate limiter store %q", cfg.limiter.store), nil)
+	}
+	taskutils.Background(func() {
+		for range time.Tick(time.Minute) {
+			err := limiterStore.Prune(context.Background())
+			if err != nil {
+				logger.PrintError(err, map[string]string{"task": "rate limiter prune"})
+			}
+		}
+	})
+
+	idempotencyStore := idempotency.NewPostgresStore(db)
+	taskutils.Background(func() {
+		for range time.Tick(time.Minute) {
+			err := idempotencyStore.Prune(context.Background())
+			if err != nil {
+				logger.PrintError(err, map[string]string{"task": "idempotency keys prune"})
+			}
+		}
+	})
+
+	var limiterKey middlewares.RateLimitKey
+	switch cfg.limiter.key {
+	case "ip":
+		limiterKey = middlewares.RateLimitByIP
+	case "user":
+		limiterKey = middlewares.RateLimitByUser
+	case "apikey":
+		limiterKey = middlewares.RateLimitByAPIKey
+	default:
+		logger.PrintFatal(fmt.Errorf("unknown rate limiter key %q", cfg.limiter.key), nil)
+	}
+
+	var ipLimiterPolicies, limiterPolicies []middlewares.RateLimitPolicy
+	if cfg.limiter.enabled {
+		ipLimit := ratelimit.Limit{Rate: cfg.limiter.ipRPS, Burst: cfg.limiter.ipBurst}
+		err = ipLimit.Validate()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		ipLimiterPolicies = append(ipLimiterPolicies, middlewares.RateLimitPolicy{
+			Name:  "preauth",
+			Limit: ipLimit,
+			Key:   middlewares.RateLimitByIP,
+		})
+
+		limit := ratelimit.Limit{Rate: cfg.limiter.rps, Burst: cfg.limiter.burst}
+		err = limit.Validate()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		limiterPolicies = append(limiterPolicies, middlewares.RateLimitPolicy{Limit: limit, Key: limiterKey})
+		for prefix, limit := range cfg.limiter.routes {
+			limiterPolicies = append(limiterPolicies, middlewares.RateLimitPolicy{Prefix: prefix, Limit: limit, Key: limiterKey})
+		}
+	}
+
+	metricsRegistry, requestDuration := newMetrics(db)
+
+	policies := authz.New()
+
 	engine.Use(
+		middlewares.RequestID(),
+		middlewares.Trace(),
+		middlewares.LogRequests(logger),
+		middlewares.Metrics(requestDuration),
 		middlewares.RecoverPanic(),
-		middlewares.RateLimit(cfg.limiter.enabled),
-		middlewares.EnableCors("http://localhost:9000"),
-		middlewares.EnableCors(cfg.cors.trustedOrigins...),
-		middlewares.Authenticate(ur),
-		middlewares.RequirePermission(pr, "movies:read"),
-		middlewares.Metrics(),
+		middlewares.Compress(cfg.compression),
+		middlewares.CORS(cfg.cors),
+		// Requests are counted per client IP before authenticating them, so
+		// failed authentications, which never reach the next limiter, are too
+		middlewares.Traced("RateLimitIP", middlewares.RateLimit(limiterStore, logger, ipLimiterPolicies...)),
+		middlewares.Traced("Authenticate", middlewares.Authenticate(ur, js, aks)),
+		middlewares.AuditImpersonation(ads),
+		middlewares.Traced("RateLimit", middlewares.RateLimit(limiterStore, logger, limiterPolicies...)),
+		middlewares.Traced("Authorize", middlewares.Authorize(policies, pr, mfaRequirement)),
+		middlewares.Traced("Idempotency", middlewares.Idempotency(idempotencyStore, cfg.idempotency.ttl)),
 	)
-	v1 := engine.Group("/v1")
+	v1 := authz.NewGroup(engine.Group("/v1"), policies)
 	{
 
 		healthcheckRoutes.MakeRoutes(v1, healthcheckHandler)
-		moviesRoutes.MakeRoutes(v1, moviesHandler)
-		userRoutes.MakeRoutes(v1, usersHandler, tokensHandler)
-		metricsRoutes.MakeRoutes(v1)
+		moviesRoutes.MakeRoutes(v1, moviesHandler, middlewares.Traced("ActiveOrganization", middlewares.ActiveOrganization(orgs)))
+		organizationsRoutes.MakeRoutes(v1, organizationsHandler)
+		userRoutes.MakeRoutes(v1, usersHandler, tokensHandler, mfaHandler, oidcHandler)
+		apikeysRoutes.MakeRoutes(v1, apikeysHandler)
+		adminRoutes.MakeRoutes(v1, adminHandler)
+	}
+	if cfg.metrics.addr == "" {
+		metricsRoutes.MakeRoutes(authz.NewGroup(&engine.RouterGroup, policies), v1, metricsRegistry)
+	}
+
+	err = policies.Verify(engine.Routes())
+	if err != nil {
+		logger.PrintFatal(err, nil)
 	}
 
 	expvar.NewString("version").Set(version)
@@ -186,6 +676,9 @@ func main() {
 	expvar.Publish("database", expvar.Func(func() any {
 		return db.Stats()
 	}))
+	expvar.Publish("permissions_cache", expvar.Func(func() any {
+		return pc.Stats()
+	}))
 	expvar.Publish("timestamp", expvar.Func(func() any {
 		return time.Now().Unix()
 	}))
@@ -195,6 +688,8 @@ func main() {
 		logger:             logger,
 		HealthcheckHandler: healthcheckHandler,
 		MoviesHandler:      moviesHandler,
+		Metrics:            metricsRegistry.Handler(),
+		ShutdownTracing:    shutdownTracing,
 	}
 
 	err = Serve(info, engine)
@@ -204,10 +699,11 @@ func main() {
 }
 
 func openDB(cfg config) (*sqlx.DB, error) {
-	db, err := sqlx.Open("postgres", cfg.db.dsn)
+	connector, err := pq.NewConnector(cfg.db.dsn)
 	if err != nil {
 		return nil, err
 	}
+	db := sqlx.NewDb(sql.OpenDB(tracing.WrapConnector(connector)), "postgres")
 
 	db.SetMaxOpenConns(cfg.db.maxOpenConns)
 	db.SetMaxIdleConns(cfg.db.maxIdleConns)
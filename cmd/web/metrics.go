@@ -0,0 +1,69 @@
+package main
+
+import (
+	"runtime"
+
+	"greenlight/pkg/mailer"
+	"greenlight/pkg/metrics"
+	"greenlight/pkg/taskutils"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// newMetrics registers the metrics exposed at /metrics and returns the request
+// duration histogram fed by middlewares.Metrics
+func newMetrics(db *sqlx.DB) (*metrics.Registry, *metrics.Histogram) {
+	registry := metrics.NewRegistry()
+
+	requestDuration := registry.Histogram("http_request_duration_seconds",
+		"Time spent serving HTTP requests", metrics.DefaultBuckets, "route", "method", "status")
+
+	registry.GaugeFunc("go_goroutines", "Number of goroutines", func() []metrics.Sample {
+		return metrics.Value(float64(runtime.NumGoroutine()))
+	})
+
+	registry.GaugeFunc("db_connections", "Database connections by state", func() []metrics.Sample {
+		stats := db.Stats()
+		return []metrics.Sample{
+			{Labels: []metrics.Label{{Name: "state", Value: "in_use"}}, Value: float64(stats.InUse)},
+			{Labels: []metrics.Label{{Name: "state", Value: "idle"}}, Value: float64(stats.Idle)},
+		}
+	})
+	registry.GaugeFunc("db_max_open_connections", "Maximum number of open database connections", func() []metrics.Sample {
+		return metrics.Value(float64(db.Stats().MaxOpenConnections))
+	})
+	registry.CounterFunc("db_wait", "Connections waited for", func() []metrics.Sample {
+		return metrics.Value(float64(db.Stats().WaitCount))
+	})
+	registry.CounterFunc("db_wait_duration_seconds", "Time spent waiting for connections", func() []metrics.Sample {
+		return metrics.Value(db.Stats().WaitDuration.Seconds())
+	})
+	registry.CounterFunc("db_closed_connections", "Connections closed by the pool limits", func() []metrics.Sample {
+		stats := db.Stats()
+		return []metrics.Sample{
+			{Labels: []metrics.Label{{Name: "reason", Value: "max_idle"}}, Value: float64(stats.MaxIdleClosed)},
+			{Labels: []metrics.Label{{Name: "reason", Value: "max_idle_time"}}, Value: float64(stats.MaxIdleTimeClosed)},
+			{Labels: []metrics.Label{{Name: "reason", Value: "max_lifetime"}}, Value: float64(stats.MaxLifetimeClosed)},
+		}
+	})
+
+	registry.GaugeFunc("background_tasks_running", "Background tasks running", func() []metrics.Sample {
+		return metrics.Value(float64(taskutils.GetStats().Running))
+	})
+	registry.CounterFunc("background_tasks_started", "Background tasks started", func() []metrics.Sample {
+		return metrics.Value(float64(taskutils.GetStats().Started))
+	})
+	registry.CounterFunc("background_tasks_panicked", "Background tasks that panicked", func() []metrics.Sample {
+		return metrics.Value(float64(taskutils.GetStats().Panicked))
+	})
+
+	registry.CounterFunc("mail_sent", "Emails by send result", func() []metrics.Sample {
+		stats := mailer.GetStats()
+		return []metrics.Sample{
+			{Labels: []metrics.Label{{Name: "result", Value: "sent"}}, Value: float64(stats.Sent)},
+			{Labels: []metrics.Label{{Name: "result", Value: "failed"}}, Value: float64(stats.Failed)},
+		}
+	})
+
+	return registry, requestDuration
+}
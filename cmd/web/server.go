@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
 	"os"
@@ -23,16 +25,47 @@ type info struct {
 	logger             *jsonlog.Logger
 	HealthcheckHandler *healthcheckHandler.Handler
 	MoviesHandler      *moviesHandler.Handler
+	Metrics            http.Handler
+	ShutdownTracing    func(context.Context) error
 }
 
 func Serve(info info, r *gin.Engine) error {
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", info.cfg.port),
+		Handler:      r,
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
 
+	// Metrics on their own listener are not behind authentication, it must
+	// only be reachable from the monitoring network
+	var metricsSrv *http.Server
+	if info.cfg.metrics.addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", info.Metrics)
+		mux.Handle("/debug/vars", expvar.Handler())
+
+		metricsSrv = &http.Server{
+			Addr:         info.cfg.metrics.addr,
+			Handler:      mux,
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			info.logger.PrintInfo("starting metrics server", map[string]string{
+				"addr": metricsSrv.Addr,
+			})
+
+			err := metricsSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				info.logger.PrintError(err, map[string]string{"addr": metricsSrv.Addr})
+			}
+		}()
+	}
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -47,6 +80,13 @@ func Serve(info info, r *gin.Engine) error {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
+		if metricsSrv != nil {
+			err := metricsSrv.Shutdown(ctx)
+			if err != nil {
+				info.logger.PrintError(err, map[string]string{"addr": metricsSrv.Addr})
+			}
+		}
+
 		err := srv.Shutdown(ctx)
 		if err != nil {
 			shutdownError <- err
@@ -57,6 +97,14 @@ func Serve(info info, r *gin.Engine) error {
 		})
 
 		taskutils.WaitAll()
+
+		// Flush the spans of the last requests and background tasks
+		err = info.ShutdownTracing(ctx)
+		if err != nil {
+			info.logger.PrintError(err, nil)
+		}
+
+		shutdownError <- nil
 	}()
 
 	info.logger.PrintInfo("starting server", map[string]string{
@@ -64,8 +112,8 @@ func Serve(info info, r *gin.Engine) error {
 		"env":  info.cfg.env,
 	})
 
-	err := r.Run(srv.Addr)
-	if err != nil {
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 
@@ -0,0 +1,14 @@
+//go:build go1.21
+
+package main
+
+import (
+	"log/slog"
+
+	"greenlight/pkg/jsonlog"
+)
+
+// setDefaultSlog sends the lines of libraries using log/slog to logger
+func setDefaultSlog(logger *jsonlog.Logger) {
+	slog.SetDefault(slog.New(logger.SlogHandler()))
+}
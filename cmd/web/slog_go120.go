@@ -0,0 +1,10 @@
+//go:build !go1.21
+
+package main
+
+import (
+	"greenlight/pkg/jsonlog"
+)
+
+// setDefaultSlog does nothing, log/slog needs Go 1.21
+func setDefaultSlog(logger *jsonlog.Logger) {}
@@ -0,0 +1,646 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"greenlight/internal/admin/models"
+	"greenlight/internal/admin/serviceerrors"
+	commonmodels "greenlight/internal/models"
+	permissionsmodels "greenlight/internal/permissions/models"
+	permissionsserviceerrors "greenlight/internal/permissions/serviceerrors"
+	usersmodels "greenlight/internal/users/models"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	Logger       *jsonlog.Logger
+	Version      string
+	Env          string
+	AdminService AdminService
+}
+
+type AdminService interface {
+	SearchUsers(ctx context.Context, actor models.Actor, search models.UserSearch, filters commonmodels.Filters) ([]usersmodels.User, commonmodels.Metadata, error)
+	GetUser(ctx context.Context, actor models.Actor, id int64) (usersmodels.User, error)
+	GetUserPermissions(ctx context.Context, actor models.Actor, id int64) (permissionsmodels.Permissions, permissionsmodels.Permissions, error)
+	GetPermissions(ctx context.Context) (permissionsmodels.Permissions, error)
+	SetUserPermission(ctx context.Context, actor models.Actor, id int64, code string, granted bool) error
+	GetUserSessions(ctx context.Context, actor models.Actor, id int64) ([]models.Session, error)
+	SetUserDisabled(ctx context.Context, actor models.Actor, id int64, disabled bool) (usersmodels.User, error)
+	Impersonate(ctx context.Context, actor models.Actor, id int64, ttl time.Duration) (usersmodels.Token, error)
+	GetAuditLog(ctx context.Context, targetUserID int64, filters commonmodels.Filters) ([]models.AuditEntry, commonmodels.Metadata, error)
+	GetRoles(ctx context.Context) ([]permissionsmodels.Role, error)
+	GetRole(ctx context.Context, name string) (permissionsmodels.Role, error)
+	AddRole(ctx context.Context, actor models.Actor, role permissionsmodels.Role) (permissionsmodels.Role, error)
+	UpdateRole(ctx context.Context, actor models.Actor, role permissionsmodels.Role) (permissionsmodels.Role, error)
+	DeleteRole(ctx context.Context, actor models.Actor, name string) error
+	GetUserRoles(ctx context.Context, actor models.Actor, id int64) ([]string, error)
+	SetUserRole(ctx context.Context, actor models.Actor, id int64, name string, assigned bool) error
+	GetLogLevel() jsonlog.Level
+	SetLogLevel(ctx context.Context, actor models.Actor, level jsonlog.Level) error
+}
+
+func (h *Handler) ListUsers() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, ok := h.actor(c)
+		if !ok {
+			return
+		}
+
+		v := validator.New()
+		qs := c.Request.URL.Query()
+
+		search := models.UserSearch{
+			Query:     httphelpers.ReadString(qs, "q", ""),
+			Activated: readBool(qs.Get("activated"), "activated", v),
+			Disabled:  readBool(qs.Get("disabled"), "disabled", v),
+		}
+
+		filters := commonmodels.Filters{
+			Page:         httphelpers.ReadInt(qs, "page", 1, v),
+			PageSize:     httphelpers.ReadInt(qs, "page_size", 20, v),
+			Sort:         httphelpers.ReadString(qs, "sort", "id"),
+			SortSafeList: []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"},
+		}
+
+		if commonmodels.ValidateFilters(v, filters); !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		users, metadata, err := h.AdminService.SearchUsers(c, actor, search, filters)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"users": users, "metadata": metadata}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) GetUser() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, id, ok := h.actorAndID(c)
+		if !ok {
+			return
+		}
+
+		user, err := h.AdminService.GetUser(c, actor, id)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"user": user}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) GetUserPermissions() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, id, ok := h.actorAndID(c)
+		if !ok {
+			return
+		}
+
+		permissions, granted, err := h.AdminService.GetUserPermissions(c, actor, id)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		if len(permissions) == 0 {
+			permissions = permissionsmodels.Permissions{}
+		}
+		if len(granted) == 0 {
+			granted = permissionsmodels.Permissions{}
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"permissions": permissions, "granted": granted}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) ListPermissions() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		permissions, err := h.AdminService.GetPermissions(c)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		if len(permissions) == 0 {
+			permissions = permissionsmodels.Permissions{}
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"permissions": permissions}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) GrantPermission() func(c *gin.Context) {
+	return h.setUserPermission(true)
+}
+
+func (h *Handler) RevokePermission() func(c *gin.Context) {
+	return h.setUserPermission(false)
+}
+
+func (h *Handler) setUserPermission(granted bool) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, id, ok := h.actorAndID(c)
+		if !ok {
+			return
+		}
+
+		err := h.AdminService.SetUserPermission(c, actor, id, c.Param("code"), granted)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		message := "permission successfully revoked"
+		if granted {
+			message = "permission successfully granted"
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"message": message}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) GetUserSessions() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, id, ok := h.actorAndID(c)
+		if !ok {
+			return
+		}
+
+		sessions, err := h.AdminService.GetUserSessions(c, actor, id)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		if len(sessions) == 0 {
+			sessions = []models.Session{}
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"sessions": sessions}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) DisableUser() func(c *gin.Context) {
+	return h.setUserDisabled(true)
+}
+
+func (h *Handler) EnableUser() func(c *gin.Context) {
+	return h.setUserDisabled(false)
+}
+
+func (h *Handler) setUserDisabled(disabled bool) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, id, ok := h.actorAndID(c)
+		if !ok {
+			return
+		}
+
+		user, err := h.AdminService.SetUserDisabled(c, actor, id, disabled)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"user": user}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+type impersonateInput struct {
+	Duration string `json:"duration"`
+}
+
+func (h *Handler) ImpersonateUser() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, id, ok := h.actorAndID(c)
+		if !ok {
+			return
+		}
+
+		input := impersonateInput{Duration: "15m"}
+		if c.Request.ContentLength != 0 {
+			err := httphelpers.ReadJSON(c, &input)
+			if err != nil {
+				httphelpers.StatusBadRequestResponse(c, err.Error())
+				return
+			}
+		}
+
+		v := validator.New()
+
+		ttl, err := time.ParseDuration(input.Duration)
+		if err != nil {
+			v.AddError("duration", "must be a duration such as 15m")
+		} else {
+			models.ValidateImpersonationDuration(v, ttl)
+		}
+
+		if !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		token, err := h.AdminService.Impersonate(c, actor, id, ttl)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusCreated, gin.H{"authentication_token": token}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) ListAuditLog() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		v := validator.New()
+		qs := c.Request.URL.Query()
+
+		targetUserID := httphelpers.ReadInt(qs, "user_id", 0, v)
+
+		filters := commonmodels.Filters{
+			Page:         httphelpers.ReadInt(qs, "page", 1, v),
+			PageSize:     httphelpers.ReadInt(qs, "page_size", 20, v),
+			Sort:         httphelpers.ReadString(qs, "sort", "-created_at"),
+			SortSafeList: []string{"created_at", "action", "-created_at", "-action"},
+		}
+
+		if commonmodels.ValidateFilters(v, filters); !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		entries, metadata, err := h.AdminService.GetAuditLog(c, int64(targetUserID), filters)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"audit_log": entries, "metadata": metadata}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+type roleInput struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func (h *Handler) ListRoles() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		roles, err := h.AdminService.GetRoles(c)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		if len(roles) == 0 {
+			roles = []permissionsmodels.Role{}
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"roles": roles}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) GetRole() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		role, err := h.AdminService.GetRole(c, c.Param("name"))
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"role": role}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) CreateRole() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, ok := h.actor(c)
+		if !ok {
+			return
+		}
+
+		var input roleInput
+		err := httphelpers.ReadJSON(c, &input)
+		if err != nil {
+			httphelpers.StatusBadRequestResponse(c, err.Error())
+			return
+		}
+
+		role := permissionsmodels.Role{Permissions: input.Permissions}
+		if input.Name != nil {
+			role.Name = *input.Name
+		}
+		if input.Description != nil {
+			role.Description = *input.Description
+		}
+
+		v := validator.New()
+		if permissionsmodels.ValidateRole(v, role); !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		role, err = h.AdminService.AddRole(c, actor, role)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		headers := make(http.Header)
+		headers.Set("Location", "/v1/admin/roles/"+role.Name)
+
+		err = httphelpers.WriteResponse(c, http.StatusCreated, gin.H{"role": role}, headers)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+// UpdateRole changes the description and replaces the permission codes of a
+// role. Fields left out of the request keep their current value.
+func (h *Handler) UpdateRole() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, ok := h.actor(c)
+		if !ok {
+			return
+		}
+
+		role, err := h.AdminService.GetRole(c, c.Param("name"))
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		var input roleInput
+		err = httphelpers.ReadJSON(c, &input)
+		if err != nil {
+			httphelpers.StatusBadRequestResponse(c, err.Error())
+			return
+		}
+
+		if input.Description != nil {
+			role.Description = *input.Description
+		}
+		if input.Permissions != nil {
+			role.Permissions = input.Permissions
+		}
+
+		v := validator.New()
+		if permissionsmodels.ValidateRole(v, role); !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		role, err = h.AdminService.UpdateRole(c, actor, role)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"role": role}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) DeleteRole() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, ok := h.actor(c)
+		if !ok {
+			return
+		}
+
+		err := h.AdminService.DeleteRole(c, actor, c.Param("name"))
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"message": "role successfully deleted"}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) GetUserRoles() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, id, ok := h.actorAndID(c)
+		if !ok {
+			return
+		}
+
+		roles, err := h.AdminService.GetUserRoles(c, actor, id)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		if len(roles) == 0 {
+			roles = []string{}
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"roles": roles}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) AssignRole() func(c *gin.Context) {
+	return h.setUserRole(true)
+}
+
+func (h *Handler) UnassignRole() func(c *gin.Context) {
+	return h.setUserRole(false)
+}
+
+func (h *Handler) setUserRole(assigned bool) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, id, ok := h.actorAndID(c)
+		if !ok {
+			return
+		}
+
+		err := h.AdminService.SetUserRole(c, actor, id, c.Param("name"), assigned)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		message := "role successfully unassigned"
+		if assigned {
+			message = "role successfully assigned"
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"message": message}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) GetLogLevel() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		err := httphelpers.WriteResponse(c, http.StatusOK, gin.H{"level": h.AdminService.GetLogLevel().String()}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) SetLogLevel() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		actor, ok := h.actor(c)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Level *string `json:"level"`
+		}
+		err := httphelpers.ReadJSON(c, &input)
+		if err != nil {
+			httphelpers.StatusBadRequestResponse(c, err.Error())
+			return
+		}
+
+		v := validator.New()
+		v.Check(input.Level != nil, "level", "must be provided")
+		if !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		level, err := jsonlog.ParseLevel(*input.Level)
+		if err != nil {
+			v.AddError("level", "must be one of debug, info, warn, error, fatal or off")
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		err = h.AdminService.SetLogLevel(c, actor, level)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"level": level.String()}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) errorResponse(c *gin.Context, err error) {
+	v := validator.New()
+
+	switch {
+	case errors.Is(err, serviceerrors.ErrUserNotFound),
+		errors.Is(err, permissionsserviceerrors.ErrUserNotFound),
+		errors.Is(err, permissionsserviceerrors.ErrRoleNotFound):
+		httphelpers.StatusNotFoundResponse(c)
+	case errors.Is(err, serviceerrors.ErrSelfAction),
+		errors.Is(err, serviceerrors.ErrUserDisabled),
+		errors.Is(err, serviceerrors.ErrCannotImpersonate),
+		errors.Is(err, permissionsserviceerrors.ErrDefaultRole):
+		httphelpers.ProblemResponse(c, httphelpers.CodeForbidden, err.Error())
+	case errors.Is(err, permissionsserviceerrors.ErrDuplicateRole):
+		v.AddError("name", err.Error())
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+	case errors.Is(err, permissionsserviceerrors.ErrUnknownPermission):
+		v.AddError("permissions", "must only contain existing permission codes, see /v1/admin/permissions")
+		httphelpers.StatusUnprocesableEntities(c, v.Errors)
+	default:
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+// actor returns the admin making the request. Users holding admin permissions
+// cannot be impersonated, so impersonated requests never reach here.
+func (h *Handler) actor(c *gin.Context) (models.Actor, bool) {
+	user, err := httphelpers.ContextGetUser(c)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return models.Actor{}, false
+	}
+
+	return models.Actor{UserID: user.ID, IP: httphelpers.RemoteIP(c)}, true
+}
+
+func (h *Handler) actorAndID(c *gin.Context) (models.Actor, int64, bool) {
+	actor, ok := h.actor(c)
+	if !ok {
+		return models.Actor{}, 0, false
+	}
+
+	id, err := httphelpers.ReadIDParam(c)
+	if err != nil || id < 1 {
+		httphelpers.StatusNotFoundResponse(c)
+		return models.Actor{}, 0, false
+	}
+
+	return actor, id, true
+}
+
+func readBool(s, key string, v *validator.Validator) *bool {
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"greenlight/pkg/validator"
+)
+
+const (
+	ActionListUsers        = "users.list"
+	ActionViewUser         = "users.view"
+	ActionViewPermissions  = "users.permissions.view"
+	ActionViewSessions     = "users.sessions.view"
+	ActionDisableUser      = "users.disable"
+	ActionEnableUser       = "users.enable"
+	ActionImpersonateUser  = "users.impersonate"
+	ActionGrantPermission  = "users.permissions.grant"
+	ActionRevokePermission = "users.permissions.revoke"
+	ActionViewUserRoles    = "users.roles.view"
+	ActionAssignRole       = "users.roles.assign"
+	ActionUnassignRole     = "users.roles.unassign"
+	ActionCreateRole       = "roles.create"
+	ActionUpdateRole       = "roles.update"
+	ActionDeleteRole       = "roles.delete"
+	ActionSetLogLevel      = "logging.level.set"
+)
+
+// ActionImpersonatedRequest is a change made through an impersonation token,
+// recorded with the impersonating admin as the actor
+const ActionImpersonatedRequest = "users.impersonation.request"
+
+// AdminPermission is the code required to use the admin API
+const AdminPermission = "users:admin"
+
+const MaxImpersonationDuration = time.Hour
+
+// Actor is the admin performing an action, as recorded in the audit log
+type Actor struct {
+	UserID int64
+	IP     string
+}
+
+type UserSearch struct {
+	Query     string
+	Activated *bool
+	Disabled  *bool
+}
+
+type AuditEntry struct {
+	ID           int64           `json:"id" db:"id"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+	ActorID      *int64          `json:"actor_id" db:"actor_id"`
+	Action       string          `json:"action" db:"action"`
+	TargetUserID *int64          `json:"target_user_id,omitempty" db:"target_user_id"`
+	IP           string          `json:"ip" db:"ip"`
+	Details      json.RawMessage `json:"details" db:"details"`
+}
+
+// Session is an active authentication token, identified by a prefix of its hash
+// so the token itself is never exposed
+type Session struct {
+	ID             string    `json:"id" db:"id"`
+	Expiry         time.Time `json:"expiry" db:"expiry"`
+	ImpersonatorID *int64    `json:"impersonator_id,omitempty" db:"impersonator_id"`
+}
+
+func ValidateImpersonationDuration(v *validator.Validator, ttl time.Duration) {
+	v.Check(ttl >= time.Minute, "duration", "must be at least one minute")
+	v.Check(ttl <= MaxImpersonationDuration, "duration", "must be a maximum of one hour")
+}
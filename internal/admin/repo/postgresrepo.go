@@ -0,0 +1,236 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"greenlight/internal/admin/models"
+	"greenlight/internal/admin/repoerrors"
+	commonmodels "greenlight/internal/models"
+	usersmodels "greenlight/internal/users/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type adminRepo struct {
+	DB *sqlx.DB
+}
+
+func NewAdminRepo(db *sqlx.DB) *adminRepo {
+	return &adminRepo{
+		DB: db,
+	}
+}
+
+func (r adminRepo) SearchUsers(ctx context.Context, search models.UserSearch,
+	filters commonmodels.Filters,
+) ([]usersmodels.User, commonmodels.Metadata, error) {
+	column, err := filters.SortColumn()
+	if err != nil {
+		return []usersmodels.User{}, commonmodels.Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER() AS total_records,
+            id, created_at, name, email, activated, disabled_at, version
+        FROM users
+        WHERE (name ILIKE '%%' || $1 || '%%' OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+        AND (activated = $2 OR $2 IS NULL)
+        AND ((disabled_at IS NOT NULL) = $3 OR $3 IS NULL)
+        ORDER BY %s %s, id ASC
+        LIMIT $4 OFFSET $5`,
+		column,
+		filters.SortDirection(),
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var rows []struct {
+		TotalRecords int `db:"total_records"`
+		usersmodels.User
+	}
+
+	err = r.DB.SelectContext(ctx, &rows, query,
+		search.Query,
+		search.Activated,
+		search.Disabled,
+		filters.Limit(),
+		filters.Offset(),
+	)
+	if err != nil {
+		return []usersmodels.User{}, commonmodels.Metadata{}, err
+	}
+
+	users := make([]usersmodels.User, 0, len(rows))
+	totalRecords := 0
+	for _, row := range rows {
+		totalRecords = row.TotalRecords
+		users = append(users, row.User)
+	}
+
+	return users, commonmodels.CalculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (r adminRepo) GetUser(ctx context.Context, id int64) (usersmodels.User, error) {
+	query := `
+        SELECT id, created_at, name, email, activated, disabled_at, version
+        FROM users
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var user usersmodels.User
+
+	err := r.DB.GetContext(ctx, &user, query, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return usersmodels.User{}, repoerrors.ErrUserNotFound
+		default:
+			return usersmodels.User{}, err
+		}
+	}
+
+	return user, nil
+}
+
+func (r adminRepo) GetSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	query := `
+        SELECT encode(substring(hash from 1 for 8), 'hex') AS id, expiry, impersonator_id
+        FROM tokens
+        WHERE user_id = $1 AND scope = $2 AND expiry > $3
+        ORDER BY expiry DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var sessions []models.Session
+
+	err := r.DB.SelectContext(ctx, &sessions, query, userID, usersmodels.ScopeAuthentication, time.Now())
+	if err != nil {
+		return sessions, err
+	}
+
+	return sessions, nil
+}
+
+// SetDisabled disables or re-enables an account. Disabling also ends every
+// session of the user in the same transaction.
+func (r adminRepo) SetDisabled(ctx context.Context, userID int64, disabled bool) (usersmodels.User, error) {
+	query := `
+        UPDATE users
+        SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) END, version = version + 1
+        WHERE id = $1
+        RETURNING id, created_at, name, email, activated, disabled_at, version`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return usersmodels.User{}, err
+	}
+	defer tx.Rollback()
+
+	var user usersmodels.User
+
+	err = tx.GetContext(ctx, &user, query, userID, disabled)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return usersmodels.User{}, repoerrors.ErrUserNotFound
+		default:
+			return usersmodels.User{}, err
+		}
+	}
+
+	if disabled {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1`, userID)
+		if err != nil {
+			return usersmodels.User{}, err
+		}
+	}
+
+	return user, tx.Commit()
+}
+
+func (r adminRepo) InsertImpersonationToken(ctx context.Context, token usersmodels.Token, impersonatorID int64) error {
+	query := `
+        INSERT INTO tokens (hash, user_id, expiry, scope, impersonator_id)
+        VALUES ($1, $2, $3, $4, $5)`
+
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, impersonatorID}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r adminRepo) InsertAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	query := `
+        INSERT INTO audit_log (actor_id, action, target_user_id, ip, details)
+        VALUES ($1, $2, $3, $4, $5)`
+
+	details := entry.Details
+	if len(details) == 0 {
+		details = json.RawMessage("{}")
+	}
+
+	args := []any{entry.ActorID, entry.Action, entry.TargetUserID, entry.IP, []byte(details)}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r adminRepo) GetAuditLog(ctx context.Context, targetUserID int64,
+	filters commonmodels.Filters,
+) ([]models.AuditEntry, commonmodels.Metadata, error) {
+	column, err := filters.SortColumn()
+	if err != nil {
+		return []models.AuditEntry{}, commonmodels.Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER() AS total_records,
+            id, created_at, actor_id, action, target_user_id, ip, details
+        FROM audit_log
+        WHERE (target_user_id = $1 OR $1 = 0)
+        ORDER BY %s %s, id DESC
+        LIMIT $2 OFFSET $3`,
+		column,
+		filters.SortDirection(),
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var rows []struct {
+		TotalRecords int `db:"total_records"`
+		models.AuditEntry
+	}
+
+	err = r.DB.SelectContext(ctx, &rows, query, targetUserID, filters.Limit(), filters.Offset())
+	if err != nil {
+		return []models.AuditEntry{}, commonmodels.Metadata{}, err
+	}
+
+	entries := make([]models.AuditEntry, 0, len(rows))
+	totalRecords := 0
+	for _, row := range rows {
+		totalRecords = row.TotalRecords
+		entries = append(entries, row.AuditEntry)
+	}
+
+	return entries, commonmodels.CalculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
@@ -0,0 +1,7 @@
+package repoerrors
+
+import (
+	"errors"
+)
+
+var ErrUserNotFound = errors.New("user not found")
@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"greenlight/internal/admin/handlers"
+	"greenlight/internal/admin/models"
+	"greenlight/pkg/authz"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	ListUsers() func(c *gin.Context)
+	GetUser() func(c *gin.Context)
+	GetUserPermissions() func(c *gin.Context)
+	GetUserSessions() func(c *gin.Context)
+	DisableUser() func(c *gin.Context)
+	EnableUser() func(c *gin.Context)
+	ImpersonateUser() func(c *gin.Context)
+	ListAuditLog() func(c *gin.Context)
+	ListPermissions() func(c *gin.Context)
+	GrantPermission() func(c *gin.Context)
+	RevokePermission() func(c *gin.Context)
+	ListRoles() func(c *gin.Context)
+	GetRole() func(c *gin.Context)
+	CreateRole() func(c *gin.Context)
+	UpdateRole() func(c *gin.Context)
+	DeleteRole() func(c *gin.Context)
+	GetUserRoles() func(c *gin.Context)
+	AssignRole() func(c *gin.Context)
+	UnassignRole() func(c *gin.Context)
+	GetLogLevel() func(c *gin.Context)
+	SetLogLevel() func(c *gin.Context)
+}
+
+func MakeRoutes(engine *authz.Group, handler *handlers.Handler) {
+	requireAdmin := authz.Permission(models.AdminPermission)
+
+	admin := engine.Group("/admin")
+	{
+		admin.GET("/users", requireAdmin, handler.ListUsers())
+		admin.GET("/users/:id", requireAdmin, handler.GetUser())
+		admin.GET("/users/:id/permissions", requireAdmin, handler.GetUserPermissions())
+		admin.GET("/users/:id/sessions", requireAdmin, handler.GetUserSessions())
+		admin.PUT("/users/:id/disabled", requireAdmin, handler.DisableUser())
+		admin.DELETE("/users/:id/disabled", requireAdmin, handler.EnableUser())
+		admin.POST("/users/:id/impersonation", requireAdmin, handler.ImpersonateUser())
+		admin.PUT("/users/:id/permissions/:code", requireAdmin, handler.GrantPermission())
+		admin.DELETE("/users/:id/permissions/:code", requireAdmin, handler.RevokePermission())
+		admin.GET("/users/:id/roles", requireAdmin, handler.GetUserRoles())
+		admin.PUT("/users/:id/roles/:name", requireAdmin, handler.AssignRole())
+		admin.DELETE("/users/:id/roles/:name", requireAdmin, handler.UnassignRole())
+		admin.GET("/permissions", requireAdmin, handler.ListPermissions())
+		admin.GET("/roles", requireAdmin, handler.ListRoles())
+		admin.POST("/roles", requireAdmin, handler.CreateRole())
+		admin.GET("/roles/:name", requireAdmin, handler.GetRole())
+		admin.PATCH("/roles/:name", requireAdmin, handler.UpdateRole())
+		admin.DELETE("/roles/:name", requireAdmin, handler.DeleteRole())
+		admin.GET("/audit-log", requireAdmin, handler.ListAuditLog())
+		admin.GET("/log-level", requireAdmin, handler.GetLogLevel())
+		admin.PUT("/log-level", requireAdmin, handler.SetLogLevel())
+	}
+}
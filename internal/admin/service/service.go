@@ -0,0 +1,453 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"greenlight/internal/admin/models"
+	"greenlight/internal/admin/repoerrors"
+	"greenlight/internal/admin/serviceerrors"
+	commonmodels "greenlight/internal/models"
+	permissionsmodels "greenlight/internal/permissions/models"
+	usersmodels "greenlight/internal/users/models"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/tracing"
+)
+
+type adminService struct {
+	repo               AdminRepo
+	permissionsService PermissionsService
+	logger             *jsonlog.Logger
+}
+
+type AdminRepo interface {
+	SearchUsers(ctx context.Context, search models.UserSearch, filters commonmodels.Filters) ([]usersmodels.User, commonmodels.Metadata, error)
+	GetUser(ctx context.Context, id int64) (usersmodels.User, error)
+	GetSessions(ctx context.Context, userID int64) ([]models.Session, error)
+	SetDisabled(ctx context.Context, userID int64, disabled bool) (usersmodels.User, error)
+	InsertImpersonationToken(ctx context.Context, token usersmodels.Token, impersonatorID int64) error
+	InsertAuditEntry(ctx context.Context, entry models.AuditEntry) error
+	GetAuditLog(ctx context.Context, targetUserID int64, filters commonmodels.Filters) ([]models.AuditEntry, commonmodels.Metadata, error)
+}
+
+type PermissionsService interface {
+	GetAllForUser(ctx context.Context, userID int64) (permissionsmodels.Permissions, error)
+	GetAll(ctx context.Context) (permissionsmodels.Permissions, error)
+	GetGrantedForUser(ctx context.Context, userID int64) (permissionsmodels.Permissions, error)
+	AddForUser(ctx context.Context, userID int64, codes ...string) error
+	RevokeForUser(ctx context.Context, userID int64, codes ...string) error
+	GetRoles(ctx context.Context) ([]permissionsmodels.Role, error)
+	GetRole(ctx context.Context, name string) (permissionsmodels.Role, error)
+	AddRole(ctx context.Context, role permissionsmodels.Role) (permissionsmodels.Role, error)
+	UpdateRole(ctx context.Context, role permissionsmodels.Role) (permissionsmodels.Role, error)
+	DeleteRole(ctx context.Context, name string) error
+	GetRolesForUser(ctx context.Context, userID int64) ([]string, error)
+	AssignRole(ctx context.Context, userID int64, name string) error
+	UnassignRole(ctx context.Context, userID int64, name string) error
+}
+
+func NewAdminService(repo AdminRepo, permissionsService PermissionsService, logger *jsonlog.Logger) *adminService {
+	return &adminService{
+		repo:               repo,
+		permissionsService: permissionsService,
+		logger:             logger,
+	}
+}
+
+func (s *adminService) SearchUsers(ctx context.Context, actor models.Actor, search models.UserSearch,
+	filters commonmodels.Filters,
+) ([]usersmodels.User, commonmodels.Metadata, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.SearchUsers")
+	defer span.End()
+
+	err := s.audit(ctx, actor, models.ActionListUsers, 0, map[string]any{
+		"query":     search.Query,
+		"activated": search.Activated,
+		"disabled":  search.Disabled,
+	})
+	if err != nil {
+		return []usersmodels.User{}, commonmodels.Metadata{}, err
+	}
+
+	return s.repo.SearchUsers(ctx, search, filters)
+}
+
+func (s *adminService) GetUser(ctx context.Context, actor models.Actor, id int64) (usersmodels.User, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetUser")
+	defer span.End()
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return usersmodels.User{}, err
+	}
+
+	err = s.audit(ctx, actor, models.ActionViewUser, id, nil)
+	if err != nil {
+		return usersmodels.User{}, err
+	}
+
+	return user, nil
+}
+
+// GetUserPermissions returns the effective permissions of a user, and the subset
+// granted directly rather than through a role
+func (s *adminService) GetUserPermissions(ctx context.Context, actor models.Actor, id int64,
+) (permissionsmodels.Permissions, permissionsmodels.Permissions, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetUserPermissions")
+	defer span.End()
+
+	_, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = s.audit(ctx, actor, models.ActionViewPermissions, id, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	effective, err := s.permissionsService.GetAllForUser(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	granted, err := s.permissionsService.GetGrantedForUser(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return effective, granted, nil
+}
+
+func (s *adminService) GetPermissions(ctx context.Context) (permissionsmodels.Permissions, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetPermissions")
+	defer span.End()
+
+	return s.permissionsService.GetAll(ctx)
+}
+
+// SetUserPermission grants or revokes a permission code. As with roles, admins
+// cannot change their own permissions.
+func (s *adminService) SetUserPermission(ctx context.Context, actor models.Actor, id int64, code string, granted bool) error {
+	ctx, span := tracing.Start(ctx, "AdminService.SetUserPermission")
+	defer span.End()
+
+	if id == actor.UserID {
+		return serviceerrors.ErrSelfAction
+	}
+
+	_, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	action := models.ActionRevokePermission
+	if granted {
+		action = models.ActionGrantPermission
+		err = s.permissionsService.AddForUser(ctx, id, code)
+	} else {
+		err = s.permissionsService.RevokeForUser(ctx, id, code)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.audit(ctx, actor, action, id, map[string]any{"permission": code})
+}
+
+func (s *adminService) GetUserSessions(ctx context.Context, actor models.Actor, id int64) ([]models.Session, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetUserSessions")
+	defer span.End()
+
+	_, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.audit(ctx, actor, models.ActionViewSessions, id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetSessions(ctx, id)
+}
+
+// SetUserDisabled disables or re-enables an account. Disabled users cannot log
+// in and all of their sessions are ended.
+func (s *adminService) SetUserDisabled(ctx context.Context, actor models.Actor, id int64, disabled bool) (usersmodels.User, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.SetUserDisabled")
+	defer span.End()
+
+	if id == actor.UserID {
+		return usersmodels.User{}, serviceerrors.ErrSelfAction
+	}
+
+	user, err := s.repo.SetDisabled(ctx, id, disabled)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrUserNotFound):
+			return usersmodels.User{}, serviceerrors.ErrUserNotFound
+		default:
+			return usersmodels.User{}, err
+		}
+	}
+
+	action := models.ActionEnableUser
+	if disabled {
+		action = models.ActionDisableUser
+	}
+
+	err = s.audit(ctx, actor, action, id, nil)
+	if err != nil {
+		return usersmodels.User{}, err
+	}
+
+	return user, nil
+}
+
+// Impersonate issues a short lived authentication token for another user. The
+// token records who issued it, and users holding admin permissions are off limits
+// so impersonation can never be used to escalate.
+func (s *adminService) Impersonate(ctx context.Context, actor models.Actor, id int64, ttl time.Duration) (usersmodels.Token, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.Impersonate")
+	defer span.End()
+
+	if id == actor.UserID {
+		return usersmodels.Token{}, serviceerrors.ErrSelfAction
+	}
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return usersmodels.Token{}, err
+	}
+
+	if user.IsDisabled() {
+		return usersmodels.Token{}, serviceerrors.ErrUserDisabled
+	}
+
+	permissions, err := s.permissionsService.GetAllForUser(ctx, id)
+	if err != nil {
+		return usersmodels.Token{}, err
+	}
+
+	if permissions.Include(models.AdminPermission) {
+		return usersmodels.Token{}, serviceerrors.ErrCannotImpersonate
+	}
+
+	token, err := usersmodels.GenerateToken(id, ttl, usersmodels.ScopeAuthentication)
+	if err != nil {
+		return usersmodels.Token{}, err
+	}
+
+	err = s.repo.InsertImpersonationToken(ctx, token, actor.UserID)
+	if err != nil {
+		return usersmodels.Token{}, err
+	}
+
+	err = s.audit(ctx, actor, models.ActionImpersonateUser, id, map[string]any{
+		"expiry": token.Expiry,
+	})
+	if err != nil {
+		return usersmodels.Token{}, err
+	}
+
+	return token, nil
+}
+
+// AuditImpersonatedRequest records a request made by impersonatorID through an
+// impersonation token for userID
+func (s *adminService) AuditImpersonatedRequest(ctx context.Context, impersonatorID, userID int64, ip string,
+	details map[string]any,
+) error {
+	ctx, span := tracing.Start(ctx, "AdminService.AuditImpersonatedRequest")
+	defer span.End()
+
+	actor := models.Actor{UserID: impersonatorID, IP: ip}
+
+	return s.audit(ctx, actor, models.ActionImpersonatedRequest, userID, details)
+}
+
+func (s *adminService) GetRoles(ctx context.Context) ([]permissionsmodels.Role, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetRoles")
+	defer span.End()
+
+	return s.permissionsService.GetRoles(ctx)
+}
+
+func (s *adminService) GetRole(ctx context.Context, name string) (permissionsmodels.Role, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetRole")
+	defer span.End()
+
+	return s.permissionsService.GetRole(ctx, name)
+}
+
+func (s *adminService) AddRole(ctx context.Context, actor models.Actor, role permissionsmodels.Role) (permissionsmodels.Role, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.AddRole")
+	defer span.End()
+
+	role, err := s.permissionsService.AddRole(ctx, role)
+	if err != nil {
+		return permissionsmodels.Role{}, err
+	}
+
+	err = s.audit(ctx, actor, models.ActionCreateRole, 0, map[string]any{
+		"role":        role.Name,
+		"permissions": role.Permissions,
+	})
+	if err != nil {
+		return permissionsmodels.Role{}, err
+	}
+
+	return role, nil
+}
+
+func (s *adminService) UpdateRole(ctx context.Context, actor models.Actor, role permissionsmodels.Role) (permissionsmodels.Role, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.UpdateRole")
+	defer span.End()
+
+	role, err := s.permissionsService.UpdateRole(ctx, role)
+	if err != nil {
+		return permissionsmodels.Role{}, err
+	}
+
+	err = s.audit(ctx, actor, models.ActionUpdateRole, 0, map[string]any{
+		"role":        role.Name,
+		"permissions": role.Permissions,
+	})
+	if err != nil {
+		return permissionsmodels.Role{}, err
+	}
+
+	return role, nil
+}
+
+func (s *adminService) DeleteRole(ctx context.Context, actor models.Actor, name string) error {
+	ctx, span := tracing.Start(ctx, "AdminService.DeleteRole")
+	defer span.End()
+
+	err := s.permissionsService.DeleteRole(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	return s.audit(ctx, actor, models.ActionDeleteRole, 0, map[string]any{"role": name})
+}
+
+func (s *adminService) GetUserRoles(ctx context.Context, actor models.Actor, id int64) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetUserRoles")
+	defer span.End()
+
+	_, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.audit(ctx, actor, models.ActionViewUserRoles, id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.permissionsService.GetRolesForUser(ctx, id)
+}
+
+// SetUserRole assigns or unassigns a role. Admins cannot change their own roles,
+// so the last admin cannot lock everyone out by accident.
+func (s *adminService) SetUserRole(ctx context.Context, actor models.Actor, id int64, name string, assigned bool) error {
+	ctx, span := tracing.Start(ctx, "AdminService.SetUserRole")
+	defer span.End()
+
+	if id == actor.UserID {
+		return serviceerrors.ErrSelfAction
+	}
+
+	_, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	action := models.ActionUnassignRole
+	if assigned {
+		action = models.ActionAssignRole
+		err = s.permissionsService.AssignRole(ctx, id, name)
+	} else {
+		err = s.permissionsService.UnassignRole(ctx, id, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.audit(ctx, actor, action, id, map[string]any{"role": name})
+}
+
+func (s *adminService) GetAuditLog(ctx context.Context, targetUserID int64,
+	filters commonmodels.Filters,
+) ([]models.AuditEntry, commonmodels.Metadata, error) {
+	ctx, span := tracing.Start(ctx, "AdminService.GetAuditLog")
+	defer span.End()
+
+	return s.repo.GetAuditLog(ctx, targetUserID, filters)
+}
+
+func (s *adminService) getUser(ctx context.Context, id int64) (usersmodels.User, error) {
+	user, err := s.repo.GetUser(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrUserNotFound):
+			return usersmodels.User{}, serviceerrors.ErrUserNotFound
+		default:
+			return usersmodels.User{}, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *adminService) GetLogLevel() jsonlog.Level {
+	return s.logger.Level()
+}
+
+// SetLogLevel changes the level of every logger of the application, it lasts
+// until the next restart
+func (s *adminService) SetLogLevel(ctx context.Context, actor models.Actor, level jsonlog.Level) error {
+	ctx, span := tracing.Start(ctx, "AdminService.SetLogLevel")
+	defer span.End()
+
+	err := s.audit(ctx, actor, models.ActionSetLogLevel, 0, map[string]any{
+		"from": s.logger.Level().String(),
+		"to":   level.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger.SetLevel(level)
+	return nil
+}
+
+// audit records an admin action. It is part of the action, so a failure to
+// write the entry fails the request.
+func (s *adminService) audit(ctx context.Context, actor models.Actor, action string,
+	targetUserID int64, details map[string]any,
+) error {
+	entry := models.AuditEntry{
+		ActorID: &actor.UserID,
+		Action:  action,
+		IP:      actor.IP,
+	}
+
+	if targetUserID != 0 {
+		entry.TargetUserID = &targetUserID
+	}
+
+	if details != nil {
+		js, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		entry.Details = js
+	}
+
+	return s.repo.InsertAuditEntry(ctx, entry)
+}
@@ -0,0 +1,10 @@
+package serviceerrors
+
+import "errors"
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrSelfAction        = errors.New("admins cannot perform this action on themselves")
+	ErrUserDisabled      = errors.New("user is disabled")
+	ErrCannotImpersonate = errors.New("users holding admin permissions cannot be impersonated")
+)
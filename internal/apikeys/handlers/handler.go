@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"greenlight/internal/apikeys/models"
+	"greenlight/internal/apikeys/serviceerrors"
+	usersmodels "greenlight/internal/users/models"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	Logger        *jsonlog.Logger
+	Version       string
+	Env           string
+	APIKeyService APIKeyService
+}
+
+type APIKeyService interface {
+	AddAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error)
+	GetAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id int64) error
+}
+
+type createAPIKeyInput struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+func (h *Handler) CreateAPIKey() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, ok := h.keyOwner(c)
+		if !ok {
+			return
+		}
+
+		var input createAPIKeyInput
+		err := httphelpers.ReadJSON(c, &input)
+		if err != nil {
+			httphelpers.StatusBadRequestResponse(c, err.Error())
+			return
+		}
+
+		key, err := models.GenerateAPIKey(user.ID, input.Name, input.Permissions)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		v := validator.New()
+		if models.ValidateAPIKey(v, key); !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		key, err = h.APIKeyService.AddAPIKey(c, key)
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrDuplicateName):
+				v.AddError("name", err.Error())
+				httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			case errors.Is(err, serviceerrors.ErrPermissionNotHeld):
+				v.AddError("permissions", err.Error())
+				httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		headers := make(http.Header)
+		headers.Set("Location", fmt.Sprintf("/v1/api-keys/%d", key.ID))
+
+		err = httphelpers.WriteResponse(c, http.StatusCreated, gin.H{"api_key": key}, headers)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) ListAPIKeys() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, ok := h.keyOwner(c)
+		if !ok {
+			return
+		}
+
+		keys, err := h.APIKeyService.GetAPIKeys(c, user.ID)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		if len(keys) == 0 {
+			keys = []models.APIKey{}
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"api_keys": keys}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) RevokeAPIKey() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, ok := h.keyOwner(c)
+		if !ok {
+			return
+		}
+
+		id, err := httphelpers.ReadIDParam(c)
+		if err != nil {
+			httphelpers.StatusNotFoundResponse(c)
+			return
+		}
+
+		err = h.APIKeyService.RevokeAPIKey(c, user.ID, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrAPIKeyNotFound):
+				httphelpers.StatusNotFoundResponse(c)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"message": "api key successfully revoked"}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+// keyOwner returns the authenticated user. Keys can only be managed with a login
+// token, otherwise a restricted key could mint a broader one.
+func (h *Handler) keyOwner(c *gin.Context) (usersmodels.User, bool) {
+	user, err := httphelpers.ContextGetUser(c)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return usersmodels.User{}, false
+	}
+
+	if user.IsAnonymous() {
+		httphelpers.StatusUnauthorizedResponse(c)
+		return usersmodels.User{}, false
+	}
+
+	if _, viaKey := httphelpers.ContextGetAPIKeyID(c); viaKey {
+		httphelpers.ProblemResponse(c, httphelpers.CodeForbidden, "api keys cannot manage api keys")
+		return usersmodels.User{}, false
+	}
+
+	return user, true
+}
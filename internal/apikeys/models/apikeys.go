@@ -0,0 +1,68 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"greenlight/pkg/validator"
+
+	"github.com/lib/pq"
+)
+
+// KeyPrefix marks greenlight API keys so they are easy to spot in logs and secret scanners
+const KeyPrefix = "gl_"
+
+type APIKey struct {
+	ID          int64          `json:"id" db:"id"`
+	CreatedAt   time.Time      `json:"created_at" db:"created_at"`
+	UserID      int64          `json:"-" db:"user_id"`
+	Name        string         `json:"name" db:"name"`
+	Prefix      string         `json:"prefix" db:"prefix"`
+	Hash        []byte         `json:"-" db:"hash"`
+	Permissions pq.StringArray `json:"permissions" db:"permissions"`
+	UsageCount  int64          `json:"usage_count" db:"usage_count"`
+	LastUsedAt  *time.Time     `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt   *time.Time     `json:"revoked_at,omitempty" db:"revoked_at"`
+	// Plaintext is only set right after creation, it is never stored
+	Plaintext string `json:"key,omitempty" db:"-"`
+}
+
+func GenerateAPIKey(userID int64, name string, permissions []string) (APIKey, error) {
+	randomBytes := make([]byte, 20)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	plaintext := KeyPrefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+
+	return APIKey{
+		UserID:      userID,
+		Name:        name,
+		Prefix:      plaintext[:len(KeyPrefix)+8],
+		Hash:        HashAPIKey(plaintext),
+		Permissions: permissions,
+		Plaintext:   plaintext,
+	}, nil
+}
+
+func HashAPIKey(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+func ValidateAPIKeyPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(strings.HasPrefix(plaintext, KeyPrefix), "key", "must be a greenlight API key")
+	v.Check(len(plaintext) == len(KeyPrefix)+32, "key", "must be 35 bytes long")
+}
+
+func ValidateAPIKey(v *validator.Validator, key APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(key.Permissions) >= 1, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+}
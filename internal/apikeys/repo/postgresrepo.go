@@ -0,0 +1,137 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"greenlight/internal/apikeys/models"
+	"greenlight/internal/apikeys/repoerrors"
+	usersmodels "greenlight/internal/users/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type apiKeyRepo struct {
+	DB *sqlx.DB
+}
+
+func NewAPIKeyRepo(db *sqlx.DB) *apiKeyRepo {
+	return &apiKeyRepo{
+		DB: db,
+	}
+}
+
+func (r apiKeyRepo) Insert(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	query := `
+        INSERT INTO api_keys (user_id, name, prefix, hash, permissions)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, created_at`
+
+	args := []any{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array(key.Permissions)}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.DB.GetContext(ctx, &key, query, args...)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `unique constraint "api_keys_user_id_name_key"`):
+			return models.APIKey{}, repoerrors.ErrDuplicateName
+		case strings.Contains(err.Error(), `foreign key constraint "api_keys_user_id_fkey"`):
+			return models.APIKey{}, repoerrors.ErrUserNotFound
+		default:
+			return models.APIKey{}, err
+		}
+	}
+
+	return key, nil
+}
+
+func (r apiKeyRepo) GetAllForUser(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	query := `
+        SELECT id, created_at, user_id, name, prefix, hash, permissions, usage_count, last_used_at, revoked_at
+        FROM api_keys
+        WHERE user_id = $1
+        ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var keys []models.APIKey
+
+	err := r.DB.SelectContext(ctx, &keys, query, userID)
+	if err != nil {
+		return keys, err
+	}
+
+	return keys, nil
+}
+
+func (r apiKeyRepo) Revoke(ctx context.Context, userID, id int64) error {
+	query := `
+        UPDATE api_keys
+        SET revoked_at = NOW()
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repoerrors.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// Use looks up an active key of an enabled user by its hash and counts the use
+// in the same round trip. Keys of disabled users are not counted.
+func (r apiKeyRepo) Use(ctx context.Context, hash []byte) (models.APIKey, usersmodels.User, error) {
+	query := `
+        UPDATE api_keys
+        SET usage_count = api_keys.usage_count + 1, last_used_at = NOW()
+        FROM users AS u
+        WHERE api_keys.hash = $1 AND api_keys.revoked_at IS NULL
+            AND u.id = api_keys.user_id AND u.disabled_at IS NULL
+        RETURNING api_keys.id AS key_id, api_keys.permissions,
+            u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.version`
+
+	var row struct {
+		KeyID       int64          `db:"key_id"`
+		Permissions pq.StringArray `db:"permissions"`
+		usersmodels.User
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.DB.GetContext(ctx, &row, query, hash)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.APIKey{}, usersmodels.User{}, repoerrors.ErrAPIKeyNotFound
+		default:
+			return models.APIKey{}, usersmodels.User{}, err
+		}
+	}
+
+	key := models.APIKey{
+		ID:          row.KeyID,
+		UserID:      row.User.ID,
+		Permissions: row.Permissions,
+	}
+
+	return key, row.User, nil
+}
@@ -0,0 +1,11 @@
+package repoerrors
+
+import (
+	"errors"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrDuplicateName  = errors.New("duplicate api key name")
+	ErrUserNotFound   = errors.New("user not found")
+)
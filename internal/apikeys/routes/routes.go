@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"greenlight/internal/apikeys/handlers"
+	"greenlight/pkg/authz"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	CreateAPIKey() func(c *gin.Context)
+	ListAPIKeys() func(c *gin.Context)
+	RevokeAPIKey() func(c *gin.Context)
+}
+
+func MakeRoutes(engine *authz.Group, handler *handlers.Handler) {
+	apiKeys := engine.Group("api-keys")
+	{
+		apiKeys.GET("", authz.Activated(), handler.ListAPIKeys())
+		apiKeys.POST("", authz.Activated().OwnerOnly(), handler.CreateAPIKey())
+		apiKeys.DELETE("/:id", authz.Activated().OwnerOnly(), handler.RevokeAPIKey())
+	}
+}
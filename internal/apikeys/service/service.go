@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"greenlight/internal/apikeys/models"
+	"greenlight/internal/apikeys/repoerrors"
+	"greenlight/internal/apikeys/serviceerrors"
+	permissionsmodels "greenlight/internal/permissions/models"
+	usersmodels "greenlight/internal/users/models"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/tracing"
+)
+
+type apiKeyService struct {
+	repo               APIKeyRepo
+	permissionsService PermissionsService
+	logger             *jsonlog.Logger
+}
+
+type APIKeyRepo interface {
+	Insert(ctx context.Context, key models.APIKey) (models.APIKey, error)
+	GetAllForUser(ctx context.Context, userID int64) ([]models.APIKey, error)
+	Revoke(ctx context.Context, userID, id int64) error
+	Use(ctx context.Context, hash []byte) (models.APIKey, usersmodels.User, error)
+}
+
+type PermissionsService interface {
+	GetAllForUser(ctx context.Context, userID int64) (permissionsmodels.Permissions, error)
+}
+
+func NewAPIKeyService(repo APIKeyRepo, permissionsService PermissionsService, logger *jsonlog.Logger) *apiKeyService {
+	return &apiKeyService{
+		repo:               repo,
+		permissionsService: permissionsService,
+		logger:             logger,
+	}
+}
+
+func (s *apiKeyService) AddAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "ApiKeyService.AddAPIKey")
+	defer span.End()
+
+	held, err := s.permissionsService.GetAllForUser(ctx, key.UserID)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	for _, code := range key.Permissions {
+		if !held.Include(code) {
+			return models.APIKey{}, serviceerrors.ErrPermissionNotHeld
+		}
+	}
+
+	key, err = s.repo.Insert(ctx, key)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrDuplicateName):
+			return models.APIKey{}, serviceerrors.ErrDuplicateName
+		default:
+			return models.APIKey{}, err
+		}
+	}
+
+	return key, nil
+}
+
+func (s *apiKeyService) GetAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "ApiKeyService.GetAPIKeys")
+	defer span.End()
+
+	return s.repo.GetAllForUser(ctx, userID)
+}
+
+func (s *apiKeyService) RevokeAPIKey(ctx context.Context, userID, id int64) error {
+	ctx, span := tracing.Start(ctx, "ApiKeyService.RevokeAPIKey")
+	defer span.End()
+
+	err := s.repo.Revoke(ctx, userID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrAPIKeyNotFound):
+			return serviceerrors.ErrAPIKeyNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VerifyAPIKey returns the key owner and the permissions the key grants. Those are
+// the key's codes still held by the user, so revoking a user permission also
+// takes it away from the user's keys.
+func (s *apiKeyService) VerifyAPIKey(ctx context.Context, plaintext string,
+) (int64, usersmodels.User, permissionsmodels.Permissions, error) {
+	ctx, span := tracing.Start(ctx, "ApiKeyService.VerifyAPIKey")
+	defer span.End()
+
+	key, user, err := s.repo.Use(ctx, models.HashAPIKey(plaintext))
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrAPIKeyNotFound):
+			return 0, usersmodels.User{}, nil, serviceerrors.ErrInvalidAPIKey
+		default:
+			return 0, usersmodels.User{}, nil, err
+		}
+	}
+
+	held, err := s.permissionsService.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return 0, usersmodels.User{}, nil, err
+	}
+
+	permissions := permissionsmodels.Permissions{}
+	for _, code := range key.Permissions {
+		if held.Include(code) {
+			permissions = append(permissions, code)
+		}
+	}
+
+	return key.ID, user, permissions, nil
+}
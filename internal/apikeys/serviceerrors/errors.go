@@ -0,0 +1,10 @@
+package serviceerrors
+
+import "errors"
+
+var (
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrDuplicateName     = errors.New("an api key with this name already exists")
+	ErrPermissionNotHeld = errors.New("api keys can only carry permissions the user holds")
+	ErrInvalidAPIKey     = errors.New("invalid api key")
+)
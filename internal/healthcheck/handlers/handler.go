@@ -57,7 +57,7 @@ func (h *Handler) Healthcheck() func(c *gin.Context) {
 		if !ok {
 			status = http.StatusBadRequest
 		}
-		err := httphelpers.WriteJSON(c, status, data, nil)
+		err := httphelpers.WriteResponse(c, status, data, nil)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 		}
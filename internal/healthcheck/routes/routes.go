@@ -2,6 +2,7 @@ package routes
 
 import (
 	"greenlight/internal/healthcheck/handlers"
+	"greenlight/pkg/authz"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,6 +11,6 @@ type Handler interface {
 	Healthcheck(c *gin.Context)
 }
 
-func MakeRoutes(engine *gin.RouterGroup, handler *handlers.Handler) {
-	engine.GET("healthcheck", handler.Healthcheck())
+func MakeRoutes(engine *authz.Group, handler *handlers.Handler) {
+	engine.GET("healthcheck", authz.Public(), handler.Healthcheck())
 }
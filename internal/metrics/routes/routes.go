@@ -3,14 +3,27 @@ package routes
 import (
 	"expvar"
 
+	"greenlight/pkg/authz"
+	"greenlight/pkg/metrics"
+
 	"github.com/gin-gonic/gin"
 )
 
+// MetricsPermission is the code required to read metrics on the public listener
+const MetricsPermission = "metrics:read"
+
 type Handler interface{}
 
-func MakeRoutes(engine *gin.RouterGroup) {
-	metrics := engine.Group("debug/vars")
+// MakeRoutes serves the OpenMetrics endpoint at /metrics and the expvar
+// variables at /v1/debug/vars. Use it when metrics are not served on a separate
+// listener.
+func MakeRoutes(root, v1 *authz.Group, registry *metrics.Registry) {
+	requireMetrics := authz.Permission(MetricsPermission)
+
+	root.GET("metrics", requireMetrics, gin.WrapH(registry.Handler()))
+
+	debug := v1.Group("debug/vars")
 	{
-		metrics.GET("", gin.WrapH(expvar.Handler()))
+		debug.GET("", requireMetrics, gin.WrapH(expvar.Handler()))
 	}
 }
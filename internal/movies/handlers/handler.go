@@ -11,7 +11,9 @@ import (
 
 	commonmodels "greenlight/internal/models"
 	"greenlight/internal/movies/models"
+	"greenlight/internal/movies/policy"
 	"greenlight/internal/movies/serviceerrors"
+	orgmodels "greenlight/internal/organizations/models"
 	"greenlight/pkg/httphelpers"
 	"greenlight/pkg/jsonlog"
 	"greenlight/pkg/validator"
@@ -42,11 +44,11 @@ type updateMovieInput struct {
 }
 
 type MovieService interface {
-	AddMovie(ctx context.Context, movie models.Movie) (models.Movie, error)
-	GetMovie(ctx context.Context, id int64) (models.Movie, error)
-	GetMovies(ctx context.Context, title string, genres []string, filters commonmodels.Filters) ([]models.Movie, commonmodels.Metadata, error)
-	UpdateMovie(ctx context.Context, movie models.Movie) (models.Movie, error)
-	DeleteMovie(ctx context.Context, id int64) error
+	AddMovie(ctx context.Context, scope orgmodels.Scope, movie models.Movie) (models.Movie, error)
+	GetMovie(ctx context.Context, scope orgmodels.Scope, id int64) (models.Movie, error)
+	GetMovies(ctx context.Context, scope orgmodels.Scope, title string, genres []string, filters commonmodels.Filters) ([]models.Movie, commonmodels.Metadata, error)
+	UpdateMovie(ctx context.Context, scope orgmodels.Scope, actor policy.Actor, movie models.Movie) (models.Movie, error)
+	DeleteMovie(ctx context.Context, scope orgmodels.Scope, actor policy.Actor, id int64) error
 }
 
 func New(logger *jsonlog.Logger, version, env string) *Handler {
@@ -59,6 +61,11 @@ func New(logger *jsonlog.Logger, version, env string) *Handler {
 
 func (h *Handler) CreateMovie() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		scope, actor, ok := h.actor(c)
+		if !ok {
+			return
+		}
+
 		var input createMovieInput
 
 		err := httphelpers.ReadJSON(c, &input)
@@ -68,10 +75,11 @@ func (h *Handler) CreateMovie() func(c *gin.Context) {
 		}
 
 		movie := models.Movie{
-			Title:   input.Title,
-			Year:    input.Year,
-			Runtime: input.Runtime,
-			Genres:  input.Genres,
+			Title:     input.Title,
+			Year:      input.Year,
+			Runtime:   input.Runtime,
+			Genres:    input.Genres,
+			CreatedBy: &actor.UserID,
 		}
 
 		v := validator.New()
@@ -82,7 +90,7 @@ func (h *Handler) CreateMovie() func(c *gin.Context) {
 		}
 
 		ctx := c.Request.Context()
-		movie, err = h.MovieService.AddMovie(ctx, movie)
+		movie, err = h.MovieService.AddMovie(ctx, scope, movie)
 		if err != nil {
 			switch {
 			case errors.Is(err, serviceerrors.ErrMovieTitleRequired):
@@ -98,7 +106,7 @@ func (h *Handler) CreateMovie() func(c *gin.Context) {
 		headers := make(http.Header)
 		headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
 
-		err = httphelpers.WriteJSON(c, http.StatusCreated, map[string]any{"movie": movie}, headers)
+		err = httphelpers.WriteResponse(c, http.StatusCreated, map[string]any{"movie": movie}, headers)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 		}
@@ -123,6 +131,11 @@ func fieldsAreValid(c *gin.Context, v *validator.Validator, movie models.Movie)
 
 func (h *Handler) ShowMovie() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		scope, ok := h.scope(c)
+		if !ok {
+			return
+		}
+
 		id, err := httphelpers.ReadIDParam(c)
 		if err != nil {
 			httphelpers.StatusNotFoundResponse(c)
@@ -130,7 +143,7 @@ func (h *Handler) ShowMovie() func(c *gin.Context) {
 		}
 
 		ctx := c.Request.Context()
-		movie, err := h.MovieService.GetMovie(ctx, id)
+		movie, err := h.MovieService.GetMovie(ctx, scope, id)
 		if err != nil {
 			switch {
 			case errors.Is(err, serviceerrors.ErrNoMovieFound):
@@ -141,7 +154,7 @@ func (h *Handler) ShowMovie() func(c *gin.Context) {
 			return
 		}
 
-		err = httphelpers.WriteJSON(c, http.StatusOK, gin.H{"movie": movie}, nil)
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"movie": movie}, nil)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 		}
@@ -150,6 +163,11 @@ func (h *Handler) ShowMovie() func(c *gin.Context) {
 
 func (h *Handler) UpdateMovie() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		scope, actor, ok := h.actor(c)
+		if !ok {
+			return
+		}
+
 		id, err := httphelpers.ReadIDParam(c)
 		if err != nil {
 			httphelpers.StatusNotFoundResponse(c)
@@ -157,7 +175,7 @@ func (h *Handler) UpdateMovie() func(c *gin.Context) {
 		}
 
 		ctx := c.Request.Context()
-		movie, err := h.MovieService.GetMovie(ctx, id)
+		movie, err := h.MovieService.GetMovie(ctx, scope, id)
 		if err != nil {
 			switch {
 			case errors.Is(err, serviceerrors.ErrNoMovieFound):
@@ -188,9 +206,12 @@ func (h *Handler) UpdateMovie() func(c *gin.Context) {
 			return
 		}
 
-		movie, err = h.MovieService.UpdateMovie(ctx, movie)
+		movie, err = h.MovieService.UpdateMovie(ctx, scope, actor, movie)
 		if err != nil {
+			var denial *policy.Denial
 			switch {
+			case errors.As(err, &denial):
+				httphelpers.ProblemResponse(c, httphelpers.CodeForbidden, denial.Reason)
 			case errors.Is(err, serviceerrors.ErrEditConflict):
 				httphelpers.StatusConflictResponse(c)
 			default:
@@ -200,7 +221,7 @@ func (h *Handler) UpdateMovie() func(c *gin.Context) {
 			return
 		}
 
-		err = httphelpers.WriteJSON(c, http.StatusOK, gin.H{"movie": movie}, nil)
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"movie": movie}, nil)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 		}
@@ -227,6 +248,11 @@ func validateInputs(oldMovie models.Movie, newMovie updateMovieInput) {
 
 func (h *Handler) DeleteMovie() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		scope, actor, ok := h.actor(c)
+		if !ok {
+			return
+		}
+
 		id, err := httphelpers.ReadIDParam(c)
 		if err != nil {
 			httphelpers.StatusNotFoundResponse(c)
@@ -234,9 +260,12 @@ func (h *Handler) DeleteMovie() func(c *gin.Context) {
 		}
 
 		ctx := c.Request.Context()
-		err = h.MovieService.DeleteMovie(ctx, id)
+		err = h.MovieService.DeleteMovie(ctx, scope, actor, id)
 		if err != nil {
+			var denial *policy.Denial
 			switch {
+			case errors.As(err, &denial):
+				httphelpers.ProblemResponse(c, httphelpers.CodeForbidden, denial.Reason)
 			case errors.Is(err, serviceerrors.ErrNoMovieFound):
 				httphelpers.StatusNotFoundResponse(c)
 			default:
@@ -245,7 +274,7 @@ func (h *Handler) DeleteMovie() func(c *gin.Context) {
 			return
 		}
 
-		err = httphelpers.WriteJSON(c, http.StatusOK, gin.H{"message": "movie succesfully deleted"}, nil)
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"message": "movie succesfully deleted"}, nil)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 		}
@@ -254,6 +283,11 @@ func (h *Handler) DeleteMovie() func(c *gin.Context) {
 
 func (h *Handler) ListMovies() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		scope, ok := h.scope(c)
+		if !ok {
+			return
+		}
+
 		var input struct {
 			Title  string
 			Genres []string
@@ -278,11 +312,11 @@ func (h *Handler) ListMovies() func(c *gin.Context) {
 		input.Filters.Sort = query.Query
 
 		if commonmodels.ValidateFilters(v, input.Filters); !v.Valid() {
-			httphelpers.StatusBadRequestJSONPayloadResponse(c, v.Errors)
+			httphelpers.StatusBadRequestErrorsResponse(c, v.Errors)
 			return
 		}
 
-		movies, metadata, err := h.MovieService.GetMovies(c.Request.Context(), input.Title, input.Genres, input.Filters)
+		movies, metadata, err := h.MovieService.GetMovies(c.Request.Context(), scope, input.Title, input.Genres, input.Filters)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 			return
@@ -292,10 +326,41 @@ func (h *Handler) ListMovies() func(c *gin.Context) {
 			movies = []models.Movie{}
 		}
 
-		err = httphelpers.WriteJSON(c, http.StatusOK, gin.H{"movies": movies, "metadata": metadata}, nil)
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"movies": movies, "metadata": metadata}, nil)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 			return
 		}
 	}
 }
+
+// actor returns the organization scope, the authenticated user and the
+// permissions the authorization middleware resolved for the request
+func (h *Handler) actor(c *gin.Context) (orgmodels.Scope, policy.Actor, bool) {
+	scope, ok := h.scope(c)
+	if !ok {
+		return orgmodels.Scope{}, policy.Actor{}, false
+	}
+
+	user, err := httphelpers.ContextGetUser(c)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return orgmodels.Scope{}, policy.Actor{}, false
+	}
+
+	permissions, _ := httphelpers.ContextGetPermissions(c)
+
+	return scope, policy.Actor{UserID: user.ID, Permissions: permissions}, true
+}
+
+// scope returns the organization the request acts on. The movie routes run
+// behind the ActiveOrganization middleware, so a missing scope is a wiring bug.
+func (h *Handler) scope(c *gin.Context) (orgmodels.Scope, bool) {
+	scope, err := httphelpers.ContextGetScope(c)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return orgmodels.Scope{}, false
+	}
+
+	return scope, true
+}
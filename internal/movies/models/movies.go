@@ -15,5 +15,6 @@ type Movie struct {
 	Year      int32          `json:"year" db:"year"`
 	Runtime   models.Runtime `json:"runtime" db:"runtime"`
 	Genres    pq.StringArray `json:"genres" db:"genres"`
+	CreatedBy *int64         `json:"created_by,omitempty" db:"created_by"`
 	Version   int32          `json:"version" db:"version"`
 }
@@ -0,0 +1,44 @@
+// Package policy decides who may change a movie once it exists
+package policy
+
+import (
+	"greenlight/internal/movies/models"
+	permissionsmodels "greenlight/internal/permissions/models"
+)
+
+// PermissionWriteAny lets a user change movies created by anyone
+const PermissionWriteAny = "movies:write:any"
+
+// Actor is the user asking to change a movie
+type Actor struct {
+	UserID      int64
+	Permissions permissionsmodels.Permissions
+}
+
+// Denial is returned when the policy refuses an action, Reason is safe to show
+// to the client
+type Denial struct {
+	Reason string
+}
+
+func (d *Denial) Error() string {
+	return "permission denied: " + d.Reason
+}
+
+// CanModify allows the creator of a movie, or holders of PermissionWriteAny, to
+// update or delete it
+func CanModify(actor Actor, movie models.Movie) error {
+	if actor.Permissions.Include(PermissionWriteAny) {
+		return nil
+	}
+
+	if movie.CreatedBy == nil {
+		return &Denial{Reason: "this movie has no owner, changing it requires the " + PermissionWriteAny + " permission"}
+	}
+
+	if *movie.CreatedBy != actor.UserID {
+		return &Denial{Reason: "only the user who created this movie can change it"}
+	}
+
+	return nil
+}
@@ -12,4 +12,5 @@ var (
 	ErrMovieYearRequired         = errors.New("movie year required")
 	ErrInvalidId                 = errors.New("invalid id")
 	ErrUserPermissionsForeignKey = errors.New("user permissions foreign key")
+	ErrMissingScope              = errors.New("missing organization scope")
 )
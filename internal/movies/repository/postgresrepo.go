@@ -11,12 +11,16 @@ import (
 	commonmodels "greenlight/internal/models"
 	"greenlight/internal/movies/models"
 	"greenlight/internal/movies/repoerrors"
+	orgmodels "greenlight/internal/organizations/models"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"golang.org/x/sync/errgroup"
 )
 
+// movieRepo only runs queries inside an organization scope. Every query filters
+// on org_id, so a movie of another organization is indistinguishable from a
+// missing one.
 type movieRepo struct {
 	DB *sqlx.DB
 }
@@ -27,10 +31,14 @@ func NewMovieRepo(db *sqlx.DB) *movieRepo {
 	}
 }
 
-func (r movieRepo) Insert(ctx context.Context, movie models.Movie,
+func (r movieRepo) Insert(ctx context.Context, scope orgmodels.Scope, movie models.Movie,
 ) (models.Movie, error) {
-	query := `INSERT INTO movies (title, year, runtime, genres)
-			  VALUES ($1, $2, $3, $4)
+	if scope.IsZero() {
+		return models.Movie{}, repoerrors.ErrMissingScope
+	}
+
+	query := `INSERT INTO movies (title, year, runtime, genres, created_by, org_id)
+			  VALUES ($1, $2, $3, $4, $5, $6)
 			  RETURNING id, created_at, version`
 
 	args := []any{
@@ -38,6 +46,8 @@ func (r movieRepo) Insert(ctx context.Context, movie models.Movie,
 		movie.Year,
 		movie.Runtime,
 		pq.Array(movie.Genres),
+		movie.CreatedBy,
+		scope.OrgID(),
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
@@ -56,22 +66,26 @@ func (r movieRepo) Insert(ctx context.Context, movie models.Movie,
 	return movie, nil
 }
 
-func (r movieRepo) Get(ctx context.Context, id int64) (models.Movie, error) {
+func (r movieRepo) Get(ctx context.Context, scope orgmodels.Scope, id int64) (models.Movie, error) {
+	if scope.IsZero() {
+		return models.Movie{}, repoerrors.ErrMissingScope
+	}
+
 	if id < 1 {
 		return models.Movie{}, repoerrors.ErrMovieNoFound
 	}
 
 	query := `
-        SELECT id, created_at, title, year, runtime, genres, version
+        SELECT id, created_at, title, year, runtime, genres, created_by, version
         FROM movies
-        WHERE id = $1`
+        WHERE id = $1 AND org_id = $2`
 
 	var movie models.Movie
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := r.DB.GetContext(ctx, &movie, query, id)
+	err := r.DB.GetContext(ctx, &movie, query, id, scope.OrgID())
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -84,9 +98,13 @@ func (r movieRepo) Get(ctx context.Context, id int64) (models.Movie, error) {
 	return movie, nil
 }
 
-func (r movieRepo) GetAll(ctx context.Context, title string,
+func (r movieRepo) GetAll(ctx context.Context, scope orgmodels.Scope, title string,
 	genres []string, filters commonmodels.Filters,
 ) ([]models.Movie, commonmodels.Metadata, error) {
+	if scope.IsZero() {
+		return nil, commonmodels.Metadata{}, repoerrors.ErrMissingScope
+	}
+
 	var (
 		movies   []models.Movie
 		metadata commonmodels.Metadata
@@ -95,7 +113,7 @@ func (r movieRepo) GetAll(ctx context.Context, title string,
 
 	eg.Go(func() error {
 		var err error
-		movies, err = r.getAllMovies(ctx, title, genres, filters)
+		movies, err = r.getAllMovies(ctx, scope, title, genres, filters)
 		if err != nil {
 			return err
 		}
@@ -104,7 +122,7 @@ func (r movieRepo) GetAll(ctx context.Context, title string,
 
 	eg.Go(func() error {
 		var err error
-		metadata, err = r.getMetadata(ctx, filters)
+		metadata, err = r.getMetadata(ctx, scope, title, genres, filters)
 		if err != nil {
 			return err
 		}
@@ -118,7 +136,7 @@ func (r movieRepo) GetAll(ctx context.Context, title string,
 	return movies, metadata, nil
 }
 
-func (r movieRepo) getAllMovies(ctx context.Context,
+func (r movieRepo) getAllMovies(ctx context.Context, scope orgmodels.Scope,
 	title string, genres []string, filters commonmodels.Filters,
 ) ([]models.Movie, error) {
 	column, err := filters.SortColumn()
@@ -126,9 +144,10 @@ func (r movieRepo) getAllMovies(ctx context.Context,
 		return []models.Movie{}, err
 	}
 	moviesQuery := fmt.Sprintf(`
-		SELECT id, created_at, title, year, runtime, genres, version
+		SELECT id, created_at, title, year, runtime, genres, created_by, version
 		FROM movies
-		WHERE (
+		WHERE org_id = $5
+		AND (
 			to_tsvector('simple', title) @@ plainto_tsquery('simple', $1)
 			OR 
 			$1 = ''
@@ -152,6 +171,7 @@ func (r movieRepo) getAllMovies(ctx context.Context,
 		pq.StringArray(genres),
 		filters.Limit(),
 		filters.Offset(),
+		scope.OrgID(),
 	)
 	if err != nil {
 		return movies, err
@@ -160,17 +180,26 @@ func (r movieRepo) getAllMovies(ctx context.Context,
 	return movies, nil
 }
 
-func (r movieRepo) getMetadata(ctx context.Context,
-	filters commonmodels.Filters,
+func (r movieRepo) getMetadata(ctx context.Context, scope orgmodels.Scope,
+	title string, genres []string, filters commonmodels.Filters,
 ) (commonmodels.Metadata, error) {
-	metadataQuery := `SELECT count(*)`
+	metadataQuery := `
+		SELECT count(*)
+		FROM movies
+		WHERE org_id = $3
+		AND (
+			to_tsvector('simple', title) @@ plainto_tsquery('simple', $1)
+			OR 
+			$1 = ''
+		) 
+		AND (genres @> $2 OR $2 = '{}')`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	var totalRecords int
 
-	err := r.DB.GetContext(ctx, &totalRecords, metadataQuery)
+	err := r.DB.GetContext(ctx, &totalRecords, metadataQuery, title, pq.StringArray(genres), scope.OrgID())
 	if err != nil {
 		return commonmodels.Metadata{}, err
 	}
@@ -180,12 +209,16 @@ func (r movieRepo) getMetadata(ctx context.Context,
 	return metadata, nil
 }
 
-func (r movieRepo) Update(ctx context.Context, movie models.Movie,
+func (r movieRepo) Update(ctx context.Context, scope orgmodels.Scope, movie models.Movie,
 ) (models.Movie, error) {
+	if scope.IsZero() {
+		return models.Movie{}, repoerrors.ErrMissingScope
+	}
+
 	query := `
         UPDATE movies 
         SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        WHERE id = $5 AND version = $6 AND org_id = $7
         RETURNING version`
 
 	args := []any{
@@ -195,6 +228,7 @@ func (r movieRepo) Update(ctx context.Context, movie models.Movie,
 		pq.Array(movie.Genres),
 		movie.ID,
 		movie.Version,
+		scope.OrgID(),
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
@@ -217,19 +251,23 @@ func (r movieRepo) Update(ctx context.Context, movie models.Movie,
 	return movie, nil
 }
 
-func (r movieRepo) Delete(ctx context.Context, id int64) error {
+func (r movieRepo) Delete(ctx context.Context, scope orgmodels.Scope, id int64) error {
+	if scope.IsZero() {
+		return repoerrors.ErrMissingScope
+	}
+
 	if id < 1 {
 		return repoerrors.ErrInvalidId
 	}
 
 	query := `
 		DELETE FROM movies
-		WHERE id = $1`
+		WHERE id = $1 AND org_id = $2`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	result, err := r.DB.ExecContext(ctx, query, id)
+	result, err := r.DB.ExecContext(ctx, query, id, scope.OrgID())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,262 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	commonmodels "greenlight/internal/models"
+	"greenlight/internal/movies/models"
+	"greenlight/internal/movies/repoerrors"
+	orgmodels "greenlight/internal/organizations/models"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// The cross-tenant tests need a migrated database, e.g. the one make
+// db/migrations/up prepares. They create their own organizations and delete
+// them, with their movies, when done.
+const testDSNEnv = "GREENLIGHT_TEST_DB_DSN"
+
+type tenant struct {
+	scope  orgmodels.Scope
+	movies []models.Movie
+}
+
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	db, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = db.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// newTenant creates an organization holding titles
+func newTenant(t *testing.T, db *sqlx.DB, repo *movieRepo, name string, titles ...string) tenant {
+	t.Helper()
+	ctx := context.Background()
+
+	var orgID int64
+	err := db.GetContext(ctx, &orgID, `INSERT INTO organizations (name) VALUES ($1) RETURNING id`, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM organizations WHERE id = $1`, orgID)
+	})
+
+	tn := tenant{scope: orgmodels.ScopeFor(orgmodels.Membership{OrgID: orgID, Role: orgmodels.RoleMember})}
+
+	for _, title := range titles {
+		movie, err := repo.Insert(ctx, tn.scope, models.Movie{
+			Title:   title,
+			Year:    2000,
+			Runtime: 100,
+			Genres:  []string{"drama"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tn.movies = append(tn.movies, movie)
+	}
+
+	return tn
+}
+
+func newTenants(t *testing.T) (*movieRepo, tenant, tenant) {
+	t.Helper()
+
+	db := openTestDB(t)
+	repo := NewMovieRepo(db)
+
+	a := newTenant(t, db, repo, "tenant a", "Alpha One", "Alpha Two")
+	b := newTenant(t, db, repo, "tenant b", "Bravo One", "Bravo Two", "Bravo Three")
+
+	return repo, a, b
+}
+
+func TestGetIsScoped(t *testing.T) {
+	repo, a, b := newTenants(t)
+	ctx := context.Background()
+
+	for _, movie := range b.movies {
+		_, err := repo.Get(ctx, a.scope, movie.ID)
+		if !errors.Is(err, repoerrors.ErrMovieNoFound) {
+			t.Errorf("getting movie %d of b as a: got %v, want %v", movie.ID, err, repoerrors.ErrMovieNoFound)
+		}
+
+		got, err := repo.Get(ctx, b.scope, movie.ID)
+		if err != nil {
+			t.Fatalf("getting movie %d of b as b: %v", movie.ID, err)
+		}
+		if got.Title != movie.Title {
+			t.Errorf("got title %q, want %q", got.Title, movie.Title)
+		}
+	}
+}
+
+// TestIDGuessing walks every ID around both tenants' movies as a, which must
+// only ever find its own
+func TestIDGuessing(t *testing.T) {
+	repo, a, b := newTenants(t)
+	ctx := context.Background()
+
+	own := map[int64]bool{}
+	low, high := a.movies[0].ID, a.movies[0].ID
+	for _, movie := range append(append([]models.Movie{}, a.movies...), b.movies...) {
+		if movie.ID < low {
+			low = movie.ID
+		}
+		if movie.ID > high {
+			high = movie.ID
+		}
+	}
+	for _, movie := range a.movies {
+		own[movie.ID] = true
+	}
+
+	for id := low - 5; id <= high+5; id++ {
+		movie, err := repo.Get(ctx, a.scope, id)
+		switch {
+		case err == nil && !own[id]:
+			t.Errorf("a guessed movie %d, %q, which is not its own", id, movie.Title)
+		case err != nil && own[id]:
+			t.Errorf("a could not get its own movie %d: %v", id, err)
+		case err != nil && !errors.Is(err, repoerrors.ErrMovieNoFound):
+			t.Errorf("guessing movie %d: got %v, want %v", id, err, repoerrors.ErrMovieNoFound)
+		}
+	}
+}
+
+func TestUpdateIsScoped(t *testing.T) {
+	repo, a, b := newTenants(t)
+	ctx := context.Background()
+
+	target := b.movies[0]
+	changed := target
+	changed.Title = "Changed by a"
+
+	_, err := repo.Update(ctx, a.scope, changed)
+	if !errors.Is(err, repoerrors.ErrMovieNoFound) {
+		t.Fatalf("updating movie of b as a: got %v, want %v", err, repoerrors.ErrMovieNoFound)
+	}
+
+	got, err := repo.Get(ctx, b.scope, target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != target.Title || got.Version != target.Version {
+		t.Errorf("movie of b changed to %q version %d, want %q version %d",
+			got.Title, got.Version, target.Title, target.Version)
+	}
+}
+
+func TestDeleteIsScoped(t *testing.T) {
+	repo, a, b := newTenants(t)
+	ctx := context.Background()
+
+	for _, movie := range b.movies {
+		err := repo.Delete(ctx, a.scope, movie.ID)
+		if !errors.Is(err, repoerrors.ErrMovieNoFound) {
+			t.Errorf("deleting movie %d of b as a: got %v, want %v", movie.ID, err, repoerrors.ErrMovieNoFound)
+		}
+
+		_, err = repo.Get(ctx, b.scope, movie.ID)
+		if err != nil {
+			t.Errorf("movie %d of b is gone: %v", movie.ID, err)
+		}
+	}
+}
+
+func TestGetAllIsScoped(t *testing.T) {
+	repo, a, b := newTenants(t)
+	ctx := context.Background()
+
+	filters := commonmodels.Filters{
+		Page:         1,
+		PageSize:     100,
+		Sort:         "id",
+		SortSafeList: []string{"id"},
+	}
+
+	for _, tc := range []struct {
+		name  string
+		scope orgmodels.Scope
+		want  []models.Movie
+	}{
+		{"a", a.scope, a.movies},
+		{"b", b.scope, b.movies},
+	} {
+		movies, metadata, err := repo.GetAll(ctx, tc.scope, "", []string{}, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(movies) != len(tc.want) || metadata.TotalRecords != len(tc.want) {
+			t.Fatalf("%s: got %d movies and %d total records, want %d",
+				tc.name, len(movies), metadata.TotalRecords, len(tc.want))
+		}
+		for i, movie := range movies {
+			if movie.ID != tc.want[i].ID {
+				t.Errorf("%s: got movie %d at %d, want %d", tc.name, movie.ID, i, tc.want[i].ID)
+			}
+		}
+	}
+
+	// A title search matching the other tenant's movies finds nothing
+	movies, metadata, err := repo.GetAll(ctx, a.scope, "Bravo", []string{}, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movies) != 0 || metadata.TotalRecords != 0 {
+		t.Errorf("searching b's titles as a: got %d movies and %d total records, want none",
+			len(movies), metadata.TotalRecords)
+	}
+}
+
+// TestZeroScope needs no database, the repository refuses before querying
+func TestZeroScope(t *testing.T) {
+	repo := NewMovieRepo(nil)
+	ctx := context.Background()
+
+	_, err := repo.Insert(ctx, orgmodels.Scope{}, models.Movie{Title: "Unscoped"})
+	if !errors.Is(err, repoerrors.ErrMissingScope) {
+		t.Errorf("Insert: got %v, want %v", err, repoerrors.ErrMissingScope)
+	}
+
+	_, err = repo.Get(ctx, orgmodels.Scope{}, 1)
+	if !errors.Is(err, repoerrors.ErrMissingScope) {
+		t.Errorf("Get: got %v, want %v", err, repoerrors.ErrMissingScope)
+	}
+
+	_, _, err = repo.GetAll(ctx, orgmodels.Scope{}, "", nil, commonmodels.Filters{})
+	if !errors.Is(err, repoerrors.ErrMissingScope) {
+		t.Errorf("GetAll: got %v, want %v", err, repoerrors.ErrMissingScope)
+	}
+
+	_, err = repo.Update(ctx, orgmodels.Scope{}, models.Movie{ID: 1})
+	if !errors.Is(err, repoerrors.ErrMissingScope) {
+		t.Errorf("Update: got %v, want %v", err, repoerrors.ErrMissingScope)
+	}
+
+	err = repo.Delete(ctx, orgmodels.Scope{}, 1)
+	if !errors.Is(err, repoerrors.ErrMissingScope) {
+		t.Errorf("Delete: got %v, want %v", err, repoerrors.ErrMissingScope)
+	}
+}
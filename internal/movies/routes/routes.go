@@ -2,6 +2,7 @@ package routes
 
 import (
 	"greenlight/internal/movies/handlers"
+	"greenlight/pkg/authz"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,13 +15,15 @@ type Handler interface {
 	ListMovies() func(c *gin.Context)
 }
 
-func MakeRoutes(engine *gin.RouterGroup, handler *handlers.Handler) {
-	movies := engine.Group("movies")
+// MakeRoutes registers the movie routes behind activeOrganization, which scopes
+// every request to one organization
+func MakeRoutes(engine *authz.Group, handler *handlers.Handler, activeOrganization gin.HandlerFunc) {
+	movies := engine.Group("movies", activeOrganization)
 	{
-		movies.GET("", handler.ListMovies())
-		movies.GET("/:id", handler.ShowMovie())
-		movies.POST("", handler.CreateMovie())
-		movies.PATCH("/:id", handler.UpdateMovie())
-		movies.DELETE("/:id", handler.DeleteMovie())
+		movies.GET("", authz.Permission("movies:read"), handler.ListMovies())
+		movies.GET("/:id", authz.Permission("movies:read"), handler.ShowMovie())
+		movies.POST("", authz.Permission("movies:write"), handler.CreateMovie())
+		movies.PATCH("/:id", authz.Permission("movies:write"), handler.UpdateMovie())
+		movies.DELETE("/:id", authz.Permission("movies:write"), handler.DeleteMovie())
 	}
 }
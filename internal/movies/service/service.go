@@ -6,20 +6,23 @@ import (
 
 	commonmodels "greenlight/internal/models"
 	"greenlight/internal/movies/models"
+	"greenlight/internal/movies/policy"
 	"greenlight/internal/movies/repoerrors"
 	"greenlight/internal/movies/serviceerrors"
+	orgmodels "greenlight/internal/organizations/models"
+	"greenlight/pkg/tracing"
 )
 
 type movieService struct {
 	repo MovieRepo
 }
 type MovieRepo interface {
-	Insert(ctx context.Context, movie models.Movie) (models.Movie, error)
-	Get(ctx context.Context, id int64) (models.Movie, error)
-	GetAll(ctx context.Context, title string, genres []string, filters commonmodels.Filters,
+	Insert(ctx context.Context, scope orgmodels.Scope, movie models.Movie) (models.Movie, error)
+	Get(ctx context.Context, scope orgmodels.Scope, id int64) (models.Movie, error)
+	GetAll(ctx context.Context, scope orgmodels.Scope, title string, genres []string, filters commonmodels.Filters,
 	) ([]models.Movie, commonmodels.Metadata, error)
-	Update(ctx context.Context, movie models.Movie) (models.Movie, error)
-	Delete(ctx context.Context, id int64) error
+	Update(ctx context.Context, scope orgmodels.Scope, movie models.Movie) (models.Movie, error)
+	Delete(ctx context.Context, scope orgmodels.Scope, id int64) error
 }
 
 func NewMovieService(repo MovieRepo) *movieService {
@@ -28,8 +31,11 @@ func NewMovieService(repo MovieRepo) *movieService {
 	}
 }
 
-func (m movieService) AddMovie(ctx context.Context, movie models.Movie) (models.Movie, error) {
-	movie, err := m.repo.Insert(ctx, movie)
+func (m movieService) AddMovie(ctx context.Context, scope orgmodels.Scope, movie models.Movie) (models.Movie, error) {
+	ctx, span := tracing.Start(ctx, "MovieService.AddMovie")
+	defer span.End()
+
+	movie, err := m.repo.Insert(ctx, scope, movie)
 	if err != nil {
 		switch {
 		case errors.Is(err, repoerrors.ErrMovieTitleRequired):
@@ -44,8 +50,11 @@ func (m movieService) AddMovie(ctx context.Context, movie models.Movie) (models.
 	return movie, nil
 }
 
-func (m movieService) GetMovie(ctx context.Context, id int64) (models.Movie, error) {
-	movie, err := m.repo.Get(ctx, id)
+func (m movieService) GetMovie(ctx context.Context, scope orgmodels.Scope, id int64) (models.Movie, error) {
+	ctx, span := tracing.Start(ctx, "MovieService.GetMovie")
+	defer span.End()
+
+	movie, err := m.repo.Get(ctx, scope, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, repoerrors.ErrMovieNoFound):
@@ -58,9 +67,12 @@ func (m movieService) GetMovie(ctx context.Context, id int64) (models.Movie, err
 	return movie, nil
 }
 
-func (m movieService) GetMovies(ctx context.Context, title string, genres []string, filters commonmodels.Filters,
+func (m movieService) GetMovies(ctx context.Context, scope orgmodels.Scope, title string, genres []string, filters commonmodels.Filters,
 ) ([]models.Movie, commonmodels.Metadata, error) {
-	movies, metadata, err := m.repo.GetAll(ctx, title, genres, filters)
+	ctx, span := tracing.Start(ctx, "MovieService.GetMovies")
+	defer span.End()
+
+	movies, metadata, err := m.repo.GetAll(ctx, scope, title, genres, filters)
 	if err != nil {
 		switch {
 		case errors.Is(err, repoerrors.ErrMovieNoFound):
@@ -73,8 +85,17 @@ func (m movieService) GetMovies(ctx context.Context, title string, genres []stri
 	return movies, metadata, nil
 }
 
-func (m movieService) UpdateMovie(ctx context.Context, movie models.Movie) (models.Movie, error) {
-	movie, err := m.repo.Update(ctx, movie)
+// UpdateMovie saves the changes to movie if the movie policy allows actor to make them
+func (m movieService) UpdateMovie(ctx context.Context, scope orgmodels.Scope, actor policy.Actor, movie models.Movie) (models.Movie, error) {
+	ctx, span := tracing.Start(ctx, "MovieService.UpdateMovie")
+	defer span.End()
+
+	err := policy.CanModify(actor, movie)
+	if err != nil {
+		return models.Movie{}, err
+	}
+
+	movie, err = m.repo.Update(ctx, scope, movie)
 	if err != nil {
 		switch {
 		case errors.Is(err, repoerrors.ErrMovieNoFound):
@@ -91,8 +112,22 @@ func (m movieService) UpdateMovie(ctx context.Context, movie models.Movie) (mode
 	return movie, nil
 }
 
-func (m movieService) DeleteMovie(ctx context.Context, id int64) error {
-	err := m.repo.Delete(ctx, id)
+// DeleteMovie deletes the movie if the movie policy allows actor to
+func (m movieService) DeleteMovie(ctx context.Context, scope orgmodels.Scope, actor policy.Actor, id int64) error {
+	ctx, span := tracing.Start(ctx, "MovieService.DeleteMovie")
+	defer span.End()
+
+	movie, err := m.GetMovie(ctx, scope, id)
+	if err != nil {
+		return err
+	}
+
+	err = policy.CanModify(actor, movie)
+	if err != nil {
+		return err
+	}
+
+	err = m.repo.Delete(ctx, scope, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, repoerrors.ErrMovieNoFound):
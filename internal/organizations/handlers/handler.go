@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"greenlight/internal/organizations/models"
+	"greenlight/internal/organizations/serviceerrors"
+	usersmodels "greenlight/internal/users/models"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	Logger              *jsonlog.Logger
+	Version             string
+	Env                 string
+	OrganizationService OrganizationService
+}
+
+type OrganizationService interface {
+	AddOrganization(ctx context.Context, userID int64, org models.Organization) (models.Organization, error)
+	GetOrganizations(ctx context.Context, userID int64) ([]models.MemberOrganization, error)
+	GetMembers(ctx context.Context, userID, orgID int64) ([]models.Membership, error)
+	SetMember(ctx context.Context, actorID int64, membership models.Membership) (models.Membership, error)
+	RemoveMember(ctx context.Context, actorID, orgID, userID int64) error
+}
+
+func (h *Handler) CreateOrganization() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, ok := h.user(c)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Name string `json:"name"`
+		}
+
+		err := httphelpers.ReadJSON(c, &input)
+		if err != nil {
+			httphelpers.StatusBadRequestResponse(c, err.Error())
+			return
+		}
+
+		org := models.Organization{Name: input.Name}
+
+		v := validator.New()
+		if models.ValidateOrganization(v, org); !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		org, err = h.OrganizationService.AddOrganization(c, user.ID, org)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		headers := make(http.Header)
+		headers.Set("Location", fmt.Sprintf("/v1/organizations/%d", org.ID))
+
+		err = httphelpers.WriteResponse(c, http.StatusCreated, gin.H{"organization": org}, headers)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) ListOrganizations() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, ok := h.user(c)
+		if !ok {
+			return
+		}
+
+		orgs, err := h.OrganizationService.GetOrganizations(c, user.ID)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		if len(orgs) == 0 {
+			orgs = []models.MemberOrganization{}
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"organizations": orgs}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) ListMembers() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, ok := h.user(c)
+		if !ok {
+			return
+		}
+
+		orgID, err := httphelpers.ReadIDParam(c)
+		if err != nil {
+			httphelpers.StatusNotFoundResponse(c)
+			return
+		}
+
+		members, err := h.OrganizationService.GetMembers(c, user.ID, orgID)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"members": members}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) SetMember() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, orgID, memberID, ok := h.memberParams(c)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Role string `json:"role"`
+		}
+
+		err := httphelpers.ReadJSON(c, &input)
+		if err != nil {
+			httphelpers.StatusBadRequestResponse(c, err.Error())
+			return
+		}
+
+		v := validator.New()
+		if models.ValidateRole(v, input.Role); !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		membership, err := h.OrganizationService.SetMember(c, user.ID, models.Membership{
+			OrgID:  orgID,
+			UserID: memberID,
+			Role:   input.Role,
+		})
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"member": membership}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) RemoveMember() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, orgID, memberID, ok := h.memberParams(c)
+		if !ok {
+			return
+		}
+
+		err := h.OrganizationService.RemoveMember(c, user.ID, orgID, memberID)
+		if err != nil {
+			h.errorResponse(c, err)
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"message": "member successfully removed"}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *Handler) errorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, serviceerrors.ErrNotMember):
+		// Organizations the user does not belong to are not disclosed
+		httphelpers.StatusNotFoundResponse(c)
+	case errors.Is(err, serviceerrors.ErrNotOrgAdmin):
+		httphelpers.ProblemResponse(c, httphelpers.CodeForbidden, err.Error())
+	case errors.Is(err, serviceerrors.ErrMemberNotFound):
+		httphelpers.StatusNotFoundResponse(c)
+	case errors.Is(err, serviceerrors.ErrUserNotFound):
+		httphelpers.StatusUnprocesableEntities(c, map[string]string{"user_id": err.Error()})
+	case errors.Is(err, serviceerrors.ErrLastAdmin):
+		httphelpers.StatusConflictResponse(c)
+	default:
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *Handler) user(c *gin.Context) (usersmodels.User, bool) {
+	user, err := httphelpers.ContextGetUser(c)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return usersmodels.User{}, false
+	}
+
+	return user, true
+}
+
+func (h *Handler) memberParams(c *gin.Context) (usersmodels.User, int64, int64, bool) {
+	user, ok := h.user(c)
+	if !ok {
+		return usersmodels.User{}, 0, 0, false
+	}
+
+	orgID, err := httphelpers.ReadIDParam(c)
+	if err != nil {
+		httphelpers.StatusNotFoundResponse(c)
+		return usersmodels.User{}, 0, 0, false
+	}
+
+	memberID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil || memberID < 1 {
+		httphelpers.StatusNotFoundResponse(c)
+		return usersmodels.User{}, 0, 0, false
+	}
+
+	return user, orgID, memberID, true
+}
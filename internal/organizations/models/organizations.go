@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"greenlight/pkg/validator"
+)
+
+// Organization roles decide who may manage an organization's members. They do
+// not grant anything on movies, which needs the global movie permissions, see
+// the users service for the organization every account starts with.
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+)
+
+type Organization struct {
+	ID        int64     `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	Name      string    `json:"name" db:"name"`
+}
+
+// Membership is the role of a user in an organization
+type Membership struct {
+	OrgID     int64     `json:"org_id" db:"org_id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	Role      string    `json:"role" db:"role"`
+}
+
+// Scope is the organization a request acts on. It can only be built from a
+// membership, so holding one proves the caller belongs to the organization,
+// and tenant scoped repositories refuse to run without one.
+type Scope struct {
+	orgID  int64
+	userID int64
+}
+
+func ScopeFor(membership Membership) Scope {
+	return Scope{orgID: membership.OrgID, userID: membership.UserID}
+}
+
+func (s Scope) OrgID() int64 {
+	return s.orgID
+}
+
+func (s Scope) UserID() int64 {
+	return s.userID
+}
+
+func (s Scope) IsZero() bool {
+	return s.orgID == 0
+}
+
+func ValidateOrganization(v *validator.Validator, org Organization) {
+	v.Check(org.Name != "", "name", "must be provided")
+	v.Check(len(org.Name) <= 200, "name", "must not be more than 200 bytes long")
+}
+
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(validator.PermittedValue(role, RoleMember, RoleAdmin), "role", "must be member or admin")
+}
+
+// MemberOrganization is an organization as seen by one of its members
+type MemberOrganization struct {
+	Organization
+	Role string `json:"role" db:"role"`
+}
@@ -0,0 +1,187 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"greenlight/internal/organizations/models"
+	"greenlight/internal/organizations/repoerrors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type organizationRepo struct {
+	DB *sqlx.DB
+}
+
+func NewOrganizationRepo(db *sqlx.DB) *organizationRepo {
+	return &organizationRepo{
+		DB: db,
+	}
+}
+
+// Insert creates the organization with ownerID as its first admin
+func (r organizationRepo) Insert(ctx context.Context, org models.Organization, ownerID int64) (models.Organization, error) {
+	query := `
+        INSERT INTO organizations (name)
+        VALUES ($1)
+        RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return models.Organization{}, err
+	}
+	defer tx.Rollback()
+
+	err = tx.GetContext(ctx, &org, query, org.Name)
+	if err != nil {
+		return models.Organization{}, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO organization_members (org_id, user_id, role)
+        VALUES ($1, $2, $3)`, org.ID, ownerID, models.RoleAdmin)
+	if err != nil {
+		return models.Organization{}, err
+	}
+
+	return org, tx.Commit()
+}
+
+func (r organizationRepo) GetAllForUser(ctx context.Context, userID int64) ([]models.MemberOrganization, error) {
+	query := `
+        SELECT organizations.id, organizations.created_at, organizations.name, organization_members.role
+        FROM organizations
+        INNER JOIN organization_members ON organization_members.org_id = organizations.id
+        WHERE organization_members.user_id = $1
+        ORDER BY organizations.id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var orgs []models.MemberOrganization
+
+	err := r.DB.SelectContext(ctx, &orgs, query, userID)
+	if err != nil {
+		return orgs, err
+	}
+
+	return orgs, nil
+}
+
+func (r organizationRepo) GetMembership(ctx context.Context, orgID, userID int64) (models.Membership, error) {
+	query := `
+        SELECT org_id, user_id, created_at, role
+        FROM organization_members
+        WHERE org_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var membership models.Membership
+
+	err := r.DB.GetContext(ctx, &membership, query, orgID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.Membership{}, repoerrors.ErrMembershipNotFound
+		default:
+			return models.Membership{}, err
+		}
+	}
+
+	return membership, nil
+}
+
+func (r organizationRepo) GetMembers(ctx context.Context, orgID int64) ([]models.Membership, error) {
+	query := `
+        SELECT org_id, user_id, created_at, role
+        FROM organization_members
+        WHERE org_id = $1
+        ORDER BY user_id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var members []models.Membership
+
+	err := r.DB.SelectContext(ctx, &members, query, orgID)
+	if err != nil {
+		return members, err
+	}
+
+	return members, nil
+}
+
+// SetMember adds the user to the organization, or changes the role of an existing member
+func (r organizationRepo) SetMember(ctx context.Context, membership models.Membership) (models.Membership, error) {
+	query := `
+        INSERT INTO organization_members (org_id, user_id, role)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (org_id, user_id) DO UPDATE SET role = EXCLUDED.role
+        RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.DB.GetContext(ctx, &membership, query, membership.OrgID, membership.UserID, membership.Role)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `foreign key constraint "organization_members_user_id_fkey"`):
+			return models.Membership{}, repoerrors.ErrUserNotFound
+		default:
+			return models.Membership{}, err
+		}
+	}
+
+	return membership, nil
+}
+
+func (r organizationRepo) RemoveMember(ctx context.Context, orgID, userID int64) error {
+	query := `
+        DELETE FROM organization_members
+        WHERE org_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repoerrors.ErrMembershipNotFound
+	}
+
+	return nil
+}
+
+func (r organizationRepo) CountAdmins(ctx context.Context, orgID int64) (int, error) {
+	query := `
+        SELECT count(*)
+        FROM organization_members
+        WHERE org_id = $1 AND role = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var admins int
+
+	err := r.DB.GetContext(ctx, &admins, query, orgID, models.RoleAdmin)
+	if err != nil {
+		return 0, err
+	}
+
+	return admins, nil
+}
@@ -0,0 +1,10 @@
+package repoerrors
+
+import (
+	"errors"
+)
+
+var (
+	ErrMembershipNotFound = errors.New("membership not found")
+	ErrUserNotFound       = errors.New("user not found")
+)
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"greenlight/internal/organizations/handlers"
+	"greenlight/pkg/authz"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler interface {
+	CreateOrganization() func(c *gin.Context)
+	ListOrganizations() func(c *gin.Context)
+	ListMembers() func(c *gin.Context)
+	SetMember() func(c *gin.Context)
+	RemoveMember() func(c *gin.Context)
+}
+
+func MakeRoutes(engine *authz.Group, handler *handlers.Handler) {
+	organizations := engine.Group("organizations")
+	{
+		organizations.GET("", authz.Activated(), handler.ListOrganizations())
+		organizations.POST("", authz.Activated(), handler.CreateOrganization())
+		organizations.GET("/:id/members", authz.Activated(), handler.ListMembers())
+		organizations.PUT("/:id/members/:user_id", authz.Activated().OwnerOnly(), handler.SetMember())
+		organizations.DELETE("/:id/members/:user_id", authz.Activated().OwnerOnly(), handler.RemoveMember())
+	}
+}
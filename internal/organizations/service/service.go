@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"greenlight/internal/organizations/models"
+	"greenlight/internal/organizations/repoerrors"
+	"greenlight/internal/organizations/serviceerrors"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/tracing"
+)
+
+type organizationService struct {
+	repo   OrganizationRepo
+	logger *jsonlog.Logger
+}
+
+type OrganizationRepo interface {
+	Insert(ctx context.Context, org models.Organization, ownerID int64) (models.Organization, error)
+	GetAllForUser(ctx context.Context, userID int64) ([]models.MemberOrganization, error)
+	GetMembership(ctx context.Context, orgID, userID int64) (models.Membership, error)
+	GetMembers(ctx context.Context, orgID int64) ([]models.Membership, error)
+	SetMember(ctx context.Context, membership models.Membership) (models.Membership, error)
+	RemoveMember(ctx context.Context, orgID, userID int64) error
+	CountAdmins(ctx context.Context, orgID int64) (int, error)
+}
+
+func NewOrganizationService(repo OrganizationRepo, logger *jsonlog.Logger) *organizationService {
+	return &organizationService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (s *organizationService) AddOrganization(ctx context.Context, userID int64, org models.Organization) (models.Organization, error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.AddOrganization")
+	defer span.End()
+
+	return s.repo.Insert(ctx, org, userID)
+}
+
+func (s *organizationService) GetOrganizations(ctx context.Context, userID int64) ([]models.MemberOrganization, error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.GetOrganizations")
+	defer span.End()
+
+	return s.repo.GetAllForUser(ctx, userID)
+}
+
+// Resolve returns the scope of userID in orgID. Without an orgID, the only
+// organization of the user is used, if there is exactly one.
+func (s *organizationService) Resolve(ctx context.Context, userID, orgID int64) (models.Scope, error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.Resolve")
+	defer span.End()
+
+	if orgID == 0 {
+		orgs, err := s.repo.GetAllForUser(ctx, userID)
+		if err != nil {
+			return models.Scope{}, err
+		}
+		if len(orgs) != 1 {
+			return models.Scope{}, serviceerrors.ErrOrgRequired
+		}
+		orgID = orgs[0].ID
+	}
+
+	membership, err := s.membership(ctx, orgID, userID)
+	if err != nil {
+		return models.Scope{}, err
+	}
+
+	return models.ScopeFor(membership), nil
+}
+
+// IsMember reports whether userID belongs to orgID
+func (s *organizationService) IsMember(ctx context.Context, orgID, userID int64) (bool, error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.IsMember")
+	defer span.End()
+
+	_, err := s.membership(ctx, orgID, userID)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, serviceerrors.ErrNotMember):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func (s *organizationService) GetMembers(ctx context.Context, userID, orgID int64) ([]models.Membership, error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.GetMembers")
+	defer span.End()
+
+	_, err := s.membership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetMembers(ctx, orgID)
+}
+
+// SetMember adds a member or changes their role. Only organization admins can,
+// and the last admin cannot step down.
+func (s *organizationService) SetMember(ctx context.Context, actorID int64, membership models.Membership) (models.Membership, error) {
+	ctx, span := tracing.Start(ctx, "OrganizationService.SetMember")
+	defer span.End()
+
+	err := s.requireAdmin(ctx, membership.OrgID, actorID)
+	if err != nil {
+		return models.Membership{}, err
+	}
+
+	if membership.Role != models.RoleAdmin {
+		err = s.keepAnAdmin(ctx, membership.OrgID, membership.UserID)
+		if err != nil {
+			return models.Membership{}, err
+		}
+	}
+
+	membership, err = s.repo.SetMember(ctx, membership)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrUserNotFound):
+			return models.Membership{}, serviceerrors.ErrUserNotFound
+		default:
+			return models.Membership{}, err
+		}
+	}
+
+	return membership, nil
+}
+
+func (s *organizationService) RemoveMember(ctx context.Context, actorID, orgID, userID int64) error {
+	ctx, span := tracing.Start(ctx, "OrganizationService.RemoveMember")
+	defer span.End()
+
+	if actorID != userID {
+		err := s.requireAdmin(ctx, orgID, actorID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.keepAnAdmin(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.RemoveMember(ctx, orgID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrMembershipNotFound):
+			return serviceerrors.ErrMemberNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *organizationService) membership(ctx context.Context, orgID, userID int64) (models.Membership, error) {
+	membership, err := s.repo.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrMembershipNotFound):
+			return models.Membership{}, serviceerrors.ErrNotMember
+		default:
+			return models.Membership{}, err
+		}
+	}
+
+	return membership, nil
+}
+
+func (s *organizationService) requireAdmin(ctx context.Context, orgID, userID int64) error {
+	membership, err := s.membership(ctx, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	if membership.Role != models.RoleAdmin {
+		return serviceerrors.ErrNotOrgAdmin
+	}
+
+	return nil
+}
+
+// keepAnAdmin fails if userID is the only admin left in the organization
+func (s *organizationService) keepAnAdmin(ctx context.Context, orgID, userID int64) error {
+	current, err := s.repo.GetMembership(ctx, orgID, userID)
+	if err != nil {
+		if errors.Is(err, repoerrors.ErrMembershipNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if current.Role != models.RoleAdmin {
+		return nil
+	}
+
+	admins, err := s.repo.CountAdmins(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	if admins <= 1 {
+		return serviceerrors.ErrLastAdmin
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+package serviceerrors
+
+import "errors"
+
+var (
+	ErrNotMember      = errors.New("not a member of this organization")
+	ErrNotOrgAdmin    = errors.New("organization admin role required")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrMemberNotFound = errors.New("member not found")
+	ErrLastAdmin      = errors.New("an organization needs at least one admin")
+	ErrOrgRequired    = errors.New("organization required, send the X-Organization-ID header")
+)
@@ -0,0 +1,145 @@
+// Package cache keeps the effective permissions of recently seen users in memory,
+// so authorization does not hit the database on every request.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"greenlight/internal/permissions/models"
+)
+
+type entry struct {
+	userID      int64
+	permissions models.Permissions
+	expiry      time.Time
+}
+
+// Cache is a least recently used cache with a time to live. A zero size
+// disables it, every lookup is then a miss.
+//
+// Every invalidation bumps a generation counter. Loaders read it with
+// Generation before querying the database and pass it to Set, which drops the
+// permissions if an invalidation happened meanwhile, since they may predate it.
+type Cache struct {
+	ttl  time.Duration
+	size int
+
+	mu         sync.Mutex
+	entries    map[int64]*list.Element
+	order      *list.List
+	generation uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func New(ttl time.Duration, size int) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[int64]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *Cache) Get(userID int64) (models.Permissions, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[userID]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	e := element.Value.(*entry)
+	if time.Now().After(e.expiry) {
+		c.remove(element)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits.Add(1)
+
+	return e.permissions, true
+}
+
+// Generation returns the current generation, to be passed to Set
+func (c *Cache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+// Set stores the permissions of a user loaded at generation. Nothing is stored
+// when the cache has been invalidated since.
+func (c *Cache) Set(userID int64, permissions models.Permissions, generation uint64) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if element, ok := c.entries[userID]; ok {
+		c.remove(element)
+	}
+
+	c.entries[userID] = c.order.PushFront(&entry{
+		userID:      userID,
+		permissions: permissions,
+		expiry:      time.Now().Add(c.ttl),
+	})
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *Cache) Invalidate(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	if element, ok := c.entries[userID]; ok {
+		c.remove(element)
+	}
+}
+
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	c.entries = make(map[int64]*list.Element)
+	c.order.Init()
+}
+
+// Stats returns the counters published through expvar
+func (c *Cache) Stats() map[string]int64 {
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+
+	return map[string]int64{
+		"hits":   c.hits.Load(),
+		"misses": c.misses.Load(),
+		"size":   int64(size),
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry).userID)
+}
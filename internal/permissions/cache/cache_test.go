@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"greenlight/internal/permissions/models"
+)
+
+func TestSetAfterInvalidateIsDropped(t *testing.T) {
+	c := New(time.Minute, 10)
+
+	// A reader misses and starts loading, then a revoke invalidates the user
+	// before the reader stores what it loaded
+	generation := c.Generation()
+	c.Invalidate(1)
+	c.Set(1, models.Permissions{"movies:write"}, generation)
+
+	if permissions, ok := c.Get(1); ok {
+		t.Fatalf("got cached permissions %v loaded before the invalidation", permissions)
+	}
+}
+
+func TestSetAfterInvalidateAllIsDropped(t *testing.T) {
+	c := New(time.Minute, 10)
+
+	generation := c.Generation()
+	c.InvalidateAll()
+	c.Set(1, models.Permissions{"movies:write"}, generation)
+
+	if permissions, ok := c.Get(1); ok {
+		t.Fatalf("got cached permissions %v loaded before the invalidation", permissions)
+	}
+}
+
+func TestSetWithCurrentGeneration(t *testing.T) {
+	c := New(time.Minute, 10)
+
+	c.Invalidate(1)
+	c.Set(1, models.Permissions{"movies:read"}, c.Generation())
+
+	permissions, ok := c.Get(1)
+	if !ok || !permissions.Include("movies:read") {
+		t.Fatalf("got %v, %t, want the permissions to be cached", permissions, ok)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c := New(time.Minute, 2)
+
+	for userID := int64(1); userID <= 3; userID++ {
+		c.Set(userID, models.Permissions{"movies:read"}, c.Generation())
+	}
+
+	if _, ok := c.Get(1); ok {
+		t.Error("the least recently used user was not evicted")
+	}
+	for _, userID := range []int64{2, 3} {
+		if _, ok := c.Get(userID); !ok {
+			t.Errorf("user %d was evicted", userID)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c := New(time.Nanosecond, 10)
+
+	c.Set(1, models.Permissions{"movies:read"}, c.Generation())
+	time.Sleep(time.Millisecond)
+
+	if _, ok := c.Get(1); ok {
+		t.Error("got an expired entry")
+	}
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"regexp"
+
+	"greenlight/pkg/validator"
+
+	"github.com/lib/pq"
+)
+
+var RoleNameRX = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// Role is a named bundle of permission codes. A user holds the union of the
+// codes of all their roles.
+type Role struct {
+	ID          int64          `json:"id" db:"id"`
+	Name        string         `json:"name" db:"name"`
+	Description string         `json:"description" db:"description"`
+	Permissions pq.StringArray `json:"permissions" db:"permissions"`
+}
+
+func ValidateRoleName(v *validator.Validator, name string) {
+	v.Check(validator.Matches(name, RoleNameRX), "name", "must be 2 to 32 lowercase letters, digits, dashes or underscores")
+}
+
+func ValidateRole(v *validator.Validator, role Role) {
+	ValidateRoleName(v, role.Name)
+	v.Check(len(role.Description) <= 200, "description", "must not be more than 200 bytes long")
+	v.Check(role.Permissions != nil, "permissions", "must be provided")
+	v.Check(validator.Unique(role.Permissions), "permissions", "must not contain duplicate values")
+}
@@ -0,0 +1,12 @@
+package repoerrors
+
+import (
+	"errors"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrDuplicateRole     = errors.New("duplicate role")
+	ErrUnknownPermission = errors.New("unknown permission code")
+	ErrUserNotFound      = errors.New("user not found")
+)
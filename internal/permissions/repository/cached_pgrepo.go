@@ -0,0 +1,164 @@
+package repo
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"greenlight/internal/permissions/cache"
+	"greenlight/internal/permissions/models"
+	"greenlight/pkg/jsonlog"
+
+	"github.com/lib/pq"
+)
+
+// NotifyChannel is the Postgres channel instances use to tell each other that
+// permissions changed. The payload is a user ID, or InvalidateAll.
+const (
+	NotifyChannel = "permissions_changed"
+	InvalidateAll = "*"
+)
+
+// cachedPermissionRepo serves GetAllForUser from the cache, and invalidates it
+// on every change both locally and, through NOTIFY, on the other instances
+type cachedPermissionRepo struct {
+	*permissionRepo
+	cache *cache.Cache
+}
+
+func NewCachedPermissionsRepo(repo *permissionRepo, cache *cache.Cache) *cachedPermissionRepo {
+	return &cachedPermissionRepo{
+		permissionRepo: repo,
+		cache:          cache,
+	}
+}
+
+func (r cachedPermissionRepo) GetAllForUser(ctx context.Context, userID int64) (models.Permissions, error) {
+	if permissions, ok := r.cache.Get(userID); ok {
+		return permissions, nil
+	}
+
+	// Read before the query, so an invalidation racing with it prevents caching
+	// permissions that may already be stale
+	generation := r.cache.Generation()
+
+	permissions, err := r.permissionRepo.GetAllForUser(ctx, userID)
+	if err != nil {
+		return permissions, err
+	}
+
+	r.cache.Set(userID, permissions, generation)
+
+	return permissions, nil
+}
+
+func (r cachedPermissionRepo) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	err := r.permissionRepo.AddForUser(ctx, userID, codes...)
+	if err != nil {
+		return err
+	}
+
+	return r.invalidate(ctx, strconv.FormatInt(userID, 10))
+}
+
+func (r cachedPermissionRepo) RevokeForUser(ctx context.Context, userID int64, codes ...string) error {
+	err := r.permissionRepo.RevokeForUser(ctx, userID, codes...)
+	if err != nil {
+		return err
+	}
+
+	return r.invalidate(ctx, strconv.FormatInt(userID, 10))
+}
+
+func (r cachedPermissionRepo) AssignRole(ctx context.Context, userID int64, name string) error {
+	err := r.permissionRepo.AssignRole(ctx, userID, name)
+	if err != nil {
+		return err
+	}
+
+	return r.invalidate(ctx, strconv.FormatInt(userID, 10))
+}
+
+func (r cachedPermissionRepo) UnassignRole(ctx context.Context, userID int64, name string) error {
+	err := r.permissionRepo.UnassignRole(ctx, userID, name)
+	if err != nil {
+		return err
+	}
+
+	return r.invalidate(ctx, strconv.FormatInt(userID, 10))
+}
+
+func (r cachedPermissionRepo) UpdateRole(ctx context.Context, role models.Role) (models.Role, error) {
+	role, err := r.permissionRepo.UpdateRole(ctx, role)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	return role, r.invalidate(ctx, InvalidateAll)
+}
+
+func (r cachedPermissionRepo) DeleteRole(ctx context.Context, name string) error {
+	err := r.permissionRepo.DeleteRole(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	return r.invalidate(ctx, InvalidateAll)
+}
+
+// Listen applies the invalidations sent by other instances until ctx is done.
+// It blocks, so run it in the background. The whole cache is dropped after a
+// reconnect, since notifications may have been missed meanwhile.
+func (r cachedPermissionRepo) Listen(ctx context.Context, dsn string, logger *jsonlog.Logger) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.PrintError(err, map[string]string{"task": "permissions listener"})
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(NotifyChannel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.NotificationChannel():
+			if notification == nil {
+				r.cache.InvalidateAll()
+				continue
+			}
+			r.apply(notification.Extra)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
+
+func (r cachedPermissionRepo) invalidate(ctx context.Context, payload string) error {
+	r.apply(payload)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, `SELECT pg_notify($1, $2)`, NotifyChannel, payload)
+	return err
+}
+
+func (r cachedPermissionRepo) apply(payload string) {
+	if payload == InvalidateAll {
+		r.cache.InvalidateAll()
+		return
+	}
+
+	userID, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		r.cache.InvalidateAll()
+		return
+	}
+
+	r.cache.Invalidate(userID)
+}
@@ -5,8 +5,8 @@ import (
 	"strings"
 	"time"
 
-	"greenlight/internal/movies/repoerrors"
 	"greenlight/internal/permissions/models"
+	"greenlight/internal/permissions/repoerrors"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
@@ -22,13 +22,20 @@ func NewPermissionsRepo(db *sqlx.DB) *permissionRepo {
 	}
 }
 
+// GetAllForUser returns the effective permissions of a user: the codes granted
+// directly plus the codes of every role the user holds
 func (r permissionRepo) GetAllForUser(ctx context.Context, userID int64) (models.Permissions, error) {
 	query := `
         SELECT permissions.code
         FROM permissions
         INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-        INNER JOIN users ON users_permissions.user_id = users.id
-        WHERE users.id = $1`
+        WHERE users_permissions.user_id = $1
+        UNION
+        SELECT permissions.code
+        FROM permissions
+        INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+        INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+        WHERE users_roles.user_id = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
@@ -47,11 +54,55 @@ func (r permissionRepo) GetAllForUser(ctx context.Context, userID int64) (models
 	return permissions, nil
 }
 
-/*VER ERRORRES*/
+// GetAll returns every permission code that can be granted
+func (r permissionRepo) GetAll(ctx context.Context) (models.Permissions, error) {
+	query := `
+        SELECT DISTINCT code
+        FROM permissions
+        ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var permissions models.Permissions
+
+	err := r.DB.SelectContext(ctx, &permissions, query)
+	if err != nil {
+		return permissions, err
+	}
+
+	return permissions, nil
+}
+
+// GetGrantedForUser returns the codes granted to the user directly, leaving out
+// the ones that come from roles
+func (r permissionRepo) GetGrantedForUser(ctx context.Context, userID int64) (models.Permissions, error) {
+	query := `
+        SELECT permissions.code
+        FROM permissions
+        INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+        WHERE users_permissions.user_id = $1
+        ORDER BY permissions.code`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var permissions models.Permissions
+
+	err := r.DB.SelectContext(ctx, &permissions, query, userID)
+	if err != nil {
+		return permissions, err
+	}
+
+	return permissions, nil
+}
+
+// AddForUser grants the codes to the user. Codes the user already holds are skipped.
 func (r permissionRepo) AddForUser(ctx context.Context, userID int64, codes ...string) error {
 	query := `
         INSERT INTO users_permissions
-        SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+        SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+        ON CONFLICT DO NOTHING`
 
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
@@ -60,11 +111,28 @@ func (r permissionRepo) AddForUser(ctx context.Context, userID int64, codes ...s
 	if err != nil {
 		switch {
 		case strings.Contains(err.Error(), `foreign key constraint "users_permissions_user_id_fkey"`):
-			return repoerrors.ErrUserPermissionsForeignKey
+			return repoerrors.ErrUserNotFound
 		default:
 			return err
 		}
 	}
 
+	return nil
+}
+
+// RevokeForUser removes direct grants of the codes. Codes held through a role
+// are not affected.
+func (r permissionRepo) RevokeForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `
+        DELETE FROM users_permissions
+        USING permissions
+        WHERE permissions.id = users_permissions.permission_id
+        AND users_permissions.user_id = $1
+        AND permissions.code = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
@@ -0,0 +1,265 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"greenlight/internal/permissions/models"
+	"greenlight/internal/permissions/repoerrors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const rolesQuery = `
+        SELECT roles.id, roles.name, roles.description,
+            COALESCE(array_agg(permissions.code ORDER BY permissions.code)
+                FILTER (WHERE permissions.code IS NOT NULL), '{}') AS permissions
+        FROM roles
+        LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+        LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id`
+
+func (r permissionRepo) GetRoles(ctx context.Context) ([]models.Role, error) {
+	query := rolesQuery + `
+        GROUP BY roles.id
+        ORDER BY roles.id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var roles []models.Role
+
+	err := r.DB.SelectContext(ctx, &roles, query)
+	if err != nil {
+		return roles, err
+	}
+
+	return roles, nil
+}
+
+func (r permissionRepo) GetRole(ctx context.Context, name string) (models.Role, error) {
+	query := rolesQuery + `
+        WHERE roles.name = $1
+        GROUP BY roles.id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var role models.Role
+
+	err := r.DB.GetContext(ctx, &role, query, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.Role{}, repoerrors.ErrRoleNotFound
+		default:
+			return models.Role{}, err
+		}
+	}
+
+	return role, nil
+}
+
+func (r permissionRepo) InsertRole(ctx context.Context, role models.Role) (models.Role, error) {
+	query := `
+        INSERT INTO roles (name, description)
+        VALUES ($1, $2)
+        RETURNING id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return models.Role{}, err
+	}
+	defer tx.Rollback()
+
+	err = tx.GetContext(ctx, &role.ID, query, role.Name, role.Description)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `unique constraint "roles_name_key"`):
+			return models.Role{}, repoerrors.ErrDuplicateRole
+		default:
+			return models.Role{}, err
+		}
+	}
+
+	err = setRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	return role, tx.Commit()
+}
+
+// UpdateRole replaces the description and the permission codes of a role
+func (r permissionRepo) UpdateRole(ctx context.Context, role models.Role) (models.Role, error) {
+	query := `
+        UPDATE roles
+        SET description = $2
+        WHERE name = $1
+        RETURNING id`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return models.Role{}, err
+	}
+	defer tx.Rollback()
+
+	err = tx.GetContext(ctx, &role.ID, query, role.Name, role.Description)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.Role{}, repoerrors.ErrRoleNotFound
+		default:
+			return models.Role{}, err
+		}
+	}
+
+	err = setRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	return role, tx.Commit()
+}
+
+func (r permissionRepo) DeleteRole(ctx context.Context, name string) error {
+	query := `
+        DELETE FROM roles
+        WHERE name = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repoerrors.ErrRoleNotFound
+	}
+
+	return nil
+}
+
+func (r permissionRepo) GetRolesForUser(ctx context.Context, userID int64) ([]string, error) {
+	query := `
+        SELECT roles.name
+        FROM roles
+        INNER JOIN users_roles ON users_roles.role_id = roles.id
+        WHERE users_roles.user_id = $1
+        ORDER BY roles.name`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var roles []string
+
+	err := r.DB.SelectContext(ctx, &roles, query, userID)
+	if err != nil {
+		return roles, err
+	}
+
+	return roles, nil
+}
+
+// AssignRole gives a role to a user. Assigning a role the user already has is a no-op.
+func (r permissionRepo) AssignRole(ctx context.Context, userID int64, name string) error {
+	query := `
+        WITH role AS (
+            SELECT id FROM roles WHERE name = $2
+        ), assigned AS (
+            INSERT INTO users_roles (user_id, role_id)
+            SELECT $1, id FROM role
+            ON CONFLICT DO NOTHING
+        )
+        SELECT count(*) FROM role`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var found int
+
+	err := r.DB.GetContext(ctx, &found, query, userID, name)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `foreign key constraint "users_roles_user_id_fkey"`):
+			return repoerrors.ErrUserNotFound
+		default:
+			return err
+		}
+	}
+
+	if found == 0 {
+		return repoerrors.ErrRoleNotFound
+	}
+
+	return nil
+}
+
+func (r permissionRepo) UnassignRole(ctx context.Context, userID int64, name string) error {
+	query := `
+        DELETE FROM users_roles
+        USING roles
+        WHERE roles.id = users_roles.role_id
+        AND users_roles.user_id = $1
+        AND roles.name = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, userID, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repoerrors.ErrRoleNotFound
+	}
+
+	return nil
+}
+
+// setRolePermissions replaces the codes of a role, failing when any of them is unknown
+func setRolePermissions(ctx context.Context, tx *sqlx.Tx, roleID int64, codes []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM roles_permissions WHERE role_id = $1`, roleID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO roles_permissions (role_id, permission_id)
+        SELECT DISTINCT $1::bigint, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+
+	result, err := tx.ExecContext(ctx, query, roleID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != int64(len(codes)) {
+		return repoerrors.ErrUnknownPermission
+	}
+
+	return nil
+}
@@ -5,38 +5,206 @@ import (
 	"errors"
 
 	"greenlight/internal/permissions/models"
-	"greenlight/internal/users/repoerrors"
-	"greenlight/internal/users/serviceerrors"
+	"greenlight/internal/permissions/repoerrors"
+	"greenlight/internal/permissions/serviceerrors"
 	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/tracing"
 )
 
 type permissionsService struct {
-	repo   PermissionsRepo
-	logger *jsonlog.Logger
+	repo        PermissionsRepo
+	defaultRole string
+	logger      *jsonlog.Logger
 }
 
 type PermissionsRepo interface {
 	AddForUser(ctx context.Context, userID int64, codes ...string) error
+	RevokeForUser(ctx context.Context, userID int64, codes ...string) error
+	GetAll(ctx context.Context) (models.Permissions, error)
 	GetAllForUser(ctx context.Context, userID int64) (models.Permissions, error)
+	GetGrantedForUser(ctx context.Context, userID int64) (models.Permissions, error)
+	GetRoles(ctx context.Context) ([]models.Role, error)
+	GetRole(ctx context.Context, name string) (models.Role, error)
+	InsertRole(ctx context.Context, role models.Role) (models.Role, error)
+	UpdateRole(ctx context.Context, role models.Role) (models.Role, error)
+	DeleteRole(ctx context.Context, name string) error
+	GetRolesForUser(ctx context.Context, userID int64) ([]string, error)
+	AssignRole(ctx context.Context, userID int64, name string) error
+	UnassignRole(ctx context.Context, userID int64, name string) error
 }
 
-func NewPermissionsService(repo PermissionsRepo, logger *jsonlog.Logger) *permissionsService {
+// NewPermissionsService returns the permissions service. defaultRole is given to
+// every new account.
+func NewPermissionsService(repo PermissionsRepo, defaultRole string, logger *jsonlog.Logger) *permissionsService {
 	return &permissionsService{
-		repo:   repo,
-		logger: logger,
+		repo:        repo,
+		defaultRole: defaultRole,
+		logger:      logger,
 	}
 }
 
+// AddForUser grants the codes to the user, failing without granting anything
+// if any of them does not exist
 func (s permissionsService) AddForUser(ctx context.Context, userID int64, codes ...string) error {
-	err := s.repo.AddForUser(ctx, userID)
+	ctx, span := tracing.Start(ctx, "PermissionsService.AddForUser")
+	defer span.End()
+
+	err := s.checkCodes(ctx, codes)
+	if err != nil {
+		return err
+	}
+
+	return repoError(s.repo.AddForUser(ctx, userID, codes...))
+}
+
+func (s permissionsService) RevokeForUser(ctx context.Context, userID int64, codes ...string) error {
+	ctx, span := tracing.Start(ctx, "PermissionsService.RevokeForUser")
+	defer span.End()
+
+	err := s.checkCodes(ctx, codes)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.RevokeForUser(ctx, userID, codes...)
+}
+
+func (s permissionsService) GetAll(ctx context.Context) (models.Permissions, error) {
+	ctx, span := tracing.Start(ctx, "PermissionsService.GetAll")
+	defer span.End()
+
+	return s.repo.GetAll(ctx)
+}
+
+func (s permissionsService) GetGrantedForUser(ctx context.Context, userID int64) (models.Permissions, error) {
+	ctx, span := tracing.Start(ctx, "PermissionsService.GetGrantedForUser")
+	defer span.End()
+
+	return s.repo.GetGrantedForUser(ctx, userID)
+}
+
+func (s permissionsService) GetAllForUser(ctx context.Context, userID int64) (models.Permissions, error) {
+	ctx, span := tracing.Start(ctx, "PermissionsService.GetAllForUser")
+	defer span.End()
+
+	permissions, err := s.repo.GetAllForUser(ctx, userID)
 	if err != nil {
-		switch {
-		case errors.Is(err, repoerrors.ErrUserNotFound):
-			return serviceerrors.ErrUserNotFound
-		default:
-			return err
+		return models.Permissions{}, err
+	}
+
+	return permissions, nil
+}
+
+func (s permissionsService) AssignDefaultRole(ctx context.Context, userID int64) error {
+	ctx, span := tracing.Start(ctx, "PermissionsService.AssignDefaultRole")
+	defer span.End()
+
+	return s.AssignRole(ctx, userID, s.defaultRole)
+}
+
+func (s permissionsService) GetRoles(ctx context.Context) ([]models.Role, error) {
+	ctx, span := tracing.Start(ctx, "PermissionsService.GetRoles")
+	defer span.End()
+
+	return s.repo.GetRoles(ctx)
+}
+
+func (s permissionsService) GetRole(ctx context.Context, name string) (models.Role, error) {
+	ctx, span := tracing.Start(ctx, "PermissionsService.GetRole")
+	defer span.End()
+
+	role, err := s.repo.GetRole(ctx, name)
+	if err != nil {
+		return models.Role{}, repoError(err)
+	}
+
+	return role, nil
+}
+
+func (s permissionsService) AddRole(ctx context.Context, role models.Role) (models.Role, error) {
+	ctx, span := tracing.Start(ctx, "PermissionsService.AddRole")
+	defer span.End()
+
+	role, err := s.repo.InsertRole(ctx, role)
+	if err != nil {
+		return models.Role{}, repoError(err)
+	}
+
+	return role, nil
+}
+
+func (s permissionsService) UpdateRole(ctx context.Context, role models.Role) (models.Role, error) {
+	ctx, span := tracing.Start(ctx, "PermissionsService.UpdateRole")
+	defer span.End()
+
+	role, err := s.repo.UpdateRole(ctx, role)
+	if err != nil {
+		return models.Role{}, repoError(err)
+	}
+
+	return role, nil
+}
+
+func (s permissionsService) DeleteRole(ctx context.Context, name string) error {
+	ctx, span := tracing.Start(ctx, "PermissionsService.DeleteRole")
+	defer span.End()
+
+	if name == s.defaultRole {
+		return serviceerrors.ErrDefaultRole
+	}
+
+	return repoError(s.repo.DeleteRole(ctx, name))
+}
+
+func (s permissionsService) GetRolesForUser(ctx context.Context, userID int64) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "PermissionsService.GetRolesForUser")
+	defer span.End()
+
+	return s.repo.GetRolesForUser(ctx, userID)
+}
+
+func (s permissionsService) AssignRole(ctx context.Context, userID int64, name string) error {
+	ctx, span := tracing.Start(ctx, "PermissionsService.AssignRole")
+	defer span.End()
+
+	return repoError(s.repo.AssignRole(ctx, userID, name))
+}
+
+func (s permissionsService) UnassignRole(ctx context.Context, userID int64, name string) error {
+	ctx, span := tracing.Start(ctx, "PermissionsService.UnassignRole")
+	defer span.End()
+
+	return repoError(s.repo.UnassignRole(ctx, userID, name))
+}
+
+func (s permissionsService) checkCodes(ctx context.Context, codes []string) error {
+	known, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		if !known.Include(code) {
+			return serviceerrors.ErrUnknownPermission
 		}
 	}
 
 	return nil
 }
+
+func repoError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, repoerrors.ErrRoleNotFound):
+		return serviceerrors.ErrRoleNotFound
+	case errors.Is(err, repoerrors.ErrDuplicateRole):
+		return serviceerrors.ErrDuplicateRole
+	case errors.Is(err, repoerrors.ErrUnknownPermission):
+		return serviceerrors.ErrUnknownPermission
+	case errors.Is(err, repoerrors.ErrUserNotFound):
+		return serviceerrors.ErrUserNotFound
+	default:
+		return err
+	}
+}
@@ -0,0 +1,11 @@
+package serviceerrors
+
+import "errors"
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrDuplicateRole     = errors.New("a role with this name already exists")
+	ErrUnknownPermission = errors.New("unknown permission code")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrDefaultRole       = errors.New("the default role cannot be deleted")
+)
@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"time"
 
+	permissionsmodels "greenlight/internal/permissions/models"
 	"greenlight/internal/users/models"
 	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/emailpolicy"
 	"greenlight/pkg/httphelpers"
 	"greenlight/pkg/jsonlog"
 	"greenlight/pkg/validator"
@@ -25,14 +27,25 @@ type Handler struct {
 
 type UserService interface {
 	AddUser(ctx context.Context, user models.User) (models.User, error)
+	GetUser(ctx context.Context, id int64) (models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (models.User, error)
 	UpdateUser(ctx context.Context, user models.User) (models.User, error)
+	UpdatePasswordHash(ctx context.Context, user models.User) error
 	GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string) (models.User, error)
+	RequestEmailChange(ctx context.Context, user models.User, newEmail string) (models.User, error)
+	ConfirmEmailChange(ctx context.Context, tokenPlaintext string) (models.User, error)
 }
 
 type TokenService interface {
 	Insert(ctx context.Context, userID int64, ttl time.Duration, scope string) (models.Token, error)
 	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+	Delete(ctx context.Context, scope string, tokenPlaintext string) error
+}
+
+type JWTService interface {
+	NewAuthenticationToken(ctx context.Context, user models.User, orgID int64) (models.Token, error)
+	VerifyAuthenticationToken(ctx context.Context, token string) (models.User, permissionsmodels.Permissions, int64, error)
+	Revoke(ctx context.Context, token string) error
 }
 
 type createUserInput struct {
@@ -45,6 +58,11 @@ type tokenInput struct {
 	TokenPlaintext string `json:"token" db:"name"`
 }
 
+type updateUserInput struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
 func New(logger *jsonlog.Logger, version, env string) *Handler {
 	return &Handler{
 		Logger:  logger,
@@ -68,13 +86,25 @@ func (h *Handler) AddUser() func(c *gin.Context) {
 			Email:     userInput.Email,
 			Activated: false,
 		}
+
+		// The policy runs before hashing, which fails on over long passwords
+		v := validator.New()
+		err = models.ValidateNewPassword(v, userInput.Password, user)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+		if !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
 		err = user.Password.Set(userInput.Password)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 			return
 		}
 
-		v := validator.New()
 		if !fieldsAreValid(c, v, user) {
 			httphelpers.StatusUnprocesableEntities(c, v.Errors)
 			return
@@ -82,7 +112,11 @@ func (h *Handler) AddUser() func(c *gin.Context) {
 
 		user, err = h.UserService.AddUser(c, user)
 		if err != nil {
+			var violation *emailpolicy.Violation
 			switch {
+			case errors.As(err, &violation):
+				v.AddError("email", violation.Reason)
+				httphelpers.StatusUnprocesableEntities(c, v.Errors)
 			case errors.Is(err, serviceerrors.ErrDuplicateEmail):
 				v.AddError("email", "a user with this email address already exists")
 				httphelpers.StatusUnprocesableEntities(c, v.Errors)
@@ -96,7 +130,7 @@ func (h *Handler) AddUser() func(c *gin.Context) {
 			return
 		}
 
-		err = httphelpers.WriteJSON(c, http.StatusAccepted, gin.H{"user": user}, nil)
+		err = httphelpers.WriteResponse(c, http.StatusAccepted, gin.H{"user": user}, nil)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 		}
@@ -122,7 +156,7 @@ func (h *Handler) ActivateUser() func(c *gin.Context) {
 
 		v := validator.New()
 		if models.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
-			httphelpers.StatusBadRequestJSONPayloadResponse(c, v.Errors)
+			httphelpers.StatusBadRequestErrorsResponse(c, v.Errors)
 			return
 		}
 
@@ -131,7 +165,7 @@ func (h *Handler) ActivateUser() func(c *gin.Context) {
 			switch {
 			case errors.Is(err, serviceerrors.ErrTokenNotFound):
 				v.AddError("token", "invalid or expired activation token")
-				httphelpers.StatusBadRequestJSONPayloadResponse(c, v.Errors)
+				httphelpers.StatusBadRequestErrorsResponse(c, v.Errors)
 			default:
 				httphelpers.StatusInternalServerErrorResponse(c, err)
 			}
@@ -158,19 +192,123 @@ func (h *Handler) ActivateUser() func(c *gin.Context) {
 			return
 		}
 
-		err = httphelpers.WriteJSON(c, http.StatusOK, gin.H{"user": user}, nil)
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"user": user}, nil)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 		}
 	}
 }
 
-func (h *Handler) GetUserByEmail() func(c *gin.Context) {
+// UpdateUser changes the profile of the authenticated user. A new email is only
+// recorded as pending, the change happens once the address confirms it.
+func (h *Handler) UpdateUser() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		contextUser, err := httphelpers.ContextGetUser(c)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		var input updateUserInput
+		err = httphelpers.ReadJSON(c, &input)
+		if err != nil {
+			httphelpers.StatusBadRequestResponse(c, err.Error())
+			return
+		}
+
+		user, err := h.UserService.GetUser(c, contextUser.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrUserNotFound):
+				httphelpers.StatusNotFoundResponse(c)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		if input.Name != nil {
+			user.Name = *input.Name
+		}
+
+		v := validator.New()
+		models.ValidateUser(v, &user)
+		if input.Email != nil {
+			models.ValidateEmail(v, *input.Email)
+		}
+		if !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		status := http.StatusOK
+		if input.Email != nil && *input.Email != user.Email {
+			user, err = h.UserService.RequestEmailChange(c, user, *input.Email)
+			status = http.StatusAccepted
+		} else {
+			user, err = h.UserService.UpdateUser(c, user)
+		}
+		if err != nil {
+			var violation *emailpolicy.Violation
+			switch {
+			case errors.As(err, &violation):
+				v.AddError("email", violation.Reason)
+				httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			case errors.Is(err, serviceerrors.ErrDuplicateEmail):
+				v.AddError("email", "a user with this email address already exists")
+				httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			case errors.Is(err, serviceerrors.ErrEditConflict):
+				httphelpers.StatusConflictResponse(c)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, status, gin.H{"user": user}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
 	}
 }
 
-func (h *Handler) UpdateUser() func(c *gin.Context) {
+// ConfirmEmailChange applies a pending email change with the token mailed to the new address
+func (h *Handler) ConfirmEmailChange() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		var input tokenInput
+
+		err := httphelpers.ReadJSON(c, &input)
+		if err != nil {
+			httphelpers.StatusBadRequestResponse(c, err.Error())
+			return
+		}
+
+		v := validator.New()
+		if models.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+			httphelpers.StatusBadRequestErrorsResponse(c, v.Errors)
+			return
+		}
+
+		user, err := h.UserService.ConfirmEmailChange(c, input.TokenPlaintext)
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrTokenNotFound):
+				v.AddError("token", "invalid or expired email change token")
+				httphelpers.StatusBadRequestErrorsResponse(c, v.Errors)
+			case errors.Is(err, serviceerrors.ErrDuplicateEmail):
+				v.AddError("email", "a user with this email address already exists")
+				httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			case errors.Is(err, serviceerrors.ErrEditConflict):
+				httphelpers.StatusConflictResponse(c)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"user": user}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
 	}
 }
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/validator"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MFAService interface {
+	Enrol(ctx context.Context, user models.User) (models.TOTPEnrolment, error)
+	Confirm(ctx context.Context, userID int64, code string) error
+	IsEnabled(ctx context.Context, userID int64) (bool, error)
+	Verify(ctx context.Context, userID int64, code, recoveryCode string) error
+}
+
+type MFAHandler struct {
+	Logger     *jsonlog.Logger
+	Version    string
+	Env        string
+	MFAService MFAService
+}
+
+type totpCodeInput struct {
+	Code string `json:"code"`
+}
+
+func (h *MFAHandler) EnrolTOTP() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, err := httphelpers.ContextGetUser(c)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+		if user.IsAnonymous() {
+			httphelpers.StatusUnauthorizedResponse(c)
+			return
+		}
+
+		enrolment, err := h.MFAService.Enrol(c, user)
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrMFAAlreadyEnabled):
+				httphelpers.StatusConflictResponse(c)
+			case errors.Is(err, serviceerrors.ErrMFAUnavailable):
+				httphelpers.ProblemResponse(c, httphelpers.CodeMFANotConfigured, err.Error())
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusCreated, gin.H{"totp": enrolment}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
+
+func (h *MFAHandler) ConfirmTOTP() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		user, err := httphelpers.ContextGetUser(c)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+		if user.IsAnonymous() {
+			httphelpers.StatusUnauthorizedResponse(c)
+			return
+		}
+
+		var input totpCodeInput
+		err = httphelpers.ReadJSON(c, &input)
+		if err != nil {
+			httphelpers.StatusBadRequestResponse(c, err.Error())
+			return
+		}
+
+		v := validator.New()
+		if models.ValidateTOTPCode(v, input.Code); !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		err = h.MFAService.Confirm(c, user.ID, input.Code)
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrMFANotEnrolled):
+				httphelpers.StatusNotFoundResponse(c)
+			case errors.Is(err, serviceerrors.ErrMFAAlreadyEnabled):
+				httphelpers.StatusConflictResponse(c)
+			case errors.Is(err, serviceerrors.ErrInvalidMFACode):
+				v.AddError("code", "invalid or already used code")
+				httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			case errors.Is(err, serviceerrors.ErrMFAUnavailable):
+				httphelpers.ProblemResponse(c, httphelpers.CodeMFANotConfigured, err.Error())
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"message": "two-factor authentication enabled"}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+	}
+}
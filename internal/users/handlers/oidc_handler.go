@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/emailpolicy"
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/jsonlog"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OIDCService interface {
+	BeginLogin(ctx context.Context, providerName string) (string, error)
+	CompleteLogin(ctx context.Context, providerName, state, code string) (models.User, error)
+}
+
+type OIDCHandler struct {
+	Logger         *jsonlog.Logger
+	Version        string
+	Env            string
+	OIDCService    OIDCService
+	TokenService   TokenService
+	JWTService     JWTService
+	MFAService     MFAService
+	LockoutService LockoutService
+}
+
+func (h *OIDCHandler) BeginLogin() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authURL, err := h.OIDCService.BeginLogin(c, c.Param("provider"))
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrUnknownProvider):
+				httphelpers.StatusNotFoundResponse(c)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+func (h *OIDCHandler) Callback() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		qs := c.Request.URL.Query()
+
+		if qs.Get("error") != "" {
+			httphelpers.ProblemResponse(c, httphelpers.CodeUnauthorized, "the identity provider refused the login: "+qs.Get("error"))
+			return
+		}
+
+		state := httphelpers.ReadString(qs, "state", "")
+		code := httphelpers.ReadString(qs, "code", "")
+		if state == "" || code == "" {
+			httphelpers.StatusBadRequestResponse(c, "state and code must be provided")
+			return
+		}
+
+		user, err := h.OIDCService.CompleteLogin(c, c.Param("provider"), state, code)
+		if err != nil {
+			var violation *emailpolicy.Violation
+			switch {
+			case errors.As(err, &violation):
+				httphelpers.ProblemResponse(c, httphelpers.CodeForbidden, "the email address "+violation.Reason)
+			case errors.Is(err, serviceerrors.ErrUnknownProvider):
+				httphelpers.StatusNotFoundResponse(c)
+			case errors.Is(err, serviceerrors.ErrInvalidOIDCState):
+				httphelpers.StatusBadRequestResponse(c, err.Error())
+			case errors.Is(err, serviceerrors.ErrOIDCLoginFailed):
+				httphelpers.StatusUnauthorizedResponse(c)
+			case errors.Is(err, serviceerrors.ErrAccountDisabled):
+				httphelpers.ProblemResponse(c, httphelpers.CodeAccountDisabled, err.Error())
+			case errors.Is(err, serviceerrors.ErrAccountExists):
+				httphelpers.ProblemResponse(c, httphelpers.CodeAccountExists, err.Error())
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		// A locked account stays locked whichever way the user signs in
+		retryAfter, err := h.LockoutService.Check(c, user.Email, httphelpers.RemoteIP(c))
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrLoginThrottled):
+				httphelpers.LoginThrottledResponse(c, retryAfter)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		if challengeMFA(c, h.MFAService, h.TokenService, user) {
+			return
+		}
+
+		writeAuthToken(c, h.TokenService, h.JWTService, user, 0)
+	}
+}
@@ -0,0 +1,599 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	orgmodels "greenlight/internal/organizations/models"
+	"greenlight/internal/users/handlers"
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+	"greenlight/internal/users/service"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/emailpolicy"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/oidc"
+	"greenlight/pkg/oidc/oidctest"
+
+	"github.com/gin-gonic/gin"
+)
+
+const callbackURL = "http://api.test/oidc/test/callback"
+
+type oidcFixture struct {
+	t        *testing.T
+	provider *oidctest.Provider
+	engine   *gin.Engine
+	users    *fakeUserRepo
+	orgs     *fakeOrganizationService
+	tokens   *fakeTokenService
+	mfa      *fakeMFAService
+	noFollow *http.Client
+}
+
+func newOIDCFixture(t *testing.T, user oidctest.User) *oidcFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	provider, err := oidctest.NewProvider("greenlight", "secret", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(provider.Close)
+
+	f := &oidcFixture{
+		t:        t,
+		provider: provider,
+		users:    &fakeUserRepo{byEmail: map[string]models.User{}, identities: newFakeIdentityRepo()},
+		orgs:     &fakeOrganizationService{owners: map[int64]int{}},
+		tokens:   &fakeTokenService{},
+		mfa:      &fakeMFAService{enabled: map[int64]bool{}},
+		noFollow: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+
+	logger := jsonlog.New(io.Discard, jsonlog.LevelOff)
+	client := oidc.NewClient(provider.Config("test", callbackURL), nil)
+	oidcService := service.NewOIDCService([]*oidc.Client{client}, f.users.identities, f.users,
+		fakePermissionsService{}, f.orgs, emailpolicy.New(emailpolicy.Config{BlockDisposable: true}), logger)
+
+	h := &handlers.OIDCHandler{
+		Logger:         logger,
+		OIDCService:    oidcService,
+		TokenService:   f.tokens,
+		MFAService:     f.mfa,
+		LockoutService: fakeLockoutService{},
+	}
+
+	f.engine = gin.New()
+	f.engine.GET("/oidc/:provider/login", h.BeginLogin())
+	f.engine.GET("/oidc/:provider/callback", h.Callback())
+
+	return f
+}
+
+// authorize starts a login and lets the provider sign the user in, returning
+// the callback query. tamper may change the authorization request first.
+func (f *oidcFixture) authorize(tamper func(url.Values)) url.Values {
+	f.t.Helper()
+
+	rr := httptest.NewRecorder()
+	f.engine.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/oidc/test/login", nil))
+	if rr.Code != http.StatusFound {
+		f.t.Fatalf("login: got status %d, want %d: %s", rr.Code, http.StatusFound, rr.Body)
+	}
+
+	authURL, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if tamper != nil {
+		qs := authURL.Query()
+		tamper(qs)
+		authURL.RawQuery = qs.Encode()
+	}
+
+	res, err := f.noFollow.Get(authURL.String())
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		f.t.Fatalf("authorize: got status %d, want %d", res.StatusCode, http.StatusFound)
+	}
+
+	redirect, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	return redirect.Query()
+}
+
+func (f *oidcFixture) callback(qs url.Values) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	f.engine.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/oidc/test/callback?"+qs.Encode(), nil))
+	return rr
+}
+
+func problemCode(t *testing.T, rr *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var problem struct {
+		Code string `json:"code"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &problem)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", rr.Body, err)
+	}
+
+	return problem.Code
+}
+
+var alice = oidctest.User{
+	Subject:       "alice-subject",
+	Email:         "alice@example.com",
+	EmailVerified: true,
+	Name:          "Alice",
+}
+
+func TestOIDCFirstLoginCreatesUser(t *testing.T) {
+	f := newOIDCFixture(t, alice)
+
+	rr := f.callback(f.authorize(nil))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	user, ok := f.users.byEmail[alice.Email]
+	if !ok {
+		t.Fatal("no user was created")
+	}
+	if user.Name != alice.Name || !user.Activated {
+		t.Errorf("got user %+v, want an activated user named %q", user, alice.Name)
+	}
+	if got := f.tokens.issuedTo(); len(got) != 1 || got[0] != user.ID {
+		t.Errorf("got tokens issued to %v, want [%d]", got, user.ID)
+	}
+	if got := f.orgs.owners[user.ID]; got != 1 {
+		t.Errorf("got %d organizations for the new user, want 1", got)
+	}
+}
+
+func TestOIDCRepeatLoginMapsToSameUser(t *testing.T) {
+	f := newOIDCFixture(t, alice)
+
+	for i := 0; i < 2; i++ {
+		rr := f.callback(f.authorize(nil))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("login %d: got status %d, want %d: %s", i, rr.Code, http.StatusCreated, rr.Body)
+		}
+	}
+
+	if len(f.users.byEmail) != 1 {
+		t.Fatalf("got %d users, want 1", len(f.users.byEmail))
+	}
+	if got := f.tokens.issuedTo(); len(got) != 2 || got[0] != got[1] {
+		t.Errorf("got tokens issued to %v, want twice the same user", got)
+	}
+	if got := f.orgs.owners[f.users.byEmail[alice.Email].ID]; got != 1 {
+		t.Errorf("got %d organizations for the user, want 1", got)
+	}
+}
+
+// TestOIDCFailedSignupCanRetry fails the signup after the user row is written,
+// and expects it removed so that the next login signs up again
+func TestOIDCFailedSignupCanRetry(t *testing.T) {
+	f := newOIDCFixture(t, alice)
+	f.orgs.err = errors.New("organizations unavailable")
+
+	rr := f.callback(f.authorize(nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("failed signup: got status %d, want %d: %s", rr.Code, http.StatusInternalServerError, rr.Body)
+	}
+	if len(f.users.byEmail) != 0 {
+		t.Fatalf("the failed signup left %d users behind", len(f.users.byEmail))
+	}
+
+	rr = f.callback(f.authorize(nil))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("retry: got status %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+	if got := f.tokens.issuedTo(); len(got) != 1 || got[0] != f.users.byEmail[alice.Email].ID {
+		t.Errorf("got tokens issued to %v, want the new user", got)
+	}
+}
+
+func TestOIDCStateMismatch(t *testing.T) {
+	f := newOIDCFixture(t, alice)
+
+	qs := f.authorize(nil)
+	qs.Set("state", "not-the-state-we-sent")
+
+	rr := f.callback(qs)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", rr.Code, http.StatusBadRequest, rr.Body)
+	}
+	if len(f.users.byEmail) != 0 {
+		t.Error("a user was created")
+	}
+}
+
+func TestOIDCStateReplay(t *testing.T) {
+	f := newOIDCFixture(t, alice)
+
+	qs := f.authorize(nil)
+	if rr := f.callback(qs); rr.Code != http.StatusCreated {
+		t.Fatalf("first callback: got status %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+
+	rr := f.callback(qs)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("replayed callback: got status %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOIDCNonceMismatch(t *testing.T) {
+	f := newOIDCFixture(t, alice)
+
+	qs := f.authorize(func(qs url.Values) {
+		qs.Set("nonce", "not-the-nonce-we-sent")
+	})
+
+	rr := f.callback(qs)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d: %s", rr.Code, http.StatusUnauthorized, rr.Body)
+	}
+	if len(f.users.byEmail) != 0 {
+		t.Error("a user was created")
+	}
+}
+
+func TestOIDCUnverifiedEmail(t *testing.T) {
+	unverified := alice
+	unverified.EmailVerified = false
+	f := newOIDCFixture(t, unverified)
+
+	rr := f.callback(f.authorize(nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d: %s", rr.Code, http.StatusUnauthorized, rr.Body)
+	}
+	if len(f.users.byEmail) != 0 {
+		t.Error("a user was created")
+	}
+}
+
+func TestOIDCEmailPolicy(t *testing.T) {
+	disposable := alice
+	disposable.Email = "alice@mailinator.com"
+	f := newOIDCFixture(t, disposable)
+
+	rr := f.callback(f.authorize(nil))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d: %s", rr.Code, http.StatusForbidden, rr.Body)
+	}
+	if len(f.users.byEmail) != 0 {
+		t.Error("a user was created")
+	}
+}
+
+func TestOIDCExistingEmailIsNotLinked(t *testing.T) {
+	f := newOIDCFixture(t, alice)
+	existing, err := f.users.Insert(context.Background(), models.User{Name: "Local Alice", Email: alice.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := f.callback(f.authorize(nil))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("got status %d, want %d: %s", rr.Code, http.StatusConflict, rr.Body)
+	}
+	if code := problemCode(t, rr); code != "account_exists" {
+		t.Errorf("got code %q, want account_exists", code)
+	}
+	if got := f.tokens.issuedTo(); len(got) != 0 {
+		t.Errorf("tokens were issued to %v for the existing user %d", got, existing.ID)
+	}
+}
+
+func TestOIDCLoginRequiresMFA(t *testing.T) {
+	f := newOIDCFixture(t, alice)
+
+	if rr := f.callback(f.authorize(nil)); rr.Code != http.StatusCreated {
+		t.Fatalf("first login: got status %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+	f.mfa.enabled[f.users.byEmail[alice.Email].ID] = true
+
+	rr := f.callback(f.authorize(nil))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, want %d: %s", rr.Code, http.StatusAccepted, rr.Body)
+	}
+	if !strings.Contains(rr.Body.String(), `"mfa_token"`) {
+		t.Errorf("got body %s, want an mfa_token", rr.Body)
+	}
+	if scopes := f.tokens.scopes(); scopes[len(scopes)-1] != models.ScopeMFAPending {
+		t.Errorf("got token scopes %v, want the last one to be %q", scopes, models.ScopeMFAPending)
+	}
+}
+
+type fakeIdentityRepo struct {
+	mu         sync.Mutex
+	identities map[string]int64
+	states     map[string]models.OIDCLoginState
+	users      map[int64]models.User
+}
+
+func newFakeIdentityRepo() *fakeIdentityRepo {
+	return &fakeIdentityRepo{
+		identities: map[string]int64{},
+		states:     map[string]models.OIDCLoginState{},
+		users:      map[int64]models.User{},
+	}
+}
+
+func (r *fakeIdentityRepo) Insert(ctx context.Context, identity models.Identity) (models.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identity.Provider + "|" + identity.Subject
+	if _, ok := r.identities[key]; ok {
+		return models.Identity{}, repoerrors.ErrDuplicateIdentity
+	}
+	r.identities[key] = identity.UserID
+	r.users[identity.UserID] = models.User{ID: identity.UserID, Email: identity.Email}
+
+	return identity, nil
+}
+
+func (r *fakeIdentityRepo) deleteUser(userID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, id := range r.identities {
+		if id == userID {
+			delete(r.identities, key)
+		}
+	}
+	delete(r.users, userID)
+}
+
+func (r *fakeIdentityRepo) GetUser(ctx context.Context, provider, subject string) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	userID, ok := r.identities[provider+"|"+subject]
+	if !ok {
+		return models.User{}, repoerrors.ErrIdentityNotFound
+	}
+
+	return r.users[userID], nil
+}
+
+func (r *fakeIdentityRepo) InsertState(ctx context.Context, state models.OIDCLoginState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states[string(state.Hash)] = state
+	return nil
+}
+
+func (r *fakeIdentityRepo) ConsumeState(ctx context.Context, hash []byte, provider string,
+) (models.OIDCLoginState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.states[string(hash)]
+	delete(r.states, string(hash))
+	if !ok || state.Provider != provider || time.Now().After(state.Expiry) {
+		return models.OIDCLoginState{}, repoerrors.ErrOIDCStateNotFound
+	}
+
+	return state, nil
+}
+
+type fakeUserRepo struct {
+	mu      sync.Mutex
+	nextID  int64
+	byEmail map[string]models.User
+	// identities lose their user on Delete, as the foreign key cascades
+	identities *fakeIdentityRepo
+}
+
+func (r *fakeUserRepo) Insert(ctx context.Context, user models.User) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.byEmail[user.Email]; ok {
+		return models.User{}, repoerrors.ErrDuplicateEmail
+	}
+	r.nextID++
+	user.ID = r.nextID
+	r.byEmail[user.Email] = user
+
+	return user, nil
+}
+
+func (r *fakeUserRepo) Get(ctx context.Context, id int64) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.byEmail {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+
+	return models.User{}, repoerrors.ErrUserNotFound
+}
+
+func (r *fakeUserRepo) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.byEmail[email]
+	if !ok {
+		return models.User{}, repoerrors.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (r *fakeUserRepo) Update(ctx context.Context, user models.User) (models.User, error) {
+	return user, nil
+}
+
+func (r *fakeUserRepo) UpdatePasswordHash(ctx context.Context, id int64, hash []byte) error {
+	return nil
+}
+
+func (r *fakeUserRepo) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for email, user := range r.byEmail {
+		if user.ID == id {
+			delete(r.byEmail, email)
+			r.identities.deleteUser(id)
+			return nil
+		}
+	}
+
+	return repoerrors.ErrUserNotFound
+}
+
+func (r *fakeUserRepo) GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string,
+) (models.User, error) {
+	return models.User{}, repoerrors.ErrTokenNotFound
+}
+
+type fakePermissionsService struct{}
+
+func (fakePermissionsService) AssignDefaultRole(ctx context.Context, userID int64) error {
+	return nil
+}
+
+type fakeOrganizationService struct {
+	mu     sync.Mutex
+	owners map[int64]int
+	// err fails the next AddOrganization
+	err error
+}
+
+func (s *fakeOrganizationService) AddOrganization(ctx context.Context, userID int64, org orgmodels.Organization,
+) (orgmodels.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.err; err != nil {
+		s.err = nil
+		return orgmodels.Organization{}, err
+	}
+
+	s.owners[userID]++
+	org.ID = int64(len(s.owners))
+
+	return org, nil
+}
+
+type fakeTokenService struct {
+	mu     sync.Mutex
+	issued []models.Token
+}
+
+func (s *fakeTokenService) Insert(ctx context.Context, userID int64, ttl time.Duration, scope string,
+) (models.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := models.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return models.Token{}, err
+	}
+	s.issued = append(s.issued, token)
+
+	return token, nil
+}
+
+func (s *fakeTokenService) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	return nil
+}
+
+func (s *fakeTokenService) Delete(ctx context.Context, scope string, tokenPlaintext string) error {
+	return nil
+}
+
+// issuedTo returns the users that got an authentication token, in order
+func (s *fakeTokenService) issuedTo() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []int64
+	for _, token := range s.issued {
+		if token.Scope == models.ScopeAuthentication {
+			ids = append(ids, token.UserID)
+		}
+	}
+
+	return ids
+}
+
+func (s *fakeTokenService) scopes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scopes := make([]string, len(s.issued))
+	for i, token := range s.issued {
+		scopes[i] = token.Scope
+	}
+
+	return scopes
+}
+
+type fakeMFAService struct {
+	enabled map[int64]bool
+	// code is the only TOTP code Verify accepts, any code when empty
+	code string
+}
+
+func (s *fakeMFAService) Enrol(ctx context.Context, user models.User) (models.TOTPEnrolment, error) {
+	return models.TOTPEnrolment{}, nil
+}
+
+func (s *fakeMFAService) Confirm(ctx context.Context, userID int64, code string) error {
+	return nil
+}
+
+func (s *fakeMFAService) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	return s.enabled[userID], nil
+}
+
+func (s *fakeMFAService) Verify(ctx context.Context, userID int64, code, recoveryCode string) error {
+	if s.code != "" && code != s.code {
+		return serviceerrors.ErrInvalidMFACode
+	}
+	return nil
+}
+
+type fakeLockoutService struct{}
+
+func (fakeLockoutService) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	return 0, nil
+}
+
+func (fakeLockoutService) RecordFailure(ctx context.Context, email, ip string, user models.User) error {
+	return nil
+}
+
+func (fakeLockoutService) RecordSuccess(ctx context.Context, email string) error {
+	return nil
+}
@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"greenlight/internal/users/models"
 	"greenlight/internal/users/serviceerrors"
 	"greenlight/pkg/httphelpers"
 	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/jwt"
 	"greenlight/pkg/validator"
 
 	"github.com/gin-gonic/gin"
@@ -17,6 +21,8 @@ import (
 type userInput struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// OrganizationID optionally binds the token to one organization
+	OrganizationID int64 `json:"organization_id"`
 }
 
 type TokenHandler struct {
@@ -25,6 +31,29 @@ type TokenHandler struct {
 	Env          string
 	TokenService TokenService
 	UserService  UserService
+	// JWTService issues stateless tokens when set, opaque tokens are used otherwise
+	JWTService     JWTService
+	MFAService     MFAService
+	LockoutService LockoutService
+	// OrganizationService checks the membership of tokens bound to an organization
+	OrganizationService OrganizationService
+}
+
+type OrganizationService interface {
+	IsMember(ctx context.Context, orgID, userID int64) (bool, error)
+}
+
+type LockoutService interface {
+	Check(ctx context.Context, email, ip string) (time.Duration, error)
+	RecordFailure(ctx context.Context, email, ip string, user models.User) error
+	RecordSuccess(ctx context.Context, email string) error
+}
+
+type mfaInput struct {
+	MFAToken       string `json:"mfa_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+	OrganizationID int64  `json:"organization_id"`
 }
 
 func (h *TokenHandler) CreateAuthToken() func(c *gin.Context) {
@@ -38,44 +67,283 @@ func (h *TokenHandler) CreateAuthToken() func(c *gin.Context) {
 
 		v := validator.New()
 		models.ValidateEmail(v, userInput.Email)
-		models.ValidatePasswordPlaintext(v, userInput.Password)
+		// Only new passwords are checked against the policy, the hash decides
+		// whether an existing one is right
+		v.Check(userInput.Password != "", "password", "must be provided")
+		h.validateOrganization(v, userInput.OrganizationID)
 
 		if !v.Valid() {
-			httphelpers.StatusBadRequestResponse(c, err.Error())
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
 			return
 		}
 
-		user, err := h.UserService.GetUserByEmail(c, userInput.Email)
+		ip := httphelpers.RemoteIP(c)
+
+		retryAfter, err := h.LockoutService.Check(c, userInput.Email, ip)
 		if err != nil {
 			switch {
-			case errors.Is(err, serviceerrors.ErrUserNotFound):
-				httphelpers.StatusNotFoundResponse(c)
+			case errors.Is(err, serviceerrors.ErrLoginThrottled):
+				httphelpers.LoginThrottledResponse(c, retryAfter)
 			default:
 				httphelpers.StatusInternalServerErrorResponse(c, err)
 			}
 			return
 		}
 
-		match, err := user.Password.Matches(userInput.Password)
-		if err != nil {
+		user, err := h.UserService.GetUserByEmail(c, userInput.Email)
+		if err != nil && !errors.Is(err, serviceerrors.ErrUserNotFound) {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 			return
 		}
+
+		match := false
+		if err == nil {
+			match, err = user.Password.Matches(userInput.Password)
+			if err != nil {
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+				return
+			}
+		} else {
+			models.SimulatePasswordMatch(userInput.Password)
+		}
+
 		if !match {
+			err = h.LockoutService.RecordFailure(c, userInput.Email, ip, user)
+			if err != nil {
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+				return
+			}
+
+			httphelpers.InvalidCredentialsResponse(c)
+			return
+		}
+
+		if user.Password.Rehashed() {
+			err = h.UserService.UpdatePasswordHash(c, user)
+			if err != nil {
+				// The old hash still works, the upgrade is retried on the next login
+				h.Logger.PrintError(err, map[string]string{"user_id": strconv.FormatInt(user.ID, 10)})
+			}
+		}
+
+		if user.IsDisabled() {
+			httphelpers.ProblemResponse(c, httphelpers.CodeAccountDisabled, serviceerrors.ErrAccountDisabled.Error())
+			return
+		}
+
+		// The failures are only cleared once a token is issued, with MFA that
+		// is after the second factor, so wrong codes count towards the lock
+		// however often the password is sent again
+		if challengeMFA(c, h.MFAService, h.TokenService, user) {
+			return
+		}
+
+		err = h.LockoutService.RecordSuccess(c, userInput.Email)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		h.writeAuthToken(c, user, userInput.OrganizationID)
+	}
+}
+
+// CreateMFAAuthToken exchanges the short-lived token returned by CreateAuthToken
+// plus a TOTP or recovery code for a real authentication token
+func (h *TokenHandler) CreateMFAAuthToken() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var input mfaInput
+		err := httphelpers.ReadJSON(c, &input)
+		if err != nil {
 			httphelpers.StatusBadRequestResponse(c, err.Error())
 			return
 		}
 
-		token, err := h.TokenService.Insert(c, user.ID, 24*time.Hour, models.ScopeAuthentication)
+		v := validator.New()
+		models.ValidateTokenPlaintext(v, input.MFAToken)
+		if input.RecoveryCode == "" {
+			models.ValidateTOTPCode(v, input.Code)
+		}
+		h.validateOrganization(v, input.OrganizationID)
+		if !v.Valid() {
+			httphelpers.StatusUnprocesableEntities(c, v.Errors)
+			return
+		}
+
+		user, err := h.UserService.GetForToken(c, models.ScopeMFAPending, input.MFAToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrTokenNotFound):
+				httphelpers.StatusUnauthorizedResponse(c)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		// The user may have been disabled since the password was checked
+		if user.IsDisabled() {
+			httphelpers.ProblemResponse(c, httphelpers.CodeAccountDisabled, serviceerrors.ErrAccountDisabled.Error())
+			return
+		}
+
+		ip := httphelpers.RemoteIP(c)
+
+		retryAfter, err := h.LockoutService.Check(c, user.Email, ip)
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrLoginThrottled):
+				httphelpers.LoginThrottledResponse(c, retryAfter)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		err = h.MFAService.Verify(c, user.ID, input.Code, input.RecoveryCode)
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrInvalidMFACode):
+				err = h.LockoutService.RecordFailure(c, user.Email, ip, user)
+				if err != nil {
+					httphelpers.StatusInternalServerErrorResponse(c, err)
+					return
+				}
+				httphelpers.InvalidCredentialsResponse(c)
+			case errors.Is(err, serviceerrors.ErrMFAUnavailable):
+				httphelpers.ProblemResponse(c, httphelpers.CodeMFAUnavailable, err.Error())
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		err = h.LockoutService.RecordSuccess(c, user.Email)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			return
+		}
+
+		err = h.TokenService.DeleteAllForUser(c, models.ScopeMFAPending, user.ID)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 			return
 		}
 
-		err = httphelpers.WriteJSON(c, http.StatusCreated, gin.H{"authentication_token": token}, nil)
+		h.writeAuthToken(c, user, input.OrganizationID)
+	}
+}
+
+// validateOrganization checks an organization requested at login. Only stateless
+// tokens can carry one, opaque tokens select it with the X-Organization-ID header.
+func (h *TokenHandler) validateOrganization(v *validator.Validator, orgID int64) {
+	if orgID == 0 {
+		return
+	}
+
+	v.Check(orgID > 0, "organization_id", "must be a positive integer")
+	v.Check(h.JWTService != nil, "organization_id", "is only supported with JWT tokens, send the X-Organization-ID header instead")
+}
+
+func (h *TokenHandler) writeAuthToken(c *gin.Context, user models.User, orgID int64) {
+	if orgID != 0 {
+		member, err := h.OrganizationService.IsMember(c, orgID, user.ID)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 			return
 		}
+
+		if !member {
+			httphelpers.StatusUnprocesableEntities(c, map[string]string{
+				"organization_id": "you are not a member of this organization",
+			})
+			return
+		}
+	}
+
+	writeAuthToken(c, h.TokenService, h.JWTService, user, orgID)
+}
+
+// challengeMFA answers with a short-lived token to exchange through
+// CreateMFAAuthToken when the user has two-factor authentication enabled, and
+// reports whether a response was written
+func challengeMFA(c *gin.Context, mfaService MFAService, tokenService TokenService, user models.User) bool {
+	enabled, err := mfaService.IsEnabled(c, user.ID)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return true
+	}
+
+	if !enabled {
+		return false
+	}
+
+	token, err := tokenService.Insert(c, user.ID, 5*time.Minute, models.ScopeMFAPending)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return true
+	}
+
+	err = httphelpers.WriteResponse(c, http.StatusAccepted, gin.H{"mfa_token": token}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+	return true
+}
+
+// writeAuthToken issues an authentication token and writes it as the response.
+// It is stateless, with the JWT service's lifetime, when jwtService is set, and
+// an opaque 24 hour token otherwise.
+func writeAuthToken(c *gin.Context, tokenService TokenService, jwtService JWTService, user models.User, orgID int64) {
+	var (
+		token models.Token
+		err   error
+	)
+	if jwtService != nil {
+		token, err = jwtService.NewAuthenticationToken(c, user, orgID)
+	} else {
+		token, err = tokenService.Insert(c, user.ID, 24*time.Hour, models.ScopeAuthentication)
+	}
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+		return
+	}
+
+	err = httphelpers.WriteResponse(c, http.StatusCreated, gin.H{"authentication_token": token}, nil)
+	if err != nil {
+		httphelpers.StatusInternalServerErrorResponse(c, err)
+	}
+}
+
+func (h *TokenHandler) DeleteAuthToken() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		headerParts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(headerParts) != 2 || strings.ToLower(headerParts[0]) != "bearer" {
+			httphelpers.StatusUnauthorizedResponse(c)
+			return
+		}
+
+		token := headerParts[1]
+
+		var err error
+		if h.JWTService != nil && jwt.LooksLikeJWT(token) {
+			err = h.JWTService.Revoke(c, token)
+		} else {
+			err = h.TokenService.Delete(c, models.ScopeAuthentication, token)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrInvalidToken), errors.Is(err, serviceerrors.ErrTokenNotFound):
+				httphelpers.StatusUnauthorizedResponse(c)
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			return
+		}
+
+		err = httphelpers.WriteResponse(c, http.StatusOK, gin.H{"message": "authentication token successfully revoked"}, nil)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
 	}
 }
@@ -0,0 +1,333 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"greenlight/internal/users/handlers"
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/service"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/mailer"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	alicePassword = "pa55word"
+	aliceCode     = "123456"
+)
+
+type tokenFixture struct {
+	t      *testing.T
+	engine *gin.Engine
+	tokens *fakeTokenService
+	users  *fakeUserService
+}
+
+func newTokenFixture(t *testing.T, policy service.LockoutPolicy) *tokenFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	user := models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Activated: true}
+	err := user.Password.Set(alicePassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &tokenFixture{t: t, tokens: &fakeTokenService{}}
+	f.users = &fakeUserService{user: user, tokens: f.tokens}
+
+	logger := jsonlog.New(io.Discard, jsonlog.LevelOff)
+	// Lock notifications fail to connect, which is only logged
+	lockout := service.NewLockoutService(newFakeThrottleRepo(), policy, logger,
+		mailer.New("127.0.0.1", 1, "", "", "greenlight@example.com"))
+
+	h := &handlers.TokenHandler{
+		Logger:         logger,
+		TokenService:   f.tokens,
+		UserService:    f.users,
+		MFAService:     &fakeMFAService{enabled: map[int64]bool{user.ID: true}, code: aliceCode},
+		LockoutService: lockout,
+	}
+
+	f.engine = gin.New()
+	f.engine.POST("/v1/tokens/authentication", h.CreateAuthToken())
+	f.engine.POST("/v1/tokens/mfa", h.CreateMFAAuthToken())
+
+	return f
+}
+
+func (f *tokenFixture) post(path string, body any) (*httptest.ResponseRecorder, map[string]any) {
+	f.t.Helper()
+
+	js, err := json.Marshal(body)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(js)))
+	r.Header.Set("Content-Type", "application/json")
+	r.RemoteAddr = "192.0.2.1:1234"
+	rr := httptest.NewRecorder()
+	f.engine.ServeHTTP(rr, r)
+
+	var response map[string]any
+	json.Unmarshal(rr.Body.Bytes(), &response)
+
+	return rr, response
+}
+
+// login sends the password and returns the pending MFA token
+func (f *tokenFixture) login() (string, int) {
+	f.t.Helper()
+
+	rr, response := f.post("/v1/tokens/authentication", map[string]any{
+		"email":    f.users.user.Email,
+		"password": alicePassword,
+	})
+	if rr.Code != http.StatusAccepted {
+		return "", rr.Code
+	}
+
+	mfaToken, _ := response["mfa_token"].(map[string]any)
+	token, _ := mfaToken["token"].(string)
+	if token == "" {
+		f.t.Fatalf("no mfa token in %s", rr.Body)
+	}
+
+	return token, rr.Code
+}
+
+// TestWrongCodesAcrossLoginsLock guesses one TOTP code per password login,
+// each login starting a fresh MFA challenge, and expects the account to lock
+func TestWrongCodesAcrossLoginsLock(t *testing.T) {
+	const maxFailures = 5
+
+	f := newTokenFixture(t, service.LockoutPolicy{
+		FreeAttempts:   100,
+		IPFreeAttempts: 100,
+		MaxFailures:    maxFailures,
+		LockDuration:   time.Hour,
+		Window:         time.Hour,
+	})
+
+	for i := 0; i < maxFailures; i++ {
+		mfaToken, status := f.login()
+		if status != http.StatusAccepted {
+			t.Fatalf("login %d: got status %d, want %d", i, status, http.StatusAccepted)
+		}
+
+		rr, _ := f.post("/v1/tokens/mfa", map[string]any{"mfa_token": mfaToken, "code": "000000"})
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: got status %d, want %d", i, rr.Code, http.StatusUnauthorized)
+		}
+	}
+
+	if _, status := f.login(); status != http.StatusTooManyRequests {
+		t.Fatalf("login after %d wrong codes: got status %d, want %d", maxFailures, status, http.StatusTooManyRequests)
+	}
+	if issued := f.tokens.issuedTo(); len(issued) != 0 {
+		t.Errorf("authentication tokens were issued to %v", issued)
+	}
+}
+
+// TestRightCodeClearsFailures checks that failures are cleared once a token is
+// issued after the second factor
+func TestRightCodeClearsFailures(t *testing.T) {
+	const maxFailures = 3
+
+	f := newTokenFixture(t, service.LockoutPolicy{
+		FreeAttempts:   100,
+		IPFreeAttempts: 100,
+		MaxFailures:    maxFailures,
+		LockDuration:   time.Hour,
+		Window:         time.Hour,
+	})
+
+	guess := func(code string) int {
+		mfaToken, status := f.login()
+		if status != http.StatusAccepted {
+			t.Fatalf("login: got status %d, want %d", status, http.StatusAccepted)
+		}
+		rr, _ := f.post("/v1/tokens/mfa", map[string]any{"mfa_token": mfaToken, "code": code})
+		return rr.Code
+	}
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < maxFailures-1; i++ {
+			if status := guess("000000"); status != http.StatusUnauthorized {
+				t.Fatalf("round %d, guess %d: got status %d, want %d", round, i, status, http.StatusUnauthorized)
+			}
+		}
+		if status := guess(aliceCode); status != http.StatusCreated {
+			t.Fatalf("round %d: got status %d for the right code, want %d", round, status, http.StatusCreated)
+		}
+	}
+}
+
+// TestMFADisabledDuringChallenge disables the user between the password and the
+// second factor
+func TestMFADisabledDuringChallenge(t *testing.T) {
+	f := newTokenFixture(t, service.LockoutPolicy{
+		FreeAttempts:   100,
+		IPFreeAttempts: 100,
+		MaxFailures:    5,
+		LockDuration:   time.Hour,
+		Window:         time.Hour,
+	})
+
+	mfaToken, status := f.login()
+	if status != http.StatusAccepted {
+		t.Fatalf("login: got status %d, want %d", status, http.StatusAccepted)
+	}
+
+	disabledAt := time.Now()
+	f.users.user.DisabledAt = &disabledAt
+
+	rr, response := f.post("/v1/tokens/mfa", map[string]any{"mfa_token": mfaToken, "code": aliceCode})
+	if rr.Code != http.StatusForbidden || response["code"] != "account_disabled" {
+		t.Fatalf("got status %d and code %v, want %d and account_disabled", rr.Code, response["code"], http.StatusForbidden)
+	}
+	if issued := f.tokens.issuedTo(); len(issued) != 0 {
+		t.Errorf("authentication tokens were issued to %v", issued)
+	}
+}
+
+type fakeUserService struct {
+	user   models.User
+	tokens *fakeTokenService
+}
+
+func (s *fakeUserService) AddUser(ctx context.Context, user models.User) (models.User, error) {
+	return user, nil
+}
+
+func (s *fakeUserService) GetUser(ctx context.Context, id int64) (models.User, error) {
+	if id != s.user.ID {
+		return models.User{}, serviceerrors.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *fakeUserService) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	if email != s.user.Email {
+		return models.User{}, serviceerrors.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *fakeUserService) UpdateUser(ctx context.Context, user models.User) (models.User, error) {
+	return user, nil
+}
+
+func (s *fakeUserService) UpdatePasswordHash(ctx context.Context, user models.User) error {
+	return nil
+}
+
+// GetForToken finds the user of the tokens the fake token service issued
+func (s *fakeUserService) GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string,
+) (models.User, error) {
+	s.tokens.mu.Lock()
+	defer s.tokens.mu.Unlock()
+
+	for _, token := range s.tokens.issued {
+		if token.Scope == tokenScope && token.Plaintext == tokenPlaintext && token.UserID == s.user.ID {
+			return s.user, nil
+		}
+	}
+
+	return models.User{}, serviceerrors.ErrTokenNotFound
+}
+
+func (s *fakeUserService) RequestEmailChange(ctx context.Context, user models.User, newEmail string,
+) (models.User, error) {
+	return user, nil
+}
+
+func (s *fakeUserService) ConfirmEmailChange(ctx context.Context, tokenPlaintext string) (models.User, error) {
+	return s.user, nil
+}
+
+// fakeThrottleRepo keeps login_throttles rows in memory
+type fakeThrottleRepo struct {
+	mu        sync.Mutex
+	throttles map[string]models.LoginThrottle
+	locks     map[string]time.Time
+}
+
+func newFakeThrottleRepo() *fakeThrottleRepo {
+	return &fakeThrottleRepo{
+		throttles: map[string]models.LoginThrottle{},
+		locks:     map[string]time.Time{},
+	}
+}
+
+func (r *fakeThrottleRepo) Get(ctx context.Context, key string) (models.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.throttles[key], nil
+}
+
+func (r *fakeThrottleRepo) RecordFailure(ctx context.Context, key string, window time.Duration,
+) (models.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	throttle := r.throttles[key]
+	throttle.Key = key
+	if time.Since(throttle.LastFailureAt) > window {
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = time.Now()
+	r.throttles[key] = throttle
+
+	return throttle, nil
+}
+
+func (r *fakeThrottleRepo) SetBlockedUntil(ctx context.Context, key string, blockedUntil time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	throttle := r.throttles[key]
+	throttle.BlockedUntil = blockedUntil
+	r.throttles[key] = throttle
+
+	return nil
+}
+
+func (r *fakeThrottleRepo) Lock(ctx context.Context, key string, lockedUntil time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Now().Before(r.locks[key]) {
+		return false, nil
+	}
+	r.locks[key] = lockedUntil
+
+	throttle := r.throttles[key]
+	throttle.BlockedUntil = lockedUntil
+	r.throttles[key] = throttle
+
+	return true, nil
+}
+
+func (r *fakeThrottleRepo) Reset(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.throttles, key)
+	delete(r.locks, key)
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"crypto/sha256"
+	"time"
+)
+
+type Identity struct {
+	ID        int64     `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UserID    int64     `json:"-" db:"user_id"`
+	Provider  string    `json:"provider" db:"provider"`
+	Subject   string    `json:"subject" db:"subject"`
+	Email     string    `json:"email" db:"email"`
+}
+
+// OIDCLoginState remembers what was sent to the provider, keyed by the hash of the
+// state parameter, until the user comes back through the callback
+type OIDCLoginState struct {
+	Hash         []byte    `db:"hash"`
+	Provider     string    `db:"provider"`
+	CodeVerifier string    `db:"code_verifier"`
+	Nonce        string    `db:"nonce"`
+	Expiry       time.Time `db:"expiry"`
+}
+
+func HashOIDCState(state string) []byte {
+	hash := sha256.Sum256([]byte(state))
+	return hash[:]
+}
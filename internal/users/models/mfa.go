@@ -0,0 +1,61 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"greenlight/pkg/validator"
+)
+
+const RecoveryCodesCount = 10
+
+type TOTP struct {
+	UserID           int64     `db:"user_id"`
+	CreatedAt        time.Time `db:"created_at"`
+	SecretCiphertext []byte    `db:"secret_ciphertext"`
+	Confirmed        bool      `db:"confirmed"`
+	LastUsedStep     int64     `db:"last_used_step"`
+}
+
+type TOTPEnrolment struct {
+	Secret          string   `json:"secret"`
+	ProvisioningURI string   `json:"provisioning_uri"`
+	RecoveryCodes   []string `json:"recovery_codes"`
+}
+
+// GenerateRecoveryCodes returns n one-time codes formatted as xxxxx-xxxxx along
+// with the hashes that get stored
+func GenerateRecoveryCodes(n int) ([]string, [][]byte, error) {
+	codes := make([]string, 0, n)
+	hashes := make([][]byte, 0, n)
+
+	for i := 0; i < n; i++ {
+		randomBytes := make([]byte, 7)
+
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))[:10]
+		code := encoded[:5] + "-" + encoded[5:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func HashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hash[:]
+}
+
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) == 6, "code", "must be 6 digits long")
+}
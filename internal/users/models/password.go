@@ -0,0 +1,302 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+
+	// bcrypt ignores anything past 72 bytes. argon2id has no such limit, and as
+	// it reads the password once its cost barely depends on the length, which the
+	// 1 MB request body limit bounds anyway.
+	bcryptMaxPasswordLength = 72
+)
+
+var ErrInvalidPasswordHash = errors.New("invalid password hash")
+
+// Argon2Params are the argon2id settings of new hashes. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// PasswordHashing selects how new passwords are hashed. Hashes made with another
+// algorithm or weaker settings keep verifying and are upgraded by Matches.
+type PasswordHashing struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// DefaultPasswordHashing uses argon2id with the OWASP recommended minimum of
+// 19 MiB, 2 iterations and 1 thread
+func DefaultPasswordHashing() PasswordHashing {
+	return PasswordHashing{
+		Algorithm:  AlgorithmArgon2id,
+		BcryptCost: 12,
+		Argon2: Argon2Params{
+			Memory:      19 * 1024,
+			Iterations:  2,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	}
+}
+
+var hashing = DefaultPasswordHashing()
+
+// SetPasswordHashing changes how new passwords are hashed. Call it at startup,
+// before serving requests.
+func SetPasswordHashing(h PasswordHashing) error {
+	switch h.Algorithm {
+	case AlgorithmBcrypt:
+		if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case AlgorithmArgon2id:
+		p := h.Argon2
+		if p.Memory < 8*uint32(p.Parallelism) || p.Iterations < 1 || p.Parallelism < 1 {
+			return errors.New("argon2id needs at least 1 iteration, 1 thread and 8 KiB of memory per thread")
+		}
+		if p.SaltLength < 8 || p.KeyLength < 16 {
+			return errors.New("argon2id needs a salt of at least 8 bytes and a key of at least 16 bytes")
+		}
+	default:
+		return fmt.Errorf("unknown password hashing algorithm %q", h.Algorithm)
+	}
+
+	hashing = h
+	return nil
+}
+
+// maxPasswordLength is the longest password new hashes support, zero if there
+// is no limit
+func maxPasswordLength() int {
+	if hashing.Algorithm == AlgorithmBcrypt {
+		return bcryptMaxPasswordLength
+	}
+	return 0
+}
+
+type Password struct {
+	Plaintext *string `json:"plain_text"`
+	Hash      []byte  `json:"hash"`
+	rehashed  bool
+}
+
+func (p Password) Value() (driver.Value, error) {
+	return p.Hash, nil
+}
+
+func (p *Password) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		p.Hash = v
+	case string:
+		p.Hash = []byte(v)
+	default:
+		return errors.New("incompatible type for Password")
+	}
+	return nil
+}
+
+// Set hashes plaintextPassword with the configured algorithm. argon2id hashes
+// are stored in the PHC string format, so they carry their own parameters.
+func (p *Password) Set(plaintextPassword string) error {
+	var (
+		hash []byte
+		err  error
+	)
+	switch hashing.Algorithm {
+	case AlgorithmArgon2id:
+		hash, err = hashArgon2id(plaintextPassword, hashing.Argon2)
+	default:
+		hash, err = bcrypt.GenerateFromPassword([]byte(plaintextPassword), hashing.BcryptCost)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.Plaintext = &plaintextPassword
+	p.Hash = hash
+
+	return nil
+}
+
+// Matches compares plaintextPassword with the hash, bcrypt or argon2id. When
+// they match and the hash does not use the configured algorithm and settings,
+// the password is hashed again and Rehashed reports true, so the caller can
+// store the new hash.
+func (p *Password) Matches(plaintextPassword string) (bool, error) {
+	var (
+		match       bool
+		needsRehash bool
+		err         error
+	)
+	if isArgon2id(p.Hash) {
+		match, needsRehash, err = compareArgon2id(p.Hash, plaintextPassword)
+	} else {
+		match, needsRehash, err = compareBcrypt(p.Hash, plaintextPassword)
+	}
+	if err != nil || !match {
+		return false, err
+	}
+
+	if needsRehash {
+		err = p.Set(plaintextPassword)
+		switch {
+		case errors.Is(err, bcrypt.ErrPasswordTooLong):
+			// Switched back to bcrypt, which cannot hash this password, keep the
+			// argon2id hash
+		case err != nil:
+			return true, err
+		default:
+			p.rehashed = true
+		}
+	}
+
+	return true, nil
+}
+
+// Rehashed reports whether the last successful Matches replaced the hash
+func (p Password) Rehashed() bool {
+	return p.rehashed
+}
+
+func compareBcrypt(hash []byte, plaintextPassword string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(plaintextPassword))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, false, nil
+		default:
+			return false, false, err
+		}
+	}
+
+	if hashing.Algorithm == AlgorithmArgon2id {
+		return true, true, nil
+	}
+
+	cost, err := bcrypt.Cost(hash)
+	return true, err == nil && cost < hashing.BcryptCost, nil
+}
+
+func isArgon2id(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$argon2id$"))
+}
+
+func hashArgon2id(plaintextPassword string, params Argon2Params) ([]byte, error) {
+	salt := make([]byte, params.SaltLength)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plaintextPassword), salt,
+		params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+
+	return []byte(encoded), nil
+}
+
+func compareArgon2id(hash []byte, plaintextPassword string) (bool, bool, error) {
+	params, salt, key, err := decodeArgon2id(string(hash))
+	if err != nil {
+		return false, false, err
+	}
+
+	other := argon2.IDKey([]byte(plaintextPassword), salt,
+		params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	if hashing.Algorithm != AlgorithmArgon2id {
+		// Never downgrade, bcrypt could not even hash some of these passwords
+		return true, false, nil
+	}
+
+	current := hashing.Argon2
+	outdated := params.Memory < current.Memory ||
+		params.Iterations < current.Iterations ||
+		params.Parallelism != current.Parallelism ||
+		uint32(len(salt)) < current.SaltLength ||
+		params.KeyLength < current.KeyLength
+
+	return true, outdated, nil
+}
+
+// decodeArgon2id parses $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return Argon2Params{}, nil, nil, ErrInvalidPasswordHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrInvalidPasswordHash
+	}
+
+	var params Argon2Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations < 1 || params.Parallelism < 1 {
+		return Argon2Params{}, nil, nil, ErrInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrInvalidPasswordHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+var (
+	dummyPassword     Password
+	dummyPasswordOnce sync.Once
+)
+
+// SimulatePasswordMatch spends the same time as Matches does against a real hash.
+// Call it when the account does not exist so response times do not reveal that.
+func SimulatePasswordMatch(plaintextPassword string) {
+	dummyPasswordOnce.Do(func() {
+		dummyPassword.Set("greenlight-dummy-password")
+	})
+
+	dummy := dummyPassword
+	dummy.Matches(plaintextPassword)
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"greenlight/pkg/validator"
+)
+
+// PasswordRule is one requirement of a password policy. Check returns the
+// message shown to the user when password is refused, or an empty string.
+type PasswordRule interface {
+	Check(password string, user User) (string, error)
+}
+
+// PasswordRuleFunc adapts a function to a PasswordRule
+type PasswordRuleFunc func(password string, user User) (string, error)
+
+func (f PasswordRuleFunc) Check(password string, user User) (string, error) {
+	return f(password, user)
+}
+
+// PasswordPolicy is the set of rules new passwords must follow. Logins only
+// check the length, so tightening the policy does not lock anyone out.
+type PasswordPolicy struct {
+	Rules []PasswordRule
+}
+
+// Validate adds the first refused rule to v. The error is only set when a rule
+// could not be evaluated, e.g. the breached password file is unreadable.
+func (p PasswordPolicy) Validate(v *validator.Validator, password string, user User) error {
+	for _, rule := range p.Rules {
+		message, err := rule.Check(password, user)
+		if err != nil {
+			return err
+		}
+		if message != "" {
+			v.AddError("password", message)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+var passwordPolicy = PasswordPolicy{}
+
+// SetPasswordPolicy replaces the policy applied by ValidateNewPassword. Call it
+// at startup, before serving requests.
+func SetPasswordPolicy(policy PasswordPolicy) {
+	passwordPolicy = policy
+}
+
+// ValidateNewPassword checks a password being set for user against the
+// length limits and the configured policy
+func ValidateNewPassword(v *validator.Validator, password string, user User) error {
+	ValidatePasswordPlaintext(v, password)
+	if !v.Valid() {
+		return nil
+	}
+
+	return passwordPolicy.Validate(v, password, user)
+}
+
+type CharClass int
+
+const (
+	ClassLower CharClass = iota
+	ClassUpper
+	ClassDigit
+	ClassSymbol
+)
+
+var charClassNames = map[CharClass]string{
+	ClassLower:  "lowercase letter",
+	ClassUpper:  "uppercase letter",
+	ClassDigit:  "digit",
+	ClassSymbol: "symbol",
+}
+
+// ParseCharClass reads the names used by flags: lower, upper, digit and symbol
+func ParseCharClass(name string) (CharClass, bool) {
+	switch name {
+	case "lower":
+		return ClassLower, true
+	case "upper":
+		return ClassUpper, true
+	case "digit":
+		return ClassDigit, true
+	case "symbol":
+		return ClassSymbol, true
+	}
+	return 0, false
+}
+
+func classOf(r rune) CharClass {
+	switch {
+	case unicode.IsLower(r):
+		return ClassLower
+	case unicode.IsUpper(r):
+		return ClassUpper
+	case unicode.IsDigit(r):
+		return ClassDigit
+	default:
+		return ClassSymbol
+	}
+}
+
+// RequireCharClasses refuses passwords missing any of classes
+func RequireCharClasses(classes ...CharClass) PasswordRule {
+	return PasswordRuleFunc(func(password string, _ User) (string, error) {
+		seen := map[CharClass]bool{}
+		for _, r := range password {
+			seen[classOf(r)] = true
+		}
+
+		for _, class := range classes {
+			if !seen[class] {
+				return "must contain at least one " + charClassNames[class], nil
+			}
+		}
+
+		return "", nil
+	})
+}
+
+// RejectPersonalInfo refuses passwords containing the user's name, or the
+// local part of their email, ignoring case. Parts shorter than 3 characters
+// are not checked.
+func RejectPersonalInfo() PasswordRule {
+	return PasswordRuleFunc(func(password string, user User) (string, error) {
+		lower := strings.ToLower(password)
+
+		parts := strings.Fields(strings.ToLower(user.Name))
+		if local, _, ok := strings.Cut(user.Email, "@"); ok {
+			parts = append(parts, strings.ToLower(local))
+		}
+
+		for _, part := range parts {
+			if len(part) >= 3 && strings.Contains(lower, part) {
+				return "must not contain your name or email address", nil
+			}
+		}
+
+		return "", nil
+	})
+}
+
+// BreachedPasswordChecker reports how many times a password appears in a
+// breach corpus
+type BreachedPasswordChecker interface {
+	Count(password string) (int, error)
+}
+
+// RejectBreached refuses passwords seen in a breach
+func RejectBreached(checker BreachedPasswordChecker) PasswordRule {
+	return PasswordRuleFunc(func(password string, _ User) (string, error) {
+		count, err := checker.Count(password)
+		if err != nil {
+			return "", err
+		}
+
+		if count > 0 {
+			return "has appeared in a data breach, please choose another one", nil
+		}
+
+		return "", nil
+	})
+}
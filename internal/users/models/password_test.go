@@ -0,0 +1,61 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"greenlight/pkg/validator"
+)
+
+func withPasswordHashing(t *testing.T, h PasswordHashing) {
+	t.Helper()
+
+	previous := hashing
+	err := SetPasswordHashing(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hashing = previous })
+}
+
+func TestPasswordLengthLimit(t *testing.T) {
+	long := strings.Repeat("p", 4096)
+
+	withPasswordHashing(t, DefaultPasswordHashing())
+
+	v := validator.New()
+	ValidatePasswordPlaintext(v, long)
+	if !v.Valid() {
+		t.Fatalf("argon2id refused a %d byte password: %v", len(long), v.Errors)
+	}
+
+	var p Password
+	err := p.Set(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match, err := p.Matches(long)
+	if err != nil || !match {
+		t.Fatalf("got %t, %v, want the long password to match", match, err)
+	}
+
+	bcryptHashing := DefaultPasswordHashing()
+	bcryptHashing.Algorithm = AlgorithmBcrypt
+	bcryptHashing.BcryptCost = 4
+	withPasswordHashing(t, bcryptHashing)
+
+	v = validator.New()
+	ValidatePasswordPlaintext(v, strings.Repeat("p", bcryptMaxPasswordLength+1))
+	if v.Valid() {
+		t.Fatalf("bcrypt accepted a password longer than %d bytes", bcryptMaxPasswordLength)
+	}
+
+	// The argon2id hash cannot be downgraded to bcrypt, but still matches
+	match, err = p.Matches(long)
+	if err != nil || !match {
+		t.Fatalf("got %t, %v, want the long password to match", match, err)
+	}
+	if p.Rehashed() {
+		t.Error("the argon2id hash was replaced")
+	}
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+type LoginThrottle struct {
+	Key           string    `db:"key"`
+	Failures      int       `db:"failures"`
+	LastFailureAt time.Time `db:"last_failure_at"`
+	BlockedUntil  time.Time `db:"blocked_until"`
+}
+
+func AccountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
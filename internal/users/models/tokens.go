@@ -13,6 +13,8 @@ const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
 	ScopePasswordReset  = "password-reset"
+	ScopeMFAPending     = "mfa-pending"
+	ScopeEmailChange    = "email-change"
 )
 
 type Token struct {
@@ -49,3 +51,9 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
 }
+
+type DeniedToken struct {
+	JTI    string    `db:"jti"`
+	UserID int64     `db:"user_id"`
+	Expiry time.Time `db:"expiry"`
+}
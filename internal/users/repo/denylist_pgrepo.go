@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type denylistRepo struct {
+	DB *sqlx.DB
+}
+
+func NewDenylistRepo(db *sqlx.DB) *denylistRepo {
+	return &denylistRepo{
+		DB: db,
+	}
+}
+
+func (r denylistRepo) Insert(ctx context.Context, token models.DeniedToken) error {
+	query := `
+        INSERT INTO token_denylist (jti, user_id, expiry)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (jti) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, token.JTI, token.UserID, token.Expiry)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `foreign key constraint "token_denylist_user_id_fkey"`):
+			return repoerrors.ErrUserNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r denylistRepo) GetActive(ctx context.Context) ([]models.DeniedToken, error) {
+	query := `
+        SELECT jti, user_id, expiry
+        FROM token_denylist
+        WHERE expiry > $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var tokens []models.DeniedToken
+
+	err := r.DB.SelectContext(ctx, &tokens, query, time.Now())
+	if err != nil {
+		return tokens, err
+	}
+
+	return tokens, nil
+}
+
+func (r denylistRepo) DeleteExpired(ctx context.Context) error {
+	query := `
+        DELETE FROM token_denylist
+        WHERE expiry <= $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, time.Now())
+	return err
+}
+
+// GetDisabledUserIDs returns the users whose stateless tokens must be refused
+func (r denylistRepo) GetDisabledUserIDs(ctx context.Context) ([]int64, error) {
+	query := `
+        SELECT id
+        FROM users
+        WHERE disabled_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var ids []int64
+
+	err := r.DB.SelectContext(ctx, &ids, query)
+	if err != nil {
+		return ids, err
+	}
+
+	return ids, nil
+}
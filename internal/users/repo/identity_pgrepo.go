@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type identityRepo struct {
+	DB *sqlx.DB
+}
+
+func NewIdentityRepo(db *sqlx.DB) *identityRepo {
+	return &identityRepo{
+		DB: db,
+	}
+}
+
+func (r identityRepo) Insert(ctx context.Context, identity models.Identity) (models.Identity, error) {
+	query := `
+        INSERT INTO identities (user_id, provider, subject, email)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at`
+
+	args := []any{identity.UserID, identity.Provider, identity.Subject, identity.Email}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.DB.GetContext(ctx, &identity, query, args...)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `unique constraint "identities_provider_subject_key"`):
+			return models.Identity{}, repoerrors.ErrDuplicateIdentity
+		case strings.Contains(err.Error(), `foreign key constraint "identities_user_id_fkey"`):
+			return models.Identity{}, repoerrors.ErrUserNotFound
+		default:
+			return models.Identity{}, err
+		}
+	}
+
+	return identity, nil
+}
+
+func (r identityRepo) GetUser(ctx context.Context, provider, subject string) (models.User, error) {
+	query := `
+        SELECT u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.disabled_at, u.version
+        FROM users AS u
+        INNER JOIN identities AS i
+        ON u.id = i.user_id
+        WHERE i.provider = $1 AND i.subject = $2`
+
+	var user models.User
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.DB.GetContext(ctx, &user, query, provider, subject)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.User{}, repoerrors.ErrIdentityNotFound
+		default:
+			return models.User{}, err
+		}
+	}
+
+	return user, nil
+}
+
+func (r identityRepo) InsertState(ctx context.Context, state models.OIDCLoginState) error {
+	query := `
+        INSERT INTO oidc_login_states (hash, provider, code_verifier, nonce, expiry)
+        VALUES ($1, $2, $3, $4, $5)`
+
+	args := []any{state.Hash, state.Provider, state.CodeVerifier, state.Nonce, state.Expiry}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ConsumeState deletes and returns the state, so a callback can only be replayed once
+func (r identityRepo) ConsumeState(ctx context.Context, hash []byte, provider string) (models.OIDCLoginState, error) {
+	query := `
+        DELETE FROM oidc_login_states
+        WHERE hash = $1 AND provider = $2 AND expiry > $3
+        RETURNING hash, provider, code_verifier, nonce, expiry`
+
+	var state models.OIDCLoginState
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.DB.GetContext(ctx, &state, query, hash, provider, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.OIDCLoginState{}, repoerrors.ErrOIDCStateNotFound
+		default:
+			return models.OIDCLoginState{}, err
+		}
+	}
+
+	return state, nil
+}
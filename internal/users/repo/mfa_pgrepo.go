@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type mfaRepo struct {
+	DB *sqlx.DB
+}
+
+func NewMFARepo(db *sqlx.DB) *mfaRepo {
+	return &mfaRepo{
+		DB: db,
+	}
+}
+
+// ReplaceTOTP stores a new, unconfirmed secret for the user and swaps the recovery
+// codes in the same transaction
+func (r mfaRepo) ReplaceTOTP(ctx context.Context, totp models.TOTP, recoveryHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO users_totp (user_id, secret_ciphertext)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE
+        SET secret_ciphertext = EXCLUDED.secret_ciphertext, confirmed = false,
+            last_used_step = 0, created_at = NOW()`
+
+	_, err = tx.ExecContext(ctx, query, totp.UserID, totp.SecretCiphertext)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, totp.UserID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryHashes {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO mfa_recovery_codes (hash, user_id) VALUES ($1, $2)`,
+			hash, totp.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r mfaRepo) GetTOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	query := `
+        SELECT user_id, created_at, secret_ciphertext, confirmed, last_used_step
+        FROM users_totp
+        WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var totp models.TOTP
+
+	err := r.DB.GetContext(ctx, &totp, query, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.TOTP{}, repoerrors.ErrMFANotEnrolled
+		default:
+			return models.TOTP{}, err
+		}
+	}
+
+	return totp, nil
+}
+
+// UseStep records step as the last accepted one and confirms the enrolment. A step
+// that is not newer than the recorded one is rejected, so a code works only once.
+func (r mfaRepo) UseStep(ctx context.Context, userID int64, step int64) error {
+	query := `
+        UPDATE users_totp
+        SET last_used_step = $2, confirmed = true
+        WHERE user_id = $1 AND last_used_step < $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repoerrors.ErrTOTPStepUsed
+	}
+
+	return nil
+}
+
+func (r mfaRepo) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) error {
+	query := `
+        UPDATE mfa_recovery_codes
+        SET used_at = NOW()
+        WHERE hash = $1 AND user_id = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, hash, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repoerrors.ErrRecoveryCode
+	}
+
+	return nil
+}
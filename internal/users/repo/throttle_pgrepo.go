@@ -0,0 +1,124 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight/internal/users/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type throttleRepo struct {
+	DB *sqlx.DB
+}
+
+func NewThrottleRepo(db *sqlx.DB) *throttleRepo {
+	return &throttleRepo{
+		DB: db,
+	}
+}
+
+// Get returns the throttle for key, or an empty one when nothing failed yet
+func (r throttleRepo) Get(ctx context.Context, key string) (models.LoginThrottle, error) {
+	query := `
+        SELECT key, failures, last_failure_at, blocked_until
+        FROM login_throttles
+        WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var throttle models.LoginThrottle
+
+	err := r.DB.GetContext(ctx, &throttle, query, key)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.LoginThrottle{Key: key}, nil
+		default:
+			return models.LoginThrottle{}, err
+		}
+	}
+
+	return throttle, nil
+}
+
+// RecordFailure increments the failure counter, starting over when the previous
+// failure is older than window
+func (r throttleRepo) RecordFailure(ctx context.Context, key string, window time.Duration) (models.LoginThrottle, error) {
+	query := `
+        INSERT INTO login_throttles (key, failures, last_failure_at)
+        VALUES ($1, 1, NOW())
+        ON CONFLICT (key) DO UPDATE
+        SET failures = CASE
+                WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+                ELSE login_throttles.failures + 1
+            END,
+            last_failure_at = NOW()
+        RETURNING key, failures, last_failure_at, blocked_until`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var throttle models.LoginThrottle
+
+	err := r.DB.GetContext(ctx, &throttle, query, key, window.Seconds())
+	if err != nil {
+		return models.LoginThrottle{}, err
+	}
+
+	return throttle, nil
+}
+
+func (r throttleRepo) SetBlockedUntil(ctx context.Context, key string, blockedUntil time.Time) error {
+	query := `
+        UPDATE login_throttles
+        SET blocked_until = $2
+        WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, key, blockedUntil)
+	return err
+}
+
+// Lock blocks key until lockedUntil and reports whether that started a new lock.
+// It does nothing while a previous lock is still running, so concurrent failures
+// start one lock only.
+func (r throttleRepo) Lock(ctx context.Context, key string, lockedUntil time.Time) (bool, error) {
+	query := `
+        UPDATE login_throttles
+        SET blocked_until = $2, locked_until = $2
+        WHERE key = $1 AND locked_until <= NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, key, lockedUntil)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (r throttleRepo) Reset(ctx context.Context, key string) error {
+	query := `
+        DELETE FROM login_throttles
+        WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, key)
+	return err
+}
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"crypto/sha256"
 	"strings"
 	"time"
 
@@ -67,3 +68,29 @@ func (r tokenRepo) DeleteAllForUser(ctx context.Context, scope string, userID in
 
 	return err
 }
+
+func (r tokenRepo) Delete(ctx context.Context, scope string, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+        DELETE FROM tokens
+        WHERE hash = $1 AND scope = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, tokenHash[:], scope)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repoerrors.ErrTokenNotFound
+	}
+
+	return nil
+}
@@ -59,7 +59,7 @@ func (r userRepo) Insert(ctx context.Context, user models.User) (models.User, er
 
 func (r userRepo) GetByEmail(ctx context.Context, email string) (models.User, error) {
 	query := `
-	SELECT id, created_at, name, email, password_hash, activated, version
+	SELECT id, created_at, name, email, password_hash, activated, disabled_at, pending_email, version
 	FROM users
 	WHERE email = $1`
 
@@ -68,7 +68,31 @@ func (r userRepo) GetByEmail(ctx context.Context, email string) (models.User, er
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := r.DB.GetContext(ctx, &user, query, user.Email)
+	err := r.DB.GetContext(ctx, &user, query, email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.User{}, repoerrors.ErrUserNotFound
+		default:
+			return models.User{}, err
+		}
+	}
+
+	return user, nil
+}
+
+func (r userRepo) Get(ctx context.Context, id int64) (models.User, error) {
+	query := `
+	SELECT id, created_at, name, email, password_hash, activated, disabled_at, pending_email, version
+	FROM users
+	WHERE id = $1`
+
+	var user models.User
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.DB.GetContext(ctx, &user, query, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -84,8 +108,8 @@ func (r userRepo) GetByEmail(ctx context.Context, email string) (models.User, er
 func (r userRepo) Update(ctx context.Context, user models.User) (models.User, error) {
 	query := `
 	UPDATE users 
-	SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-	WHERE id = $5 AND version = $6
+	SET name = $1, email = $2, password_hash = $3, activated = $4, pending_email = $5, version = version + 1
+	WHERE id = $6 AND version = $7
 	RETURNING version`
 
 	args := []any{
@@ -93,6 +117,7 @@ func (r userRepo) Update(ctx context.Context, user models.User) (models.User, er
 		user.Email,
 		user.Password,
 		user.Activated,
+		user.PendingEmail,
 		user.ID,
 		user.Version,
 	}
@@ -119,17 +144,108 @@ func (r userRepo) Update(ctx context.Context, user models.User) (models.User, er
 	return user, nil
 }
 
+func (r userRepo) UpdatePasswordHash(ctx context.Context, id int64, hash []byte) error {
+	query := `
+	UPDATE users
+	SET password_hash = $1
+	WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, hash, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repoerrors.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// Delete removes the user, their tokens, roles, identities and memberships are
+// removed with them
+func (r userRepo) Delete(ctx context.Context, id int64) error {
+	query := `
+	DELETE FROM users
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return repoerrors.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// GetForAuthenticationToken returns the user of an authentication token, and the
+// admin impersonating them through it, zero for the user's own tokens
+func (r userRepo) GetForAuthenticationToken(ctx context.Context, tokenPlaintext string) (models.User, int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+        SELECT u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.pending_email, u.version,
+            COALESCE(t.impersonator_id, 0) AS impersonator_id
+        FROM users AS u
+        INNER JOIN tokens as t
+        ON u.id = t.user_id
+        WHERE t.hash = $1
+        AND t.scope = $2
+        AND t.expiry > $3
+        AND u.disabled_at IS NULL`
+
+	args := []any{tokenHash[:], models.ScopeAuthentication, time.Now()}
+
+	var row struct {
+		models.User
+		ImpersonatorID int64 `db:"impersonator_id"`
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := r.DB.GetContext(ctx, &row, query, args...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return models.User{}, 0, repoerrors.ErrTokenNotFound
+		default:
+			return models.User{}, 0, err
+		}
+	}
+
+	return row.User, row.ImpersonatorID, nil
+}
+
 func (r userRepo) GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string) (models.User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-        SELECT u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.version
+        SELECT u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.pending_email, u.version
         FROM users AS u
         INNER JOIN tokens as t
         ON u.id = t.user_id
         WHERE t.hash = $1
         AND t.scope = $2 
-        AND t.expiry > $3`
+        AND t.expiry > $3
+        AND u.disabled_at IS NULL`
 
 	args := []any{tokenHash[:], tokenScope, time.Now()}
 
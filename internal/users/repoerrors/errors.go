@@ -5,11 +5,17 @@ import (
 )
 
 var (
-	ErrEditConflict   = errors.New("edit conflict")
-	ErrDuplicateEmail = errors.New("duplicate email")
-	ErrEmailRequired  = errors.New("email required")
-	ErrPswRequired    = errors.New("password required")
-	ErrUserNotFound   = errors.New("user not found")
-	ErrTokenNotFound  = errors.New("token not found")
-	ErrUserIdRequired = errors.New("user id required")
+	ErrEditConflict      = errors.New("edit conflict")
+	ErrDuplicateEmail    = errors.New("duplicate email")
+	ErrEmailRequired     = errors.New("email required")
+	ErrPswRequired       = errors.New("password required")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrTokenNotFound     = errors.New("token not found")
+	ErrUserIdRequired    = errors.New("user id required")
+	ErrMFANotEnrolled    = errors.New("mfa not enrolled")
+	ErrTOTPStepUsed      = errors.New("totp step already used")
+	ErrRecoveryCode      = errors.New("recovery code not found")
+	ErrIdentityNotFound  = errors.New("identity not found")
+	ErrDuplicateIdentity = errors.New("duplicate identity")
+	ErrOIDCStateNotFound = errors.New("oidc login state not found")
 )
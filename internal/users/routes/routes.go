@@ -2,31 +2,54 @@ package routes
 
 import (
 	"greenlight/internal/users/handlers"
+	"greenlight/pkg/authz"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler interface {
 	AddUser() func(c *gin.Context)
-	GetUserByEmail() func(c *gin.Context)
 	UpdateUser() func(c *gin.Context)
 	ActivateUser() func(c *gin.Context)
+	ConfirmEmailChange() func(c *gin.Context)
 }
 type THandler interface {
 	CreateAuthToken() func(c *gin.Context)
+	DeleteAuthToken() func(c *gin.Context)
+	CreateMFAAuthToken() func(c *gin.Context)
+}
+type OIDCHandler interface {
+	BeginLogin() func(c *gin.Context)
+	Callback() func(c *gin.Context)
+}
+type MFAHandler interface {
+	EnrolTOTP() func(c *gin.Context)
+	ConfirmTOTP() func(c *gin.Context)
 }
 
-func MakeRoutes(engine *gin.RouterGroup, handler *handlers.Handler, thandler *handlers.TokenHandler) {
+func MakeRoutes(engine *authz.Group, handler *handlers.Handler, thandler *handlers.TokenHandler,
+	mfaHandler *handlers.MFAHandler, oidcHandler *handlers.OIDCHandler,
+) {
 	users := engine.Group("/users")
 	{
-		users.POST("", handler.AddUser())
-		users.PUT("", handler.UpdateUser())
-		users.PUT("/activated", handler.ActivateUser())
-		users.GET("/:email", handler.GetUserByEmail())
+		users.POST("", authz.Public(), handler.AddUser())
+		users.PUT("", authz.Activated().OwnerOnly(), handler.UpdateUser())
+		users.PUT("/activated", authz.Public(), handler.ActivateUser())
+		users.PUT("/email/confirmed", authz.Public(), handler.ConfirmEmailChange())
+		users.POST("/mfa/totp", authz.Activated().OwnerOnly(), mfaHandler.EnrolTOTP())
+		users.PUT("/mfa/totp/activated", authz.Activated().OwnerOnly(), mfaHandler.ConfirmTOTP())
 	}
 
 	tokens := engine.Group("/tokens")
 	{
-		tokens.POST("/authentication", thandler.CreateAuthToken())
+		tokens.POST("/authentication", authz.Public(), thandler.CreateAuthToken())
+		tokens.DELETE("/authentication", authz.Authenticated(), thandler.DeleteAuthToken())
+		tokens.POST("/authentication/mfa", authz.Public(), thandler.CreateMFAAuthToken())
+	}
+
+	oidc := engine.Group("/oidc")
+	{
+		oidc.GET("/:provider/login", authz.Public(), oidcHandler.BeginLogin())
+		oidc.GET("/:provider/callback", authz.Public(), oidcHandler.Callback())
 	}
 }
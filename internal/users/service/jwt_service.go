@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	permissionsmodels "greenlight/internal/permissions/models"
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/jwt"
+	"greenlight/pkg/tracing"
+)
+
+type jwtService struct {
+	keyset             *jwt.Keyset
+	issuer             string
+	ttl                time.Duration
+	denylist           *jwt.Denylist
+	denylistRepo       DenylistRepo
+	permissionsService UserPermissionsService
+	logger             *jsonlog.Logger
+
+	mu            sync.RWMutex
+	disabledUsers map[int64]struct{}
+}
+
+type DenylistRepo interface {
+	Insert(ctx context.Context, token models.DeniedToken) error
+	GetActive(ctx context.Context) ([]models.DeniedToken, error)
+	DeleteExpired(ctx context.Context) error
+	GetDisabledUserIDs(ctx context.Context) ([]int64, error)
+}
+
+type UserPermissionsService interface {
+	GetAllForUser(ctx context.Context, userID int64) (permissionsmodels.Permissions, error)
+}
+
+// authClaims carries the user and the permissions it held when the token was
+// signed. Grants and revokes reach live tokens once they are reissued, the short
+// token lifetime bounds how long that takes.
+type authClaims struct {
+	jwt.RegisteredClaims
+	Name        string   `json:"name"`
+	Email       string   `json:"email"`
+	Activated   bool     `json:"activated"`
+	Permissions []string `json:"permissions"`
+	// Organization binds the token to one organization when set
+	Organization int64 `json:"org,omitempty"`
+}
+
+// NewJWTService signs tokens valid for ttl with the keyset's signing key
+func NewJWTService(keyset *jwt.Keyset, issuer string, ttl time.Duration, denylistRepo DenylistRepo,
+	permissionsService UserPermissionsService, logger *jsonlog.Logger,
+) *jwtService {
+	return &jwtService{
+		keyset:             keyset,
+		issuer:             issuer,
+		ttl:                ttl,
+		denylist:           jwt.NewDenylist(),
+		denylistRepo:       denylistRepo,
+		permissionsService: permissionsService,
+		logger:             logger,
+		disabledUsers:      map[int64]struct{}{},
+	}
+}
+
+// NewAuthenticationToken signs a token for user, bound to orgID unless it is zero.
+// The caller checks the membership.
+func (s *jwtService) NewAuthenticationToken(ctx context.Context, user models.User, orgID int64,
+) (models.Token, error) {
+	ctx, span := tracing.Start(ctx, "JwtService.NewAuthenticationToken")
+	defer span.End()
+
+	permissions, err := s.permissionsService.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return models.Token{}, err
+	}
+
+	jti, err := newTokenID()
+	if err != nil {
+		return models.Token{}, err
+	}
+
+	now := time.Now()
+	claims := authClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Issuer:    s.issuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(s.ttl).Unix(),
+		},
+		Name:         user.Name,
+		Email:        user.Email,
+		Activated:    user.Activated,
+		Permissions:  permissions,
+		Organization: orgID,
+	}
+
+	signed, err := s.keyset.Sign(claims)
+	if err != nil {
+		return models.Token{}, err
+	}
+
+	return models.Token{
+		Plaintext: signed,
+		UserID:    user.ID,
+		Expiry:    claims.Expiry(),
+		Scope:     models.ScopeAuthentication,
+	}, nil
+}
+
+// VerifyAuthenticationToken checks the token signature, expiry and the denylist,
+// and rebuilds the user, its permissions and the organization the token is bound
+// to (zero if none) from the claims without touching the database.
+// Tokens of disabled users are refused once the next denylist sync has seen the
+// change, see SyncDenylist.
+func (s *jwtService) VerifyAuthenticationToken(ctx context.Context, token string,
+) (models.User, permissionsmodels.Permissions, int64, error) {
+	ctx, span := tracing.Start(ctx, "JwtService.VerifyAuthenticationToken")
+	defer span.End()
+
+	claims, err := s.parse(token)
+	if err != nil {
+		return models.User{}, nil, 0, err
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return models.User{}, nil, 0, serviceerrors.ErrInvalidToken
+	}
+
+	s.mu.RLock()
+	_, disabled := s.disabledUsers[userID]
+	s.mu.RUnlock()
+	if disabled {
+		return models.User{}, nil, 0, serviceerrors.ErrInvalidToken
+	}
+
+	user := models.User{
+		ID:        userID,
+		Name:      claims.Name,
+		Email:     claims.Email,
+		Activated: claims.Activated,
+	}
+
+	return user, permissionsmodels.Permissions(claims.Permissions), claims.Organization, nil
+}
+
+// Revoke adds the token to the denylist, both locally and in the shared table so
+// other instances pick it up on their next sync.
+func (s *jwtService) Revoke(ctx context.Context, token string) error {
+	ctx, span := tracing.Start(ctx, "JwtService.Revoke")
+	defer span.End()
+
+	claims, err := s.parse(token)
+	if err != nil {
+		return err
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return serviceerrors.ErrInvalidToken
+	}
+
+	denied := models.DeniedToken{
+		JTI:    claims.ID,
+		UserID: userID,
+		Expiry: claims.Expiry(),
+	}
+
+	err = s.denylistRepo.Insert(ctx, denied)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrUserNotFound):
+			return serviceerrors.ErrUserNotFound
+		default:
+			return err
+		}
+	}
+
+	s.denylist.Add(denied.JTI, denied.Expiry)
+
+	return nil
+}
+
+// SyncDenylist loads the shared denylist and the disabled users, and keeps
+// refreshing them every interval, which bounds how long a revoked token or a
+// disabled user can still be used on another instance. It blocks, so run it in
+// the background.
+func (s *jwtService) SyncDenylist(ctx context.Context, interval time.Duration) {
+	for {
+		err := s.refreshDenylist(ctx)
+		if err != nil {
+			s.logger.PrintError(err, map[string]string{"task": "denylist sync"})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *jwtService) refreshDenylist(ctx context.Context) error {
+	err := s.denylistRepo.DeleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := s.denylistRepo.GetActive(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		s.denylist.Add(token.JTI, token.Expiry)
+	}
+	s.denylist.Prune()
+
+	ids, err := s.denylistRepo.GetDisabledUserIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	disabledUsers := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		disabledUsers[id] = struct{}{}
+	}
+
+	s.mu.Lock()
+	s.disabledUsers = disabledUsers
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *jwtService) parse(token string) (authClaims, error) {
+	var claims authClaims
+
+	err := s.keyset.Parse(token, &claims)
+	if err != nil {
+		return authClaims{}, serviceerrors.ErrInvalidToken
+	}
+
+	if claims.Issuer != s.issuer || s.denylist.Contains(claims.ID) {
+		return authClaims{}, serviceerrors.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func newTokenID() (string, error) {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
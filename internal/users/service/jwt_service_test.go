@@ -0,0 +1,99 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	permissionsmodels "greenlight/internal/permissions/models"
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/service"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/jwt"
+)
+
+// TestJWTCarriesPermissions verifies tokens from their claims alone, and refuses
+// them once revoked
+func TestJWTCarriesPermissions(t *testing.T) {
+	key, err := jwt.NewHS256Key("test", []byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyset, err := jwt.NewKeyset("test", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	permissions := &countingPermissions{codes: permissionsmodels.Permissions{"movies:read", "movies:write"}}
+	s := service.NewJWTService(keyset, "greenlight", 15*time.Minute, &fakeDenylistRepo{}, permissions,
+		jsonlog.New(io.Discard, jsonlog.LevelOff))
+	ctx := context.Background()
+
+	alice := models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Activated: true}
+	token, err := s.NewAuthenticationToken(ctx, alice, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := time.Until(token.Expiry); ttl > 15*time.Minute || ttl < 14*time.Minute {
+		t.Errorf("got a token valid for %v, want 15m", ttl)
+	}
+
+	permissions.calls = 0
+	for i := 0; i < 3; i++ {
+		user, got, orgID, err := s.VerifyAuthenticationToken(ctx, token.Plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(user, alice) || orgID != 7 || !reflect.DeepEqual(got, permissions.codes) {
+			t.Fatalf("got user %+v, org %d and permissions %v", user, orgID, got)
+		}
+	}
+	if permissions.calls != 0 {
+		t.Errorf("verifying looked up the permissions %d times, want none", permissions.calls)
+	}
+
+	err = s.Revoke(ctx, token.Plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = s.VerifyAuthenticationToken(ctx, token.Plaintext)
+	if !errors.Is(err, serviceerrors.ErrInvalidToken) {
+		t.Errorf("got error %v for a revoked token, want %v", err, serviceerrors.ErrInvalidToken)
+	}
+}
+
+type countingPermissions struct {
+	codes permissionsmodels.Permissions
+	calls int
+}
+
+func (p *countingPermissions) GetAllForUser(ctx context.Context, userID int64) (permissionsmodels.Permissions, error) {
+	p.calls++
+	return p.codes, nil
+}
+
+type fakeDenylistRepo struct {
+	denied []models.DeniedToken
+}
+
+func (r *fakeDenylistRepo) Insert(ctx context.Context, token models.DeniedToken) error {
+	r.denied = append(r.denied, token)
+	return nil
+}
+
+func (r *fakeDenylistRepo) GetActive(ctx context.Context) ([]models.DeniedToken, error) {
+	return r.denied, nil
+}
+
+func (r *fakeDenylistRepo) DeleteExpired(ctx context.Context) error {
+	return nil
+}
+
+func (r *fakeDenylistRepo) GetDisabledUserIDs(ctx context.Context) ([]int64, error) {
+	return nil, nil
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/mailer"
+	"greenlight/pkg/taskutils"
+	"greenlight/pkg/tracing"
+)
+
+type LockoutPolicy struct {
+	// FreeAttempts is how many failures an account may have before backoff kicks in
+	FreeAttempts int
+	// IPFreeAttempts is the same allowance for a client IP, which is usually shared
+	IPFreeAttempts int
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	// MaxFailures locks the account for LockDuration and notifies its owner
+	MaxFailures  int
+	LockDuration time.Duration
+	// Window is how long a failure is remembered
+	Window time.Duration
+}
+
+type lockoutService struct {
+	repo   ThrottleRepo
+	policy LockoutPolicy
+	logger *jsonlog.Logger
+	mailer mailer.Mailer
+}
+
+type ThrottleRepo interface {
+	Get(ctx context.Context, key string) (models.LoginThrottle, error)
+	RecordFailure(ctx context.Context, key string, window time.Duration) (models.LoginThrottle, error)
+	SetBlockedUntil(ctx context.Context, key string, blockedUntil time.Time) error
+	Lock(ctx context.Context, key string, lockedUntil time.Time) (bool, error)
+	Reset(ctx context.Context, key string) error
+}
+
+func NewLockoutService(repo ThrottleRepo, policy LockoutPolicy,
+	logger *jsonlog.Logger, mailer mailer.Mailer,
+) *lockoutService {
+	return &lockoutService{
+		repo:   repo,
+		policy: policy,
+		logger: logger,
+		mailer: mailer,
+	}
+}
+
+// Check returns ErrLoginThrottled and how long to wait when either the account or
+// the client IP is still backing off. Unknown emails are tracked like real ones.
+func (s *lockoutService) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	ctx, span := tracing.Start(ctx, "LockoutService.Check")
+	defer span.End()
+
+	var retryAfter time.Duration
+
+	for _, key := range []string{models.AccountThrottleKey(email), models.IPThrottleKey(ip)} {
+		throttle, err := s.repo.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+
+		if wait := time.Until(throttle.BlockedUntil); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	if retryAfter > 0 {
+		return retryAfter, serviceerrors.ErrLoginThrottled
+	}
+
+	return 0, nil
+}
+
+// RecordFailure bumps both counters and applies exponential backoff, locking the
+// account once it reaches MaxFailures. The owner is notified of every new lock,
+// including the ones after an earlier lock expired. user is the zero value when
+// the email is not registered.
+func (s *lockoutService) RecordFailure(ctx context.Context, email, ip string, user models.User) error {
+	ctx, span := tracing.Start(ctx, "LockoutService.RecordFailure")
+	defer span.End()
+
+	account, err := s.repo.RecordFailure(ctx, models.AccountThrottleKey(email), s.policy.Window)
+	if err != nil {
+		return err
+	}
+
+	if account.Failures >= s.policy.MaxFailures {
+		lockedUntil := time.Now().Add(s.policy.LockDuration)
+
+		locked, err := s.repo.Lock(ctx, account.Key, lockedUntil)
+		if err != nil {
+			return err
+		}
+
+		if locked && !user.IsAnonymous() {
+			s.notifyLocked(user, ip, lockedUntil)
+		}
+	} else {
+		err = s.repo.SetBlockedUntil(ctx, account.Key, time.Now().Add(s.delay(account.Failures, s.policy.FreeAttempts)))
+		if err != nil {
+			return err
+		}
+	}
+
+	client, err := s.repo.RecordFailure(ctx, models.IPThrottleKey(ip), s.policy.Window)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.SetBlockedUntil(ctx, client.Key, time.Now().Add(s.delay(client.Failures, s.policy.IPFreeAttempts)))
+}
+
+// RecordSuccess clears the account counter. The IP counter is left alone so one
+// valid login cannot be used to reset guessing against other accounts.
+func (s *lockoutService) RecordSuccess(ctx context.Context, email string) error {
+	ctx, span := tracing.Start(ctx, "LockoutService.RecordSuccess")
+	defer span.End()
+
+	return s.repo.Reset(ctx, models.AccountThrottleKey(email))
+}
+
+func (s *lockoutService) delay(failures, freeAttempts int) time.Duration {
+	if failures <= freeAttempts {
+		return 0
+	}
+
+	delay := s.policy.BaseDelay
+	for i := freeAttempts + 1; i < failures && delay < s.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > s.policy.MaxDelay {
+		return s.policy.MaxDelay
+	}
+
+	return delay
+}
+
+func (s *lockoutService) notifyLocked(user models.User, ip string, lockedUntil time.Time) {
+	go taskutils.BackgroundTask(func() {
+		data := map[string]any{
+			"name":        user.Name,
+			"ip":          ip,
+			"lockedUntil": lockedUntil.UTC().Format(time.RFC1123),
+		}
+
+		err := s.mailer.Send(user.Email, "account_locked.tmpl", data)
+		if err != nil {
+			s.logger.PrintError(err, nil)
+		}
+	})
+}
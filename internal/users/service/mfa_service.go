@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/secretbox"
+	"greenlight/pkg/totp"
+	"greenlight/pkg/tracing"
+)
+
+type mfaService struct {
+	repo   MFARepo
+	box    *secretbox.Box
+	issuer string
+	logger *jsonlog.Logger
+}
+
+type MFARepo interface {
+	ReplaceTOTP(ctx context.Context, totp models.TOTP, recoveryHashes [][]byte) error
+	GetTOTP(ctx context.Context, userID int64) (models.TOTP, error)
+	UseStep(ctx context.Context, userID int64, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, hash []byte) error
+}
+
+// NewMFAService builds the TOTP service. box may be nil when no encryption key is
+// configured; enrolled users then fail verification instead of skipping it.
+func NewMFAService(repo MFARepo, box *secretbox.Box, issuer string, logger *jsonlog.Logger) *mfaService {
+	return &mfaService{
+		repo:   repo,
+		box:    box,
+		issuer: issuer,
+		logger: logger,
+	}
+}
+
+func (s *mfaService) Enrol(ctx context.Context, user models.User) (models.TOTPEnrolment, error) {
+	ctx, span := tracing.Start(ctx, "MfaService.Enrol")
+	defer span.End()
+
+	if s.box == nil {
+		return models.TOTPEnrolment{}, serviceerrors.ErrMFAUnavailable
+	}
+
+	enabled, err := s.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return models.TOTPEnrolment{}, err
+	}
+	if enabled {
+		return models.TOTPEnrolment{}, serviceerrors.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return models.TOTPEnrolment{}, err
+	}
+
+	ciphertext, err := s.box.Seal([]byte(secret))
+	if err != nil {
+		return models.TOTPEnrolment{}, err
+	}
+
+	codes, hashes, err := models.GenerateRecoveryCodes(models.RecoveryCodesCount)
+	if err != nil {
+		return models.TOTPEnrolment{}, err
+	}
+
+	err = s.repo.ReplaceTOTP(ctx, models.TOTP{UserID: user.ID, SecretCiphertext: ciphertext}, hashes)
+	if err != nil {
+		return models.TOTPEnrolment{}, err
+	}
+
+	return models.TOTPEnrolment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.issuer, user.Email, secret),
+		RecoveryCodes:   codes,
+	}, nil
+}
+
+// Confirm activates a pending enrolment once the user proves the authenticator
+// app produces valid codes
+func (s *mfaService) Confirm(ctx context.Context, userID int64, code string) error {
+	ctx, span := tracing.Start(ctx, "MfaService.Confirm")
+	defer span.End()
+
+	t, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if t.Confirmed {
+		return serviceerrors.ErrMFAAlreadyEnabled
+	}
+
+	return s.verifyCode(ctx, t, code)
+}
+
+func (s *mfaService) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	ctx, span := tracing.Start(ctx, "MfaService.IsEnabled")
+	defer span.End()
+
+	t, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrMFANotEnrolled):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return t.Confirmed, nil
+}
+
+// Verify accepts either a current TOTP code or one of the unused recovery codes
+func (s *mfaService) Verify(ctx context.Context, userID int64, code, recoveryCode string) error {
+	ctx, span := tracing.Start(ctx, "MfaService.Verify")
+	defer span.End()
+
+	t, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !t.Confirmed {
+		return serviceerrors.ErrMFANotEnrolled
+	}
+
+	if recoveryCode != "" {
+		err := s.repo.UseRecoveryCode(ctx, userID, models.HashRecoveryCode(recoveryCode))
+		if err != nil {
+			switch {
+			case errors.Is(err, repoerrors.ErrRecoveryCode):
+				return serviceerrors.ErrInvalidMFACode
+			default:
+				return err
+			}
+		}
+		return nil
+	}
+
+	return s.verifyCode(ctx, t, code)
+}
+
+func (s *mfaService) getTOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	if s.box == nil {
+		return models.TOTP{}, serviceerrors.ErrMFAUnavailable
+	}
+
+	t, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrMFANotEnrolled):
+			return models.TOTP{}, serviceerrors.ErrMFANotEnrolled
+		default:
+			return models.TOTP{}, err
+		}
+	}
+
+	return t, nil
+}
+
+func (s *mfaService) verifyCode(ctx context.Context, t models.TOTP, code string) error {
+	secret, err := s.box.Open(t.SecretCiphertext)
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(string(secret), code, time.Now())
+	if !ok {
+		return serviceerrors.ErrInvalidMFACode
+	}
+
+	err = s.repo.UseStep(ctx, t.UserID, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrTOTPStepUsed):
+			return serviceerrors.ErrInvalidMFACode
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+	"greenlight/internal/users/service"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/secretbox"
+	"greenlight/pkg/totp"
+)
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	box, err := secretbox.NewFromHex("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &fakeMFARepo{}
+	s := service.NewMFAService(repo, box, "Greenlight", jsonlog.New(io.Discard, jsonlog.LevelOff))
+	ctx := context.Background()
+	alice := models.User{ID: 1, Email: "alice@example.com"}
+
+	enrolment, err := s.Enrol(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(enrolment.RecoveryCodes) != models.RecoveryCodesCount {
+		t.Fatalf("got %d recovery codes, want %d", len(enrolment.RecoveryCodes), models.RecoveryCodesCount)
+	}
+
+	// Recovery codes only work once the enrolment is confirmed
+	err = s.Verify(ctx, alice.ID, "", enrolment.RecoveryCodes[0])
+	if !errors.Is(err, serviceerrors.ErrMFANotEnrolled) {
+		t.Fatalf("got error %v before confirming, want %v", err, serviceerrors.ErrMFANotEnrolled)
+	}
+
+	code, err := totp.Code(enrolment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Confirm(ctx, alice.ID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := enrolment.RecoveryCodes[0], enrolment.RecoveryCodes[1]
+	for _, tc := range []struct {
+		name string
+		code string
+		err  error
+	}{
+		{"unused code", first, nil},
+		{"same code again", first, serviceerrors.ErrInvalidMFACode},
+		{"formatting is ignored", " " + second + " ", nil},
+		{"other code again", second, serviceerrors.ErrInvalidMFACode},
+		{"unknown code", "aaaaa-aaaaa", serviceerrors.ErrInvalidMFACode},
+	} {
+		err := s.Verify(ctx, alice.ID, "", tc.code)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.err)
+		}
+	}
+
+	// Re-enrolling replaces the codes
+	bob, err := s.Enrol(ctx, models.User{ID: 2, Email: "bob@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Verify(ctx, alice.ID, "", bob.RecoveryCodes[0])
+	if !errors.Is(err, serviceerrors.ErrInvalidMFACode) {
+		t.Errorf("got error %v for another user's code, want %v", err, serviceerrors.ErrInvalidMFACode)
+	}
+}
+
+// fakeMFARepo keeps users_totp and mfa_recovery_codes rows in memory
+type fakeMFARepo struct {
+	mu       sync.Mutex
+	totps    map[int64]models.TOTP
+	recovery map[int64][]recoveryCode
+}
+
+type recoveryCode struct {
+	hash []byte
+	used bool
+}
+
+func (r *fakeMFARepo) ReplaceTOTP(ctx context.Context, t models.TOTP, recoveryHashes [][]byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.totps == nil {
+		r.totps = map[int64]models.TOTP{}
+		r.recovery = map[int64][]recoveryCode{}
+	}
+
+	r.totps[t.UserID] = t
+	r.recovery[t.UserID] = nil
+	for _, hash := range recoveryHashes {
+		r.recovery[t.UserID] = append(r.recovery[t.UserID], recoveryCode{hash: hash})
+	}
+
+	return nil
+}
+
+func (r *fakeMFARepo) GetTOTP(ctx context.Context, userID int64) (models.TOTP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.totps[userID]
+	if !ok {
+		return models.TOTP{}, repoerrors.ErrMFANotEnrolled
+	}
+
+	return t, nil
+}
+
+func (r *fakeMFARepo) UseStep(ctx context.Context, userID int64, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.totps[userID]
+	if t.LastUsedStep >= step {
+		return repoerrors.ErrTOTPStepUsed
+	}
+	t.LastUsedStep = step
+	t.Confirmed = true
+	r.totps[userID] = t
+
+	return nil
+}
+
+func (r *fakeMFARepo) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codes := r.recovery[userID]
+	for i := range codes {
+		if !codes[i].used && bytes.Equal(codes[i].hash, hash) {
+			codes[i].used = true
+			return nil
+		}
+	}
+
+	return repoerrors.ErrRecoveryCode
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/oidc"
+	"greenlight/pkg/tracing"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+type oidcService struct {
+	providers           map[string]*oidc.Client
+	identityRepo        IdentityRepo
+	userRepo            UserRepo
+	permissionsService  PermissionsService
+	organizationService OrganizationService
+	emailPolicy         EmailPolicy
+	logger              *jsonlog.Logger
+}
+
+type IdentityRepo interface {
+	Insert(ctx context.Context, identity models.Identity) (models.Identity, error)
+	GetUser(ctx context.Context, provider, subject string) (models.User, error)
+	InsertState(ctx context.Context, state models.OIDCLoginState) error
+	ConsumeState(ctx context.Context, hash []byte, provider string) (models.OIDCLoginState, error)
+}
+
+func NewOIDCService(providers []*oidc.Client, identityRepo IdentityRepo, userRepo UserRepo,
+	permissionsService PermissionsService, organizationService OrganizationService, emailPolicy EmailPolicy,
+	logger *jsonlog.Logger,
+) *oidcService {
+	s := &oidcService{
+		providers:           make(map[string]*oidc.Client, len(providers)),
+		identityRepo:        identityRepo,
+		userRepo:            userRepo,
+		permissionsService:  permissionsService,
+		organizationService: organizationService,
+		emailPolicy:         emailPolicy,
+		logger:              logger,
+	}
+
+	for _, provider := range providers {
+		s.providers[provider.Name()] = provider
+	}
+
+	return s
+}
+
+// BeginLogin stores a fresh state, nonce and PKCE verifier and returns the
+// provider URL the user has to be redirected to
+func (s *oidcService) BeginLogin(ctx context.Context, providerName string) (string, error) {
+	ctx, span := tracing.Start(ctx, "OidcService.BeginLogin")
+	defer span.End()
+
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", serviceerrors.ErrUnknownProvider
+	}
+
+	var values [3]string
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			return "", err
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	err := s.identityRepo.InsertState(ctx, models.OIDCLoginState{
+		Hash:         models.HashOIDCState(state),
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		Expiry:       time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return provider.AuthCodeURL(ctx, state, nonce, verifier)
+}
+
+// CompleteLogin validates the callback, and returns the local user linked to the
+// external subject. Unknown subjects get a new account. They are never linked to
+// an existing account with the same email, whose owner may not control the
+// external identity, ErrAccountExists is returned instead.
+func (s *oidcService) CompleteLogin(ctx context.Context, providerName, state, code string) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "OidcService.CompleteLogin")
+	defer span.End()
+
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return models.User{}, serviceerrors.ErrUnknownProvider
+	}
+
+	loginState, err := s.identityRepo.ConsumeState(ctx, models.HashOIDCState(state), providerName)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrOIDCStateNotFound):
+			return models.User{}, serviceerrors.ErrInvalidOIDCState
+		default:
+			return models.User{}, err
+		}
+	}
+
+	claims, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		s.logger.PrintError(err, map[string]string{"provider": providerName})
+		return models.User{}, serviceerrors.ErrOIDCLoginFailed
+	}
+
+	user, err := s.identityRepo.GetUser(ctx, providerName, claims.Subject)
+	if err == nil {
+		if user.IsDisabled() {
+			return models.User{}, serviceerrors.ErrAccountDisabled
+		}
+		return user, nil
+	}
+	if !errors.Is(err, repoerrors.ErrIdentityNotFound) {
+		return models.User{}, err
+	}
+
+	return s.createUser(ctx, providerName, claims)
+}
+
+// createUser signs up the owner of an unknown external identity and links it.
+// A signup failing halfway is deleted, an account left without its identity
+// would make every later login return ErrAccountExists.
+func (s *oidcService) createUser(ctx context.Context, providerName string, claims oidc.Claims) (models.User, error) {
+	// An unverified email could belong to someone else, never trust it
+	if claims.Email == "" || !claims.EmailVerified {
+		return models.User{}, serviceerrors.ErrOIDCLoginFailed
+	}
+
+	// Providers sign up the same addresses AddUser would, no others
+	err := s.emailPolicy.Check(ctx, claims.Email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	_, err = s.userRepo.GetByEmail(ctx, claims.Email)
+	if err == nil {
+		return models.User{}, serviceerrors.ErrAccountExists
+	}
+	if !errors.Is(err, repoerrors.ErrUserNotFound) {
+		return models.User{}, err
+	}
+
+	// The account can only be used through the provider until a password is set
+	unusable, err := oidc.RandomString()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		Name:      claims.Name,
+		Email:     claims.Email,
+		Activated: true,
+	}
+	if user.Name == "" {
+		user.Name = claims.Email
+	}
+
+	err = user.Password.Set(unusable)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err = s.userRepo.Insert(ctx, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrDuplicateEmail):
+			return models.User{}, serviceerrors.ErrAccountExists
+		default:
+			return models.User{}, err
+		}
+	}
+
+	err = s.setupUser(ctx, user, providerName, claims)
+	if err != nil {
+		// The request context may be what failed, the cleanup must still run
+		deleteErr := s.userRepo.Delete(context.Background(), user.ID)
+		if deleteErr != nil {
+			s.logger.PrintError(deleteErr, map[string]string{"provider": providerName, "email": user.Email})
+		}
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// setupUser links the identity and gives the new user its default role and
+// personal organization
+func (s *oidcService) setupUser(ctx context.Context, user models.User, providerName string, claims oidc.Claims) error {
+	_, err := s.identityRepo.Insert(ctx, models.Identity{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.permissionsService.AssignDefaultRole(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return personalOrganization(ctx, s.organizationService, user.ID)
+}
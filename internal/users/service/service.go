@@ -5,51 +5,90 @@ import (
 	"errors"
 	"time"
 
+	orgmodels "greenlight/internal/organizations/models"
 	"greenlight/internal/users/models"
 	"greenlight/internal/users/repoerrors"
 	"greenlight/internal/users/serviceerrors"
 	"greenlight/pkg/jsonlog"
 	"greenlight/pkg/mailer"
 	"greenlight/pkg/taskutils"
+	"greenlight/pkg/tracing"
 )
 
 type userService struct {
-	repo               UserRepo
-	permissionsService PermissionsService
-	tokensRepo         TokensRepo
-	logger             *jsonlog.Logger
-	mailer             mailer.Mailer
+	repo                UserRepo
+	permissionsService  PermissionsService
+	organizationService OrganizationService
+	tokensRepo          TokensRepo
+	emailPolicy         EmailPolicy
+	logger              *jsonlog.Logger
+	mailer              mailer.Mailer
 }
 type TokensRepo interface {
 	Insert(ctx context.Context, userID int64, ttl time.Duration, scope string) (models.Token, error)
 	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+	Delete(ctx context.Context, scope string, tokenPlaintext string) error
 }
 
 type UserRepo interface {
 	Insert(ctx context.Context, user models.User) (models.User, error)
+	Get(ctx context.Context, id int64) (models.User, error)
 	GetByEmail(ctx context.Context, email string) (models.User, error)
 	Update(ctx context.Context, user models.User) (models.User, error)
+	UpdatePasswordHash(ctx context.Context, id int64, hash []byte) error
+	Delete(ctx context.Context, id int64) error
 	GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string) (models.User, error)
 }
 
 type PermissionsService interface {
-	AddForUser(ctx context.Context, userID int64, codes ...string) error
+	AssignDefaultRole(ctx context.Context, userID int64) error
+}
+
+type OrganizationService interface {
+	AddOrganization(ctx context.Context, userID int64, org orgmodels.Organization) (orgmodels.Organization, error)
+}
+
+// personalOrganization is the organization every new account gets, with the
+// account as its admin, so it has somewhere to keep movies before joining
+// others. Organization roles only govern membership. What a user can do with
+// the movies of any of their organizations comes from their global roles and
+// permissions, starting with the default role.
+func personalOrganization(ctx context.Context, organizationService OrganizationService, userID int64) error {
+	_, err := organizationService.AddOrganization(ctx, userID, orgmodels.Organization{Name: "Personal"})
+	return err
+}
+
+// EmailPolicy decides which addresses can be used to sign up or change email.
+// Refused addresses are reported with an *emailpolicy.Violation.
+type EmailPolicy interface {
+	Check(ctx context.Context, email string) error
 }
 
 func NewUserService(repo UserRepo, tokensRepo TokensRepo,
 	logger *jsonlog.Logger, mailer mailer.Mailer, permissionsService PermissionsService,
+	organizationService OrganizationService, emailPolicy EmailPolicy,
 ) *userService {
 	return &userService{
-		repo:               repo,
-		tokensRepo:         tokensRepo,
-		mailer:             mailer,
-		logger:             logger,
-		permissionsService: permissionsService,
+		repo:                repo,
+		tokensRepo:          tokensRepo,
+		mailer:              mailer,
+		logger:              logger,
+		permissionsService:  permissionsService,
+		organizationService: organizationService,
+		emailPolicy:         emailPolicy,
 	}
 }
 
 func (s userService) AddUser(ctx context.Context, user models.User) (models.User, error) {
-	user, err := s.repo.Insert(ctx, user)
+	ctx, span := tracing.Start(ctx, "UserService.AddUser")
+	defer span.End()
+
+	err := s.emailPolicy.Check(ctx, user.Email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err = s.repo.Insert(ctx, user)
 	if err != nil {
 		switch {
 		case errors.Is(err, repoerrors.ErrDuplicateEmail):
@@ -68,7 +107,12 @@ func (s userService) AddUser(ctx context.Context, user models.User) (models.User
 		return models.User{}, err
 	}
 
-	err = s.permissionsService.AddForUser(ctx, user.ID, "movies:read")
+	err = s.permissionsService.AssignDefaultRole(ctx, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	err = personalOrganization(ctx, s.organizationService, user.ID)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -90,6 +134,9 @@ func (s userService) AddUser(ctx context.Context, user models.User) (models.User
 }
 
 func (s userService) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByEmail")
+	defer span.End()
+
 	user, err := s.repo.GetByEmail(ctx, email)
 	if err != nil {
 		switch {
@@ -105,12 +152,36 @@ func (s userService) GetUserByEmail(ctx context.Context, email string) (models.U
 	return user, nil
 }
 
+func (s userService) GetUser(ctx context.Context, id int64) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUser")
+	defer span.End()
+
+	user, err := s.repo.Get(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrUserNotFound):
+			return models.User{}, serviceerrors.ErrUserNotFound
+		default:
+			return models.User{}, err
+		}
+	}
+
+	return user, nil
+}
+
 func (s userService) UpdateUser(ctx context.Context, user models.User) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer span.End()
+
 	user, err := s.repo.Update(ctx, user)
 	if err != nil {
 		switch {
 		case errors.Is(err, repoerrors.ErrUserNotFound):
 			return models.User{}, serviceerrors.ErrUserNotFound
+		case errors.Is(err, repoerrors.ErrEditConflict):
+			return models.User{}, serviceerrors.ErrEditConflict
+		case errors.Is(err, repoerrors.ErrDuplicateEmail):
+			return models.User{}, serviceerrors.ErrDuplicateEmail
 		case errors.Is(err, repoerrors.ErrEmailRequired):
 			return models.User{}, serviceerrors.ErrEmailRequired
 		case errors.Is(err, repoerrors.ErrPswRequired):
@@ -124,11 +195,14 @@ func (s userService) UpdateUser(ctx context.Context, user models.User) (models.U
 }
 
 func (s userService) GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetForToken")
+	defer span.End()
+
 	user, err := s.repo.GetForToken(ctx, tokenScope, tokenPlaintext)
 	if err != nil {
 		switch {
-		case errors.Is(err, repoerrors.ErrUserNotFound):
-			return models.User{}, serviceerrors.ErrUserNotFound
+		case errors.Is(err, repoerrors.ErrTokenNotFound):
+			return models.User{}, serviceerrors.ErrTokenNotFound
 		default:
 			return models.User{}, err
 		}
@@ -136,3 +210,105 @@ func (s userService) GetForToken(ctx context.Context, tokenScope string, tokenPl
 
 	return user, nil
 }
+
+// UpdatePasswordHash stores a hash that was upgraded by Password.Matches. The
+// version is left alone, the password itself did not change.
+func (s userService) UpdatePasswordHash(ctx context.Context, user models.User) error {
+	ctx, span := tracing.Start(ctx, "UserService.UpdatePasswordHash")
+	defer span.End()
+
+	err := s.repo.UpdatePasswordHash(ctx, user.ID, user.Password.Hash)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrUserNotFound):
+			return serviceerrors.ErrUserNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RequestEmailChange saves user with newEmail as its pending address and mails a
+// confirmation token to it. The current address stays in use until the token
+// is confirmed.
+func (s userService) RequestEmailChange(ctx context.Context, user models.User, newEmail string) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.RequestEmailChange")
+	defer span.End()
+
+	err := s.emailPolicy.Check(ctx, newEmail)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	_, err = s.repo.GetByEmail(ctx, newEmail)
+	switch {
+	case err == nil:
+		return models.User{}, serviceerrors.ErrDuplicateEmail
+	case !errors.Is(err, repoerrors.ErrUserNotFound):
+		return models.User{}, err
+	}
+
+	user.PendingEmail = &newEmail
+
+	user, err = s.UpdateUser(ctx, user)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// Only the latest request can be confirmed
+	err = s.tokensRepo.DeleteAllForUser(ctx, models.ScopeEmailChange, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	token, err := s.tokensRepo.Insert(ctx, user.ID, 24*time.Hour, models.ScopeEmailChange)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	go taskutils.BackgroundTask(func() {
+		data := map[string]any{
+			"emailChangeToken": token.Plaintext,
+			"name":             user.Name,
+		}
+
+		err := s.mailer.Send(newEmail, "email_change.tmpl", data)
+		if err != nil {
+			s.logger.PrintError(err, nil)
+		}
+	})
+
+	return user, nil
+}
+
+// ConfirmEmailChange makes the pending address of the token owner its email
+func (s userService) ConfirmEmailChange(ctx context.Context, tokenPlaintext string) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.ConfirmEmailChange")
+	defer span.End()
+
+	user, err := s.GetForToken(ctx, models.ScopeEmailChange, tokenPlaintext)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if user.PendingEmail == nil {
+		return models.User{}, serviceerrors.ErrTokenNotFound
+	}
+
+	user.Email = *user.PendingEmail
+	user.PendingEmail = nil
+
+	user, err = s.UpdateUser(ctx, user)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	err = s.tokensRepo.DeleteAllForUser(ctx, models.ScopeEmailChange, user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
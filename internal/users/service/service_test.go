@@ -0,0 +1,208 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+	"greenlight/internal/users/service"
+	"greenlight/internal/users/serviceerrors"
+	"greenlight/pkg/emailpolicy"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/mailer"
+)
+
+func TestEmailChangeNeedsConfirmation(t *testing.T) {
+	alice := models.User{ID: 1, Name: "Alice", Email: "alice@example.com", Activated: true}
+	tokens := &fakeTokensRepo{}
+	users := &fakeUserRepo{users: map[int64]models.User{alice.ID: alice}, tokens: tokens}
+
+	// The confirmation mail fails to connect, which is only logged
+	s := service.NewUserService(users, tokens, jsonlog.New(io.Discard, jsonlog.LevelOff),
+		mailer.New("127.0.0.1", 1, "", "", "greenlight@example.com"), nil, nil,
+		emailpolicy.New(emailpolicy.Config{BlockDisposable: true}))
+	ctx := context.Background()
+
+	_, err := s.RequestEmailChange(ctx, alice, "alice@mailinator.com")
+	var violation *emailpolicy.Violation
+	if !errors.As(err, &violation) {
+		t.Fatalf("got error %v for a disposable address, want a violation", err)
+	}
+
+	const newEmail = "alice@corp.test"
+	pending, err := s.RequestEmailChange(ctx, alice, newEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Email != alice.Email || pending.PendingEmail == nil || *pending.PendingEmail != newEmail {
+		t.Fatalf("got email %q pending %v, want %q pending %q", pending.Email, pending.PendingEmail, alice.Email, newEmail)
+	}
+	if _, err := s.GetUserByEmail(ctx, newEmail); !errors.Is(err, serviceerrors.ErrUserNotFound) {
+		t.Fatalf("the pending address is in use before confirmation: %v", err)
+	}
+
+	_, err = s.ConfirmEmailChange(ctx, "not-the-token")
+	if !errors.Is(err, serviceerrors.ErrTokenNotFound) {
+		t.Fatalf("got error %v for a wrong token, want %v", err, serviceerrors.ErrTokenNotFound)
+	}
+	if user, _ := s.GetUser(ctx, alice.ID); user.Email != alice.Email {
+		t.Fatalf("got email %q after a wrong token, want %q", user.Email, alice.Email)
+	}
+
+	token := tokens.latest(models.ScopeEmailChange)
+	confirmed, err := s.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confirmed.Email != newEmail || confirmed.PendingEmail != nil {
+		t.Errorf("got email %q pending %v, want %q and nothing pending", confirmed.Email, confirmed.PendingEmail, newEmail)
+	}
+	if user, _ := s.GetUserByEmail(ctx, newEmail); user.ID != alice.ID {
+		t.Errorf("got user %d for the new address, want %d", user.ID, alice.ID)
+	}
+
+	_, err = s.ConfirmEmailChange(ctx, token)
+	if !errors.Is(err, serviceerrors.ErrTokenNotFound) {
+		t.Errorf("got error %v for a used token, want %v", err, serviceerrors.ErrTokenNotFound)
+	}
+}
+
+type fakeUserRepo struct {
+	mu     sync.Mutex
+	users  map[int64]models.User
+	tokens *fakeTokensRepo
+}
+
+func (r *fakeUserRepo) Insert(ctx context.Context, user models.User) (models.User, error) {
+	return models.User{}, errors.New("not implemented")
+}
+
+func (r *fakeUserRepo) Get(ctx context.Context, id int64) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return models.User{}, repoerrors.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (r *fakeUserRepo) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return models.User{}, repoerrors.ErrUserNotFound
+}
+
+func (r *fakeUserRepo) Update(ctx context.Context, user models.User) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return models.User{}, repoerrors.ErrEditConflict
+	}
+	user.Version++
+	r.users[user.ID] = user
+
+	return user, nil
+}
+
+func (r *fakeUserRepo) UpdatePasswordHash(ctx context.Context, id int64, hash []byte) error {
+	return nil
+}
+
+func (r *fakeUserRepo) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.users, id)
+	return nil
+}
+
+func (r *fakeUserRepo) GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string,
+) (models.User, error) {
+	userID, ok := r.tokens.owner(tokenScope, tokenPlaintext)
+	if !ok {
+		return models.User{}, repoerrors.ErrTokenNotFound
+	}
+
+	return r.Get(ctx, userID)
+}
+
+type fakeTokensRepo struct {
+	mu     sync.Mutex
+	tokens []models.Token
+}
+
+func (r *fakeTokensRepo) Insert(ctx context.Context, userID int64, ttl time.Duration, scope string,
+) (models.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, err := models.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return models.Token{}, err
+	}
+	r.tokens = append(r.tokens, token)
+
+	return token, nil
+}
+
+func (r *fakeTokensRepo) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.tokens[:0]
+	for _, token := range r.tokens {
+		if token.Scope != scope || token.UserID != userID {
+			kept = append(kept, token)
+		}
+	}
+	r.tokens = kept
+
+	return nil
+}
+
+func (r *fakeTokensRepo) Delete(ctx context.Context, scope string, tokenPlaintext string) error {
+	return nil
+}
+
+func (r *fakeTokensRepo) owner(scope, tokenPlaintext string) (int64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.Scope == scope && token.Plaintext == tokenPlaintext {
+			return token.UserID, true
+		}
+	}
+
+	return 0, false
+}
+
+func (r *fakeTokensRepo) latest(scope string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.tokens) - 1; i >= 0; i-- {
+		if r.tokens[i].Scope == scope {
+			return r.tokens[i].Plaintext
+		}
+	}
+
+	return ""
+}
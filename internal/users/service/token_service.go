@@ -10,6 +10,7 @@ import (
 	"greenlight/internal/users/repoerrors"
 	"greenlight/internal/users/serviceerrors"
 	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/tracing"
 )
 
 type tokenService struct {
@@ -25,6 +26,9 @@ func NewTokensService(repo TokensRepo, logger *jsonlog.Logger) *tokenService {
 }
 
 func (s *tokenService) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	ctx, span := tracing.Start(ctx, "TokenService.DeleteAllForUser")
+	defer span.End()
+
 	err := s.repo.DeleteAllForUser(ctx, scope, userID)
 	if err != nil {
 		switch {
@@ -39,6 +43,9 @@ func (s *tokenService) DeleteAllForUser(ctx context.Context, scope string, userI
 func (s *tokenService) Insert(ctx context.Context, userID int64, ttl time.Duration,
 	scope string,
 ) (models.Token, error) {
+	ctx, span := tracing.Start(ctx, "TokenService.Insert")
+	defer span.End()
+
 	token, err := s.repo.Insert(ctx, userID, ttl, scope)
 	if err != nil {
 		switch {
@@ -50,3 +57,19 @@ func (s *tokenService) Insert(ctx context.Context, userID int64, ttl time.Durati
 	}
 	return token, nil
 }
+
+func (s *tokenService) Delete(ctx context.Context, scope string, tokenPlaintext string) error {
+	ctx, span := tracing.Start(ctx, "TokenService.Delete")
+	defer span.End()
+
+	err := s.repo.Delete(ctx, scope, tokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, repoerrors.ErrTokenNotFound):
+			return serviceerrors.ErrTokenNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -10,4 +10,15 @@ var (
 	ErrUserNotFound              = errors.New("user not found")
 	ErrTokenNotFound             = errors.New("token not found")
 	ErrMismatchedHashAndPassword = errors.New("mismatched hash and password")
+	ErrInvalidToken              = errors.New("invalid token")
+	ErrMFANotEnrolled            = errors.New("mfa not enrolled")
+	ErrMFAAlreadyEnabled         = errors.New("mfa already enabled")
+	ErrMFAUnavailable            = errors.New("mfa encryption key not configured")
+	ErrInvalidMFACode            = errors.New("invalid mfa code")
+	ErrLoginThrottled            = errors.New("too many failed login attempts")
+	ErrUnknownProvider           = errors.New("unknown identity provider")
+	ErrInvalidOIDCState          = errors.New("invalid or expired login state")
+	ErrOIDCLoginFailed           = errors.New("identity provider login failed")
+	ErrAccountDisabled           = errors.New("account disabled")
+	ErrAccountExists             = errors.New("an account with this email already exists, sign in with its password")
 )
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    hash bytea NOT NULL UNIQUE,
+    permissions text[] NOT NULL,
+    usage_count bigint NOT NULL DEFAULT 0,
+    last_used_at timestamp(0) with time zone,
+    revoked_at timestamp(0) with time zone,
+    UNIQUE (user_id, name)
+);
\ No newline at end of file
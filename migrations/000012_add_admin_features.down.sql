@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code = 'users:admin';
+DROP TABLE IF EXISTS audit_log;
+ALTER TABLE tokens DROP COLUMN IF EXISTS impersonator_id;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DELETE FROM roles WHERE name = 'contributor';
+DELETE FROM permissions WHERE code = 'movies:write:any';
+ALTER TABLE movies DROP COLUMN IF EXISTS created_by;
\ No newline at end of file
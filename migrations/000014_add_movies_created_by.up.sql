@@ -0,0 +1,15 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS created_by bigint REFERENCES users ON DELETE SET NULL;
+
+INSERT INTO permissions (code)
+VALUES
+    ('movies:write:any');
+
+INSERT INTO roles (name, description)
+VALUES
+    ('contributor', 'Read movies and edit the movies they created');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE (roles.name = 'contributor' AND permissions.code IN ('movies:read', 'movies:write'))
+OR (roles.name IN ('editor', 'admin') AND permissions.code = 'movies:write:any');
\ No newline at end of file
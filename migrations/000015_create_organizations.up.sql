@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    role text NOT NULL CHECK (role IN ('member', 'admin')),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id_idx ON organization_members (user_id);
+
+-- Existing movies and users move to a default organization
+INSERT INTO organizations (name)
+VALUES
+    ('Default');
+
+INSERT INTO organization_members (org_id, user_id, role)
+SELECT (SELECT min(id) FROM organizations), users.id,
+    CASE WHEN EXISTS (
+        SELECT 1 FROM users_roles
+        INNER JOIN roles ON roles.id = users_roles.role_id
+        WHERE users_roles.user_id = users.id AND roles.name = 'admin'
+    ) THEN 'admin' ELSE 'member' END
+FROM users;
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS org_id bigint REFERENCES organizations ON DELETE CASCADE;
+UPDATE movies SET org_id = (SELECT min(id) FROM organizations);
+ALTER TABLE movies ALTER COLUMN org_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS movies_org_id_idx ON movies (org_id);
\ No newline at end of file
@@ -0,0 +1,6 @@
+-- Buckets are cheap to lose, an unlogged table avoids WAL traffic on every request
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+    key text PRIMARY KEY,
+    tat double precision NOT NULL,
+    allowed boolean NOT NULL
+);
@@ -0,0 +1,8 @@
+INSERT INTO permissions (code)
+VALUES
+    ('metrics:read');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'metrics:read';
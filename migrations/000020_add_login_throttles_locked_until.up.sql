@@ -0,0 +1 @@
+ALTER TABLE login_throttles ADD COLUMN IF NOT EXISTS locked_until timestamp(0) with time zone NOT NULL DEFAULT NOW();
@@ -0,0 +1,191 @@
+// Package authz keeps the authorization policy of every route. Routes are
+// registered through a Group, which makes declaring a policy mandatory, and
+// Verify refuses to start a server with a route that has none.
+package authz
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Level int
+
+const (
+	// LevelPublic routes are open to anonymous users
+	LevelPublic Level = iota + 1
+	// LevelAuthenticated routes need any authenticated user
+	LevelAuthenticated
+	// LevelActivated routes need an authenticated and activated user
+	LevelActivated
+	// LevelPermission routes need an activated user holding Policy.Permission
+	LevelPermission
+)
+
+type Policy struct {
+	Level      Level
+	Permission string
+	// Owner routes change how the account is accessed, e.g. its email or
+	// credentials, and are refused to admins impersonating the user
+	Owner bool
+}
+
+func Public() Policy {
+	return Policy{Level: LevelPublic}
+}
+
+func Authenticated() Policy {
+	return Policy{Level: LevelAuthenticated}
+}
+
+func Activated() Policy {
+	return Policy{Level: LevelActivated}
+}
+
+func Permission(code string) Policy {
+	return Policy{Level: LevelPermission, Permission: code}
+}
+
+// OwnerOnly returns p refusing impersonated requests
+func (p Policy) OwnerOnly() Policy {
+	p.Owner = true
+	return p
+}
+
+func (p Policy) String() string {
+	var s string
+	switch p.Level {
+	case LevelPublic:
+		s = "public"
+	case LevelAuthenticated:
+		s = "authenticated"
+	case LevelActivated:
+		s = "activated"
+	case LevelPermission:
+		s = "permission " + p.Permission
+	default:
+		return "invalid"
+	}
+
+	if p.Owner {
+		s += ", owner only"
+	}
+	return s
+}
+
+// Policies maps a method and a route template, as returned by gin's
+// Context.FullPath, to its policy
+type Policies struct {
+	mu       sync.RWMutex
+	policies map[string]Policy
+}
+
+func New() *Policies {
+	return &Policies{
+		policies: map[string]Policy{},
+	}
+}
+
+// Lookup returns the policy declared for a route
+func (p *Policies) Lookup(method, fullPath string) (Policy, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	policy, ok := p.policies[key(method, fullPath)]
+	return policy, ok
+}
+
+func (p *Policies) set(method, fullPath string, policy Policy) {
+	if policy.Level < LevelPublic || policy.Level > LevelPermission ||
+		(policy.Level == LevelPermission && policy.Permission == "") {
+		panic(fmt.Sprintf("authz: invalid policy for %s %s", method, fullPath))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.policies[key(method, fullPath)] = policy
+}
+
+// Verify returns an error listing every route without a declared policy
+func (p *Policies) Verify(routes gin.RoutesInfo) error {
+	var missing []string
+	for _, route := range routes {
+		if _, ok := p.Lookup(route.Method, route.Path); !ok {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("authz: routes without a policy: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// Group registers routes on a gin router group together with their policy
+type Group struct {
+	group    *gin.RouterGroup
+	policies *Policies
+}
+
+func NewGroup(group *gin.RouterGroup, policies *Policies) *Group {
+	return &Group{
+		group:    group,
+		policies: policies,
+	}
+}
+
+// Group returns a sub group sharing the same policies
+func (g *Group) Group(relativePath string, handlers ...gin.HandlerFunc) *Group {
+	return NewGroup(g.group.Group(relativePath, handlers...), g.policies)
+}
+
+func (g *Group) Handle(method, relativePath string, policy Policy, handlers ...gin.HandlerFunc) {
+	g.policies.set(method, joinPaths(g.group.BasePath(), relativePath), policy)
+	g.group.Handle(method, relativePath, handlers...)
+}
+
+func (g *Group) GET(relativePath string, policy Policy, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodGet, relativePath, policy, handlers...)
+}
+
+func (g *Group) POST(relativePath string, policy Policy, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPost, relativePath, policy, handlers...)
+}
+
+func (g *Group) PUT(relativePath string, policy Policy, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPut, relativePath, policy, handlers...)
+}
+
+func (g *Group) PATCH(relativePath string, policy Policy, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodPatch, relativePath, policy, handlers...)
+}
+
+func (g *Group) DELETE(relativePath string, policy Policy, handlers ...gin.HandlerFunc) {
+	g.Handle(http.MethodDelete, relativePath, policy, handlers...)
+}
+
+func key(method, fullPath string) string {
+	return method + " " + fullPath
+}
+
+// joinPaths builds the full path of a route the same way gin does
+func joinPaths(absolutePath, relativePath string) string {
+	if relativePath == "" {
+		return absolutePath
+	}
+
+	finalPath := path.Join(absolutePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+
+	return finalPath
+}
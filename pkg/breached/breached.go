@@ -0,0 +1,187 @@
+package breached
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const prefixLength = 5
+
+// RangeSource returns the breached password hashes sharing a SHA-1 prefix, the
+// k-anonymity model used by breach corpora. Keys are the upper case hex
+// suffixes, values the number of times the password was seen.
+type RangeSource interface {
+	Range(prefix string) (map[string]int, error)
+}
+
+// Checker looks passwords up in a RangeSource. Only the first five hex digits
+// of the hash ever leave the checker, so a remote source can replace the file.
+type Checker struct {
+	source RangeSource
+}
+
+func NewChecker(source RangeSource) *Checker {
+	return &Checker{source: source}
+}
+
+// Count returns how many times password appears in the breach corpus
+func (c *Checker) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := c.source.Range(hash[:prefixLength])
+	if err != nil {
+		return 0, err
+	}
+
+	return suffixes[hash[prefixLength:]], nil
+}
+
+// File is a RangeSource reading a local file of "HASH:COUNT" lines, the SHA-1
+// hashes in upper case hex and the file sorted by hash. Ranges are found with
+// a binary search, the file is never loaded into memory.
+type File struct {
+	f    *os.File
+	size int64
+}
+
+func OpenFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &File{f: f, size: info.Size()}, nil
+}
+
+func (f *File) Close() error {
+	return f.f.Close()
+}
+
+func (f *File) Range(prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+	if len(prefix) != prefixLength {
+		return nil, errors.New("breached: range prefix must be 5 hex digits")
+	}
+
+	// Find the first line not sorting before prefix
+	lo, hi := int64(0), f.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, line, err := f.lineAfter(mid)
+		if err != nil {
+			return nil, err
+		}
+
+		if start >= f.size || !lessThanPrefix(line, prefix) {
+			hi = mid
+		} else {
+			lo = start + int64(len(line)) + 1
+		}
+	}
+
+	start := lo
+	if start > 0 {
+		var err error
+		start, _, err = f.lineAfter(start)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	suffixes := map[string]int{}
+
+	scanner := bufio.NewScanner(io.NewSectionReader(f.f, start, f.size-start))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, prefix) {
+			if line > prefix {
+				break
+			}
+			continue
+		}
+
+		hash, count, _ := strings.Cut(line, ":")
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			n = 1
+		}
+		suffixes[hash[prefixLength:]] = n
+	}
+
+	return suffixes, scanner.Err()
+}
+
+// lineAfter returns the first line starting at or after offset, offset 0 being
+// the start of the first line and any other offset the middle of a line
+func (f *File) lineAfter(offset int64) (int64, []byte, error) {
+	start := offset
+	if offset > 0 {
+		// offset-1 could be the newline ending the previous line
+		start = offset - 1
+	}
+
+	buf := make([]byte, 128)
+	var line []byte
+	skipping := offset > 0
+
+	for pos := start; pos < f.size; {
+		n, err := f.f.ReadAt(buf, pos)
+		if n == 0 && err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, nil, err
+		}
+
+		chunk := buf[:n]
+		if skipping {
+			i := bytes.IndexByte(chunk, '\n')
+			if i < 0 {
+				pos += int64(n)
+				continue
+			}
+			skipping = false
+			chunk = chunk[i+1:]
+			pos += int64(i + 1)
+			start = pos
+		}
+
+		if i := bytes.IndexByte(chunk, '\n'); i >= 0 {
+			line = append(line, chunk[:i]...)
+			return start, bytes.TrimRight(line, "\r"), nil
+		}
+		line = append(line, chunk...)
+		pos += int64(len(chunk))
+	}
+
+	if skipping {
+		return f.size, nil, nil
+	}
+
+	return start, bytes.TrimRight(line, "\r"), nil
+}
+
+func lessThanPrefix(line []byte, prefix string) bool {
+	if len(line) > len(prefix) {
+		line = line[:len(prefix)]
+	}
+	return string(line) < prefix
+}
@@ -0,0 +1,163 @@
+package emailpolicy
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+//go:embed disposable_domains.txt
+var disposableDomains string
+
+// Resolver looks up mail exchangers. *net.Resolver satisfies it, tests can
+// replace it with a stub.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// Violation is returned when an address is refused by the policy. Reason is
+// safe to show to the user.
+type Violation struct {
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return "email policy: " + v.Reason
+}
+
+type Config struct {
+	// Allow, when not empty, is the only set of domains accepted
+	Allow []string
+	Deny  []string
+	// BlockDisposable refuses the bundled list of throwaway providers
+	BlockDisposable bool
+	// CheckMX requires the domain to publish at least one mail exchanger
+	CheckMX   bool
+	MXTimeout time.Duration
+	Resolver  Resolver
+}
+
+type Policy struct {
+	allow      map[string]struct{}
+	deny       map[string]struct{}
+	disposable map[string]struct{}
+	checkMX    bool
+	mxTimeout  time.Duration
+	resolver   Resolver
+}
+
+func New(cfg Config) *Policy {
+	p := &Policy{
+		allow:     domainSet(cfg.Allow),
+		deny:      domainSet(cfg.Deny),
+		checkMX:   cfg.CheckMX,
+		mxTimeout: cfg.MXTimeout,
+		resolver:  cfg.Resolver,
+	}
+
+	if cfg.BlockDisposable {
+		p.disposable = domainSet(parseList(disposableDomains))
+	}
+
+	if p.mxTimeout == 0 {
+		p.mxTimeout = 3 * time.Second
+	}
+
+	if p.resolver == nil {
+		p.resolver = net.DefaultResolver
+	}
+
+	return p
+}
+
+// Check returns a *Violation if email is refused. Addresses are expected to
+// have passed the format check already. DNS failures other than a missing
+// domain let the address through, so a resolver outage does not block signups.
+func (p *Policy) Check(ctx context.Context, email string) error {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return &Violation{Reason: "must be a valid email address"}
+	}
+	domain := strings.TrimSuffix(strings.ToLower(email[at+1:]), ".")
+
+	if len(p.allow) > 0 && !matches(p.allow, domain) {
+		return &Violation{Reason: "must use an allowed email domain"}
+	}
+
+	if matches(p.deny, domain) {
+		return &Violation{Reason: "must not use this email domain"}
+	}
+
+	if matches(p.disposable, domain) {
+		return &Violation{Reason: "must not be a disposable email address"}
+	}
+
+	if p.checkMX {
+		ctx, cancel := context.WithTimeout(ctx, p.mxTimeout)
+		defer cancel()
+
+		records, err := p.resolver.LookupMX(ctx, domain)
+		var dnsErr *net.DNSError
+		switch {
+		case err == nil && len(records) == 0,
+			errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+			return &Violation{Reason: "must use a domain that accepts email"}
+		}
+	}
+
+	return nil
+}
+
+// ParseDomains splits a comma or space separated list of domains, as used by flags
+func ParseDomains(val string) []string {
+	return strings.FieldsFunc(val, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// matches reports whether domain or one of its parent domains is in set
+func matches(set map[string]struct{}, domain string) bool {
+	for domain != "" {
+		if _, ok := set[domain]; ok {
+			return true
+		}
+
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+
+	return false
+}
+
+func domainSet(domains []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			set[domain] = struct{}{}
+		}
+	}
+	return set
+}
+
+func parseList(list string) []string {
+	var domains []string
+
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+
+	return domains
+}
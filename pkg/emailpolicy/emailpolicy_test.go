@@ -0,0 +1,130 @@
+package emailpolicy_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"greenlight/pkg/emailpolicy"
+)
+
+// fakeResolver answers MX lookups from a map, domains missing from it do not exist
+type fakeResolver struct {
+	records map[string][]*net.MX
+	err     error
+	lookups []string
+}
+
+func (r *fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	r.lookups = append(r.lookups, name)
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	records, ok := r.records[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	return records, nil
+}
+
+func TestCheck(t *testing.T) {
+	resolver := &fakeResolver{records: map[string][]*net.MX{
+		"example.com":    {{Host: "mx.example.com.", Pref: 10}},
+		"corp.test":      {{Host: "mx.corp.test.", Pref: 10}},
+		"nomail.test":    {},
+		"mailinator.com": {{Host: "mx.mailinator.com.", Pref: 10}},
+	}}
+
+	for _, tc := range []struct {
+		name   string
+		config emailpolicy.Config
+		email  string
+		reason string
+	}{
+		{"no rules", emailpolicy.Config{}, "alice@anything.test", ""},
+		{"not an address", emailpolicy.Config{}, "alice", "must be a valid email address"},
+
+		{"allowed domain", emailpolicy.Config{Allow: []string{"corp.test"}}, "alice@corp.test", ""},
+		{"allowed parent domain", emailpolicy.Config{Allow: []string{"corp.test"}}, "alice@eu.corp.test", ""},
+		{"allow is case insensitive", emailpolicy.Config{Allow: []string{"Corp.Test"}}, "alice@CORP.test", ""},
+		{"outside the allow-list", emailpolicy.Config{Allow: []string{"corp.test"}}, "alice@example.com", "must use an allowed email domain"},
+		{"suffix is not a parent", emailpolicy.Config{Allow: []string{"corp.test"}}, "alice@evilcorp.test", "must use an allowed email domain"},
+
+		{"denied domain", emailpolicy.Config{Deny: []string{"spam.test"}}, "alice@spam.test", "must not use this email domain"},
+		{"denied parent domain", emailpolicy.Config{Deny: []string{"spam.test"}}, "alice@a.spam.test", "must not use this email domain"},
+		{"trailing dot", emailpolicy.Config{Deny: []string{"spam.test"}}, "alice@spam.test.", "must not use this email domain"},
+		{"deny wins over allow", emailpolicy.Config{Allow: []string{"corp.test"}, Deny: []string{"contractors.corp.test"}}, "bob@contractors.corp.test", "must not use this email domain"},
+
+		{"disposable", emailpolicy.Config{BlockDisposable: true}, "alice@mailinator.com", "must not be a disposable email address"},
+		{"disposable subdomain", emailpolicy.Config{BlockDisposable: true}, "alice@eu.10minutemail.com", "must not be a disposable email address"},
+		{"disposable allowed", emailpolicy.Config{}, "alice@mailinator.com", ""},
+		{"not disposable", emailpolicy.Config{BlockDisposable: true}, "alice@example.com", ""},
+
+		{"mx present", emailpolicy.Config{CheckMX: true}, "alice@example.com", ""},
+		{"mx absent", emailpolicy.Config{CheckMX: true}, "alice@nomail.test", "must use a domain that accepts email"},
+		{"domain does not exist", emailpolicy.Config{CheckMX: true}, "alice@missing.test", "must use a domain that accepts email"},
+		{"mx not checked", emailpolicy.Config{}, "alice@missing.test", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Resolver = resolver
+			err := emailpolicy.New(tc.config).Check(context.Background(), tc.email)
+
+			if tc.reason == "" {
+				if err != nil {
+					t.Fatalf("got error %v, want none", err)
+				}
+				return
+			}
+
+			var violation *emailpolicy.Violation
+			if !errors.As(err, &violation) {
+				t.Fatalf("got error %v, want a violation", err)
+			}
+			if violation.Reason != tc.reason {
+				t.Errorf("got reason %q, want %q", violation.Reason, tc.reason)
+			}
+		})
+	}
+}
+
+// TestCheckResolverFailure lets addresses through when DNS fails for another
+// reason than a missing domain
+func TestCheckResolverFailure(t *testing.T) {
+	resolver := &fakeResolver{err: &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}}
+	policy := emailpolicy.New(emailpolicy.Config{CheckMX: true, Resolver: resolver})
+
+	err := policy.Check(context.Background(), "alice@Example.com")
+	if err != nil {
+		t.Fatalf("got error %v, want none", err)
+	}
+	if want := []string{"example.com"}; !reflect.DeepEqual(resolver.lookups, want) {
+		t.Errorf("got lookups %v, want %v", resolver.lookups, want)
+	}
+}
+
+// TestCheckMXAfterRules does not query DNS for addresses the lists refuse
+func TestCheckMXAfterRules(t *testing.T) {
+	resolver := &fakeResolver{}
+	policy := emailpolicy.New(emailpolicy.Config{Deny: []string{"spam.test"}, CheckMX: true, Resolver: resolver})
+
+	err := policy.Check(context.Background(), "alice@spam.test")
+	if err == nil {
+		t.Fatal("a denied address was accepted")
+	}
+	if len(resolver.lookups) != 0 {
+		t.Errorf("got lookups %v, want none", resolver.lookups)
+	}
+}
+
+func TestParseDomains(t *testing.T) {
+	got := emailpolicy.ParseDomains("example.com, corp.test,,spam.test  other.test")
+	want := []string{"example.com", "corp.test", "spam.test", "other.test"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 
+	orgmodels "greenlight/internal/organizations/models"
+	permissionsmodels "greenlight/internal/permissions/models"
 	"greenlight/internal/users/models"
 
 	"github.com/gin-gonic/gin"
@@ -11,10 +13,18 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey         = contextKey("user")
+	permissionsContextKey  = contextKey("permissions")
+	apiKeyContextKey       = contextKey("apiKey")
+	impersonatorContextKey = contextKey("impersonator")
+	tokenOrgContextKey     = contextKey("tokenOrg")
+	scopeContextKey        = contextKey("scope")
+	requestIDContextKey    = contextKey("requestID")
+)
 
 func ContextSetUser(ctx *gin.Context, user models.User) {
-	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx, userContextKey, user))
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), userContextKey, user))
 }
 
 func ContextGetUser(ctx *gin.Context) (models.User, error) {
@@ -25,6 +35,73 @@ func ContextGetUser(ctx *gin.Context) (models.User, error) {
 	return user, nil
 }
 
+// ContextSetPermissions stores permissions that were already resolved while
+// authenticating, e.g. the ones carried by a JWT, so they are not looked up again
+func ContextSetPermissions(ctx *gin.Context, permissions permissionsmodels.Permissions) {
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), permissionsContextKey, permissions))
+}
+
+func ContextGetPermissions(ctx *gin.Context) (permissionsmodels.Permissions, bool) {
+	return GetFromContext[permissionsmodels.Permissions](ctx, permissionsContextKey)
+}
+
+// ContextSetAPIKeyID marks the request as authenticated through an API key
+func ContextSetAPIKeyID(ctx *gin.Context, id int64) {
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), apiKeyContextKey, id))
+}
+
+func ContextGetAPIKeyID(ctx *gin.Context) (int64, bool) {
+	return GetFromContext[int64](ctx, apiKeyContextKey)
+}
+
+// ContextSetImpersonator marks the request as made by an admin impersonating the
+// user, through a token issued by the admin API
+func ContextSetImpersonator(ctx *gin.Context, impersonatorID int64) {
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), impersonatorContextKey, impersonatorID))
+}
+
+func ContextGetImpersonator(ctx *gin.Context) (int64, bool) {
+	return GetFromContext[int64](ctx, impersonatorContextKey)
+}
+
+// ContextSetTokenOrganization records the organization the access token is bound to
+func ContextSetTokenOrganization(ctx *gin.Context, orgID int64) {
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), tokenOrgContextKey, orgID))
+}
+
+func ContextGetTokenOrganization(ctx *gin.Context) (int64, bool) {
+	return GetFromContext[int64](ctx, tokenOrgContextKey)
+}
+
+// ContextSetScope stores the active organization of the request, once membership was checked
+func ContextSetScope(ctx *gin.Context, scope orgmodels.Scope) {
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), scopeContextKey, scope))
+}
+
+func ContextGetScope(ctx *gin.Context) (orgmodels.Scope, error) {
+	scope, ok := GetFromContext[orgmodels.Scope](ctx, scopeContextKey)
+	if !ok || scope.IsZero() {
+		return orgmodels.Scope{}, errors.New("missing organization scope in request context")
+	}
+	return scope, nil
+}
+
+// ContextSetRequestID stores the ID identifying the request in logs
+func ContextSetRequestID(ctx *gin.Context, id string) {
+	ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), requestIDContextKey, id))
+}
+
+func ContextGetRequestID(ctx *gin.Context) (string, bool) {
+	return GetFromContext[string](ctx, requestIDContextKey)
+}
+
+// RequestIDFromContext returns the request ID from the context handed to
+// services, or an empty string outside of a request
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
 func GetFromContext[T any](ctx *gin.Context, key any) (T, bool) {
 	value := ctx.Request.Context().Value(key)
 	if value == nil {
@@ -0,0 +1,290 @@
+package httphelpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"greenlight/pkg/msgpack"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Encoder writes response payloads in one media type. Aliases are other media
+// types clients may ask for to get the same encoding. ProblemContentType is
+// the media type of error responses, ContentType when empty.
+type Encoder struct {
+	ContentType        ContentType
+	Aliases            []string
+	ProblemContentType ContentType
+	Marshal            func(v any) ([]byte, error)
+}
+
+// encoders in order of preference, the first one is used when the client does
+// not send Accept or accepts none of them
+var encoders = []Encoder{
+	{ContentType: ContentTypeJSON, ProblemContentType: ContentTypeProblemJSON, Marshal: marshalJSON},
+	{ContentType: ContentTypeXML, Aliases: []string{"text/xml"}, ProblemContentType: ContentTypeProblemXML, Marshal: marshalXML},
+	{ContentType: ContentTypeMsgPack, Aliases: []string{"application/x-msgpack", "application/vnd.msgpack"}, Marshal: marshalMsgPack},
+}
+
+// RegisterEncoder adds an encoder, or replaces the one with the same content
+// type. Call it at startup, before serving requests.
+func RegisterEncoder(encoder Encoder) {
+	for i, e := range encoders {
+		if e.ContentType == encoder.ContentType {
+			encoders[i] = encoder
+			return
+		}
+	}
+	encoders = append(encoders, encoder)
+}
+
+func encoderFor(contentType ContentType) (Encoder, bool) {
+	for _, e := range encoders {
+		if e.ContentType == contentType {
+			return e, true
+		}
+	}
+	return Encoder{}, false
+}
+
+// NegotiateEncoder picks the encoder the Accept header prefers. Ties go to the
+// server's order of preference, so "*/*" gets JSON.
+func NegotiateEncoder(accept string) Encoder {
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return encoders[0]
+	}
+
+	best, bestQ := encoders[0], 0.0
+	for _, e := range encoders {
+		q := e.quality(ranges)
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+
+	return best
+}
+
+// quality returns the q value of the most specific range matching e
+func (e Encoder) quality(ranges []mediaRange) float64 {
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		for _, mediaType := range append([]string{string(e.ContentType)}, e.Aliases...) {
+			s, ok := r.match(mediaType)
+			if ok && s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+	}
+	return q
+}
+
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// match reports whether r covers mediaType, and how specifically: 0 for */*,
+// 1 for type/* and 2 for an exact match
+func (r mediaRange) match(mediaType string) (int, bool) {
+	switch {
+	case r.mediaType == mediaType:
+		return 2, true
+	case r.mediaType == "*/*":
+		return 0, true
+	case strings.HasSuffix(r.mediaType, "/*"):
+		return 1, strings.HasPrefix(mediaType, strings.TrimSuffix(r.mediaType, "*"))
+	}
+	return 0, false
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err == nil && parsed >= 0 && parsed <= 1 {
+					q = parsed
+				}
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// WriteResponse writes data in the format negotiated from the Accept header,
+// indented JSON unless the client asks for XML or MessagePack
+func WriteResponse(c *gin.Context, status int, data any, headers http.Header) error {
+	encoder := NegotiateEncoder(c.GetHeader("Accept"))
+
+	body, err := encoder.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range headers {
+		c.Writer.Header()[key] = value
+	}
+
+	c.Writer.Header().Add("Vary", "Accept")
+	c.Writer.Header().Set("Content-Type", string(encoder.ContentType))
+	c.Writer.WriteHeader(status)
+	c.Writer.Write(body)
+
+	return nil
+}
+
+func marshalJSON(v any) ([]byte, error) {
+	js, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(js, '\n'), nil
+}
+
+func marshalMsgPack(v any) ([]byte, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(generic)
+}
+
+// toGeneric turns v into maps, slices and scalars through its JSON encoding,
+// so every format uses the JSON field names and custom marshalers
+func toGeneric(v any) (any, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.UseNumber()
+
+	var generic any
+	err = decoder.Decode(&generic)
+	return generic, err
+}
+
+// marshalXML writes v under a <response> element. Object members become
+// elements named after their keys, or <entry key="..."> when the key is not a
+// valid element name, and array values become <item> elements. Values
+// implementing xml.Marshaler choose their own element.
+func marshalXML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "\t")
+
+	if m, ok := v.(xml.Marshaler); ok {
+		err := encoder.Encode(m)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		generic, err := toGeneric(v)
+		if err != nil {
+			return nil, err
+		}
+
+		err = encodeXMLElement(encoder, xml.StartElement{Name: xml.Name{Local: "response"}}, generic)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := encoder.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func encodeXMLElement(encoder *xml.Encoder, start xml.StartElement, v any) error {
+	err := encoder.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := xml.StartElement{Name: xml.Name{Local: key}}
+			if !validXMLName(key) {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "entry"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+				}
+			}
+
+			err = encodeXMLElement(encoder, child, v[key])
+			if err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			err = encodeXMLElement(encoder, xml.StartElement{Name: xml.Name{Local: "item"}}, item)
+			if err != nil {
+				return err
+			}
+		}
+	case nil:
+	case string:
+		err = encoder.EncodeToken(xml.CharData(v))
+	case json.Number:
+		err = encoder.EncodeToken(xml.CharData(v.String()))
+	case bool:
+		err = encoder.EncodeToken(xml.CharData(strconv.FormatBool(v)))
+	}
+	if err != nil {
+		return err
+	}
+
+	return encoder.EncodeToken(start.End())
+}
+
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r == '-' || r == '.' || r >= '0' && r <= '9'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
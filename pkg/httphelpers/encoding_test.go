@@ -0,0 +1,174 @@
+package httphelpers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"greenlight/pkg/httphelpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoder(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		want   httphelpers.ContentType
+	}{
+		{"", httphelpers.ContentTypeJSON},
+		{" , ", httphelpers.ContentTypeJSON},
+		{"*/*", httphelpers.ContentTypeJSON},
+		{"application/json", httphelpers.ContentTypeJSON},
+		{"application/xml", httphelpers.ContentTypeXML},
+		{"APPLICATION/XML", httphelpers.ContentTypeXML},
+		{"text/xml", httphelpers.ContentTypeXML},
+		{"application/msgpack", httphelpers.ContentTypeMsgPack},
+		{"application/x-msgpack", httphelpers.ContentTypeMsgPack},
+		{"application/vnd.msgpack", httphelpers.ContentTypeMsgPack},
+
+		{"application/xml;q=0.5, application/json;q=0.9", httphelpers.ContentTypeJSON},
+		{"application/json;q=0.5, application/msgpack", httphelpers.ContentTypeMsgPack},
+		{"application/xml, application/msgpack", httphelpers.ContentTypeXML},
+		{"application/msgpack, application/xml", httphelpers.ContentTypeXML},
+		{"text/*", httphelpers.ContentTypeXML},
+		{"application/json;q=0.1, application/*;q=0.8", httphelpers.ContentTypeXML},
+		{"application/json;q=0, */*;q=0.1", httphelpers.ContentTypeXML},
+		{"application/xml; charset=utf-8; q=0.7, */*;q=0.5", httphelpers.ContentTypeXML},
+		{"application/xml;q=2, application/json;q=0.9", httphelpers.ContentTypeXML},
+		{"application/xml;q=abc, application/json;q=0.9", httphelpers.ContentTypeXML},
+
+		// Nothing acceptable falls back to JSON rather than 406
+		{"text/html", httphelpers.ContentTypeJSON},
+		{"application/json;q=0", httphelpers.ContentTypeJSON},
+	} {
+		got := httphelpers.NegotiateEncoder(tc.accept)
+		if got.ContentType != tc.want {
+			t.Errorf("Accept %q: got %s, want %s", tc.accept, got.ContentType, tc.want)
+		}
+	}
+}
+
+// writeResponse records the response to a request sending accept
+func writeResponse(t *testing.T, accept string, data any) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/movies/1", nil)
+	if accept != "" {
+		c.Request.Header.Set("Accept", accept)
+	}
+
+	err := httphelpers.WriteResponse(c, http.StatusOK, data, http.Header{"X-Test": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+type movie struct {
+	ID      int64    `json:"id"`
+	Title   string   `json:"title"`
+	Year    int32    `json:"year,omitempty"`
+	Genres  []string `json:"genres"`
+	Runtime *int32   `json:"runtime"`
+}
+
+var envelope = map[string]any{
+	"movie": movie{ID: 1, Title: "Casablanca & Co", Genres: []string{"drama", "romance"}},
+	"2fa":   true,
+}
+
+func TestWriteResponse(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"no accept", "", "application/json", `{
+	"2fa": true,
+	"movie": {
+		"id": 1,
+		"title": "Casablanca \u0026 Co",
+		"genres": [
+			"drama",
+			"romance"
+		],
+		"runtime": null
+	}
+}
+`},
+		{"xml", "application/xml", "application/xml", `<?xml version="1.0" encoding="UTF-8"?>
+<response>
+	<entry key="2fa">true</entry>
+	<movie>
+		<genres>
+			<item>drama</item>
+			<item>romance</item>
+		</genres>
+		<id>1</id>
+		<runtime></runtime>
+		<title>Casablanca &amp; Co</title>
+	</movie>
+</response>
+`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := writeResponse(t, tc.accept, envelope)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tc.contentType {
+				t.Errorf("got Content-Type %q, want %q", got, tc.contentType)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("got Vary %q, want Accept", got)
+			}
+			if got := rec.Header().Get("X-Test"); got != "1" {
+				t.Errorf("got X-Test %q, want the extra header", got)
+			}
+			if rec.Body.String() != tc.body {
+				t.Errorf("got body\n%s\nwant\n%s", rec.Body, tc.body)
+			}
+		})
+	}
+}
+
+// TestWriteResponseMsgPack checks MessagePack uses the JSON field names, so
+// omitempty applies and keys are sorted
+func TestWriteResponseMsgPack(t *testing.T) {
+	rec := writeResponse(t, "application/msgpack", envelope)
+
+	if got := rec.Header().Get("Content-Type"); got != "application/msgpack" {
+		t.Errorf("got Content-Type %q, want application/msgpack", got)
+	}
+
+	var want []byte
+	want = append(want, 0x82) // map of 2
+	want = append(want, fixstr("2fa")...)
+	want = append(want, 0xc3)
+	want = append(want, fixstr("movie")...)
+	want = append(want, 0x84) // year is omitted
+	want = append(want, fixstr("genres")...)
+	want = append(want, 0x92)
+	want = append(want, fixstr("drama")...)
+	want = append(want, fixstr("romance")...)
+	want = append(want, fixstr("id")...)
+	want = append(want, 0x01)
+	want = append(want, fixstr("runtime")...)
+	want = append(want, 0xc0)
+	want = append(want, fixstr("title")...)
+	want = append(want, fixstr("Casablanca & Co")...)
+
+	if !bytes.Equal(rec.Body.Bytes(), want) {
+		t.Errorf("got % x, want % x", rec.Body.Bytes(), want)
+	}
+}
+
+func fixstr(s string) []byte {
+	return append([]byte{0xa0 | byte(len(s))}, s...)
+}
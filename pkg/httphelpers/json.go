@@ -43,25 +43,6 @@ func jsonDecode(c *gin.Context, v any, allowUnknownFields bool) error {
 	return nil
 }
 
-func WriteJSON(c *gin.Context, status int, data any, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
-	if err != nil {
-		return err
-	}
-
-	js = append(js, '\n')
-
-	for key, value := range headers {
-		c.Writer.Header()[key] = value
-	}
-
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.WriteHeader(status)
-	c.Writer.Write(js)
-
-	return nil
-}
-
 func ReadJSON(c *gin.Context, dst any) error {
 	maxBytes := 1_048_576
 	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxBytes))
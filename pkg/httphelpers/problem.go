@@ -0,0 +1,150 @@
+package httphelpers
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ContentTypeProblemJSON ContentType = "application/problem+json"
+	ContentTypeProblemXML  ContentType = "application/problem+xml"
+
+	problemTypePrefix = "urn:greenlight:problem:"
+)
+
+// ErrorCode identifies the kind of an error response. Codes are stable, they
+// are the part of a problem clients should switch on, titles and details may
+// change.
+type ErrorCode string
+
+const (
+	CodeBadRequest           ErrorCode = "bad_request"
+	CodeValidationFailed     ErrorCode = "validation_failed"
+	CodeUnauthorized         ErrorCode = "unauthorized"
+	CodeInvalidCredentials   ErrorCode = "invalid_credentials"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeActivationRequired   ErrorCode = "activation_required"
+	CodeAccountDisabled      ErrorCode = "account_disabled"
+	CodeAccountExists        ErrorCode = "account_exists"
+	CodeMFARequired          ErrorCode = "mfa_required"
+	CodeImpersonated         ErrorCode = "impersonated"
+	CodeMFANotConfigured     ErrorCode = "mfa_not_configured"
+	CodeMFAUnavailable       ErrorCode = "mfa_unavailable"
+	CodeNotFound             ErrorCode = "not_found"
+	CodeMethodNotAllowed     ErrorCode = "method_not_allowed"
+	CodeEditConflict         ErrorCode = "edit_conflict"
+	CodeIdempotencyKeyInUse  ErrorCode = "idempotency_key_in_use"
+	CodeIdempotencyKeyReused ErrorCode = "idempotency_key_reused"
+	CodeRateLimited          ErrorCode = "rate_limited"
+	CodeLoginThrottled       ErrorCode = "login_throttled"
+	CodeInternalError        ErrorCode = "internal_error"
+)
+
+type problemType struct {
+	status int
+	title  string
+}
+
+// problemTypes is the error code catalogue
+var problemTypes = map[ErrorCode]problemType{
+	CodeBadRequest:           {http.StatusBadRequest, "Bad request"},
+	CodeValidationFailed:     {http.StatusUnprocessableEntity, "Validation failed"},
+	CodeUnauthorized:         {http.StatusUnauthorized, "Authentication required"},
+	CodeInvalidCredentials:   {http.StatusUnauthorized, "Invalid authentication credentials"},
+	CodeForbidden:            {http.StatusForbidden, "Forbidden"},
+	CodeActivationRequired:   {http.StatusForbidden, "Account activation required"},
+	CodeAccountDisabled:      {http.StatusForbidden, "Account disabled"},
+	CodeAccountExists:        {http.StatusConflict, "Account already exists"},
+	CodeMFARequired:          {http.StatusForbidden, "Two-factor authentication required"},
+	CodeImpersonated:         {http.StatusForbidden, "Not allowed while impersonating"},
+	CodeMFANotConfigured:     {http.StatusNotImplemented, "Two-factor authentication not configured"},
+	CodeMFAUnavailable:       {http.StatusServiceUnavailable, "Two-factor authentication unavailable"},
+	CodeNotFound:             {http.StatusNotFound, "Not found"},
+	CodeMethodNotAllowed:     {http.StatusMethodNotAllowed, "Method not allowed"},
+	CodeEditConflict:         {http.StatusConflict, "Edit conflict"},
+	CodeIdempotencyKeyInUse:  {http.StatusConflict, "Idempotency key in use"},
+	CodeIdempotencyKeyReused: {http.StatusUnprocessableEntity, "Idempotency key reused"},
+	CodeRateLimited:          {http.StatusTooManyRequests, "Rate limit exceeded"},
+	CodeLoginThrottled:       {http.StatusTooManyRequests, "Too many failed login attempts"},
+	CodeInternalError:        {http.StatusInternalServerError, "Internal server error"},
+}
+
+// Problem is an RFC 7807 problem details object. Code and RequestID are
+// extension members, and so are Errors, the field errors of a failed validation.
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Code      ErrorCode         `json:"code"`
+	RequestID string            `json:"request_id,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// NewProblem returns the problem of code with its catalogue status and title
+func NewProblem(code ErrorCode, detail string) Problem {
+	t, ok := problemTypes[code]
+	if !ok {
+		t = problemTypes[CodeInternalError]
+	}
+
+	return Problem{
+		Type:   problemTypePrefix + string(code),
+		Title:  t.title,
+		Status: t.status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// MarshalXML writes the problem in the RFC 7807 XML format
+func (p Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	generic, err := toGeneric(p)
+	if err != nil {
+		return err
+	}
+
+	start = xml.StartElement{
+		Name: xml.Name{Local: "problem"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: "urn:ietf:rfc:7807"}},
+	}
+	return encodeXMLElement(e, start, generic)
+}
+
+// WriteProblem writes p in the format negotiated from the Accept header,
+// problem+json unless the client asks for XML or MessagePack. The instance
+// and request ID are filled from the request.
+func WriteProblem(c *gin.Context, p Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	if id, ok := ContextGetRequestID(c); ok {
+		p.RequestID = id
+	}
+
+	encoder := NegotiateEncoder(c.GetHeader("Accept"))
+	contentType := encoder.ProblemContentType
+	if contentType == "" {
+		contentType = encoder.ContentType
+	}
+
+	body, err := encoder.Marshal(p)
+	if err != nil {
+		c.Error(err)
+		c.Status(p.Status)
+		return
+	}
+
+	c.Writer.Header().Add("Vary", "Accept")
+	c.Writer.Header().Set("Content-Type", string(contentType))
+	c.Writer.WriteHeader(p.Status)
+	c.Writer.Write(body)
+}
+
+// ProblemResponse writes the problem of code, detail explaining this occurrence
+func ProblemResponse(c *gin.Context, code ErrorCode, detail string) {
+	WriteProblem(c, NewProblem(code, detail))
+}
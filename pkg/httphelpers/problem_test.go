@@ -0,0 +1,182 @@
+package httphelpers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"greenlight/pkg/httphelpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// problemContext returns a context for a request to /v1/movies/1 sending
+// accept, with a request ID
+func problemContext(method, accept string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(method, "/v1/movies/1?fields=title", nil)
+	if accept != "" {
+		c.Request.Header.Set("Accept", accept)
+	}
+	httphelpers.ContextSetRequestID(c, "req-1")
+
+	return c, rec
+}
+
+func TestWriteProblem(t *testing.T) {
+	fieldErrors := map[string]string{"year": "must not be in the future", "title": "must be provided"}
+
+	for _, tc := range []struct {
+		name        string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"no accept", "", "application/problem+json", `{
+	"type": "urn:greenlight:problem:validation_failed",
+	"title": "Validation failed",
+	"status": 422,
+	"detail": "the request has invalid fields",
+	"instance": "/v1/movies/1",
+	"code": "validation_failed",
+	"request_id": "req-1",
+	"errors": {
+		"title": "must be provided",
+		"year": "must not be in the future"
+	}
+}
+`},
+		{"json", "application/json", "application/problem+json", ""},
+		{"xml", "application/xml", "application/problem+xml", `<?xml version="1.0" encoding="UTF-8"?>
+<problem xmlns="urn:ietf:rfc:7807">
+	<code>validation_failed</code>
+	<detail>the request has invalid fields</detail>
+	<errors>
+		<title>must be provided</title>
+		<year>must not be in the future</year>
+	</errors>
+	<instance>/v1/movies/1</instance>
+	<request_id>req-1</request_id>
+	<status>422</status>
+	<title>Validation failed</title>
+	<type>urn:greenlight:problem:validation_failed</type>
+</problem>
+`},
+		{"text/xml", "text/xml", "application/problem+xml", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, rec := problemContext(http.MethodPut, tc.accept)
+			httphelpers.StatusUnprocesableEntities(c, fieldErrors)
+
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("got status %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tc.contentType {
+				t.Errorf("got Content-Type %q, want %q", got, tc.contentType)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("got Vary %q, want Accept", got)
+			}
+			if tc.body != "" && rec.Body.String() != tc.body {
+				t.Errorf("got body\n%s\nwant\n%s", rec.Body, tc.body)
+			}
+		})
+	}
+}
+
+// TestWriteProblemMsgPack falls back to the encoder's own content type, there
+// is no problem media type for MessagePack
+func TestWriteProblemMsgPack(t *testing.T) {
+	c, rec := problemContext(http.MethodGet, "application/msgpack")
+	httphelpers.StatusNotFoundResponse(c)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/msgpack" {
+		t.Errorf("got Content-Type %q, want application/msgpack", got)
+	}
+	if body := rec.Body.Bytes(); len(body) == 0 || body[0] != 0x87 {
+		t.Errorf("got % x, want a map of 7 members", body)
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		write  func(c *gin.Context)
+		status int
+		body   string
+	}{
+		{"method not allowed", httphelpers.StatusMethodNotAllowedResponse, http.StatusMethodNotAllowed, `{
+	"type": "urn:greenlight:problem:method_not_allowed",
+	"title": "Method not allowed",
+	"status": 405,
+	"detail": "the DELETE method is not supported for this resource",
+	"instance": "/v1/movies/1",
+	"code": "method_not_allowed",
+	"request_id": "req-1"
+}
+`},
+		{"internal error hides the error", func(c *gin.Context) {
+			httphelpers.StatusInternalServerErrorResponse(c, errors.New("pq: connection refused"))
+		}, http.StatusInternalServerError, `{
+	"type": "urn:greenlight:problem:internal_error",
+	"title": "Internal server error",
+	"status": 500,
+	"detail": "the server encountered a problem and could not process your request",
+	"instance": "/v1/movies/1",
+	"code": "internal_error",
+	"request_id": "req-1"
+}
+`},
+		{"unknown code", func(c *gin.Context) {
+			httphelpers.ProblemResponse(c, "no_such_code", "")
+		}, http.StatusInternalServerError, `{
+	"type": "urn:greenlight:problem:no_such_code",
+	"title": "Internal server error",
+	"status": 500,
+	"instance": "/v1/movies/1",
+	"code": "no_such_code",
+	"request_id": "req-1"
+}
+`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, rec := problemContext(http.MethodDelete, "")
+			tc.write(c)
+
+			if rec.Code != tc.status {
+				t.Errorf("got status %d, want %d", rec.Code, tc.status)
+			}
+			if rec.Body.String() != tc.body {
+				t.Errorf("got body\n%s\nwant\n%s", rec.Body, tc.body)
+			}
+		})
+	}
+}
+
+// TestInternalErrorAfterWrite keeps the response already sent and records the error
+func TestInternalErrorAfterWrite(t *testing.T) {
+	c, rec := problemContext(http.MethodGet, "")
+
+	err := httphelpers.StatusOKJSONPayloadResponse(c, map[string]int{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	httphelpers.StatusInternalServerErrorResponse(c, errors.New("late failure"))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if want := "{\n\t\"id\": 1\n}\n"; rec.Body.String() != want {
+		t.Errorf("got body %q, want %q", rec.Body, want)
+	}
+	if len(c.Errors) != 1 {
+		t.Errorf("got %d context errors, want 1", len(c.Errors))
+	}
+}
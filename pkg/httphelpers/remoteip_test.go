@@ -0,0 +1,119 @@
+package httphelpers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"greenlight/pkg/httphelpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func trustProxies(t *testing.T, val string) {
+	t.Helper()
+
+	prefixes, err := httphelpers.ParseTrustedProxies(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httphelpers.SetTrustedProxies(prefixes)
+	t.Cleanup(func() { httphelpers.SetTrustedProxies(nil) })
+}
+
+func remoteIP(remoteAddr string, header http.Header) string {
+	gin.SetMode(gin.TestMode)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = remoteAddr
+	for name, values := range header {
+		c.Request.Header[name] = values
+	}
+
+	return httphelpers.RemoteIP(c)
+}
+
+func TestRemoteIP(t *testing.T) {
+	trustProxies(t, "10.0.0.0/8, 2001:db8:ffff::/48")
+
+	const proxy = "10.0.0.1:443"
+
+	for _, tc := range []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		want       string
+	}{
+		{"direct client", "203.0.113.9:1234", nil, "203.0.113.9"},
+		{"untrusted peer sending X-Forwarded-For", "203.0.113.9:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.9"},
+		{"untrusted peer sending Forwarded", "203.0.113.9:1234", http.Header{"Forwarded": {"for=198.51.100.1"}}, "203.0.113.9"},
+		{"untrusted peer inside a trusted hop", "203.0.113.9:1234", http.Header{"X-Forwarded-For": {"10.0.0.2"}}, "203.0.113.9"},
+		{"no port", "203.0.113.9", nil, "203.0.113.9"},
+		{"trusted peer without headers", proxy, nil, "10.0.0.1"},
+
+		{"one hop", proxy, http.Header{"X-Forwarded-For": {"203.0.113.7"}}, "203.0.113.7"},
+		{"forged leading entry", proxy, http.Header{"X-Forwarded-For": {"198.51.100.66, 203.0.113.7"}}, "203.0.113.7"},
+		{"forged trusted leading entry", proxy, http.Header{"X-Forwarded-For": {"10.9.9.9, 203.0.113.7"}}, "203.0.113.7"},
+		{"trusted hops walked", proxy, http.Header{"X-Forwarded-For": {"198.51.100.66, 203.0.113.7, 10.0.0.3, 10.0.0.2"}}, "203.0.113.7"},
+		{"header repeated", proxy, http.Header{"X-Forwarded-For": {"198.51.100.66", "203.0.113.7, 10.0.0.2"}}, "203.0.113.7"},
+		{"every hop trusted", proxy, http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3"},
+		{"hop with a port", proxy, http.Header{"X-Forwarded-For": {"203.0.113.7:5555"}}, "203.0.113.7"},
+		{"garbled hop", proxy, http.Header{"X-Forwarded-For": {"203.0.113.7, garbage"}}, "10.0.0.1"},
+		{"mapped peer", "[::ffff:10.0.0.1]:443", http.Header{"X-Forwarded-For": {"203.0.113.7"}}, "203.0.113.7"},
+		{"mapped hop", proxy, http.Header{"X-Forwarded-For": {"::ffff:203.0.113.7"}}, "203.0.113.7"},
+
+		{"forwarded", proxy, http.Header{"Forwarded": {"for=192.0.2.60;proto=http;by=203.0.113.43"}}, "192.0.2.60"},
+		{"forwarded parameter case", proxy, http.Header{"Forwarded": {"For=192.0.2.60"}}, "192.0.2.60"},
+		{"forwarded quoted ipv6 with port", proxy, http.Header{"Forwarded": {`for="[2001:db8:cafe::17]:4711"`}}, "2001:db8:cafe::17"},
+		{"forwarded quoted ipv6", proxy, http.Header{"Forwarded": {`for="[2001:db8:cafe::17]";proto=https, for=10.0.0.2`}}, "2001:db8:cafe::17"},
+		{"forwarded trusted ipv6 hop", proxy, http.Header{"Forwarded": {`for=198.51.100.66, for="[2001:db8:ffff::1]"`}}, "198.51.100.66"},
+		{"forwarded forged leading entry", proxy, http.Header{"Forwarded": {"for=198.51.100.66, for=192.0.2.60"}}, "192.0.2.60"},
+		{"forwarded quoted separators", proxy, http.Header{"Forwarded": {`for=198.51.100.66;ext="a,b;for=10.0.0.9"`}}, "198.51.100.66"},
+		{"forwarded obfuscated", proxy, http.Header{"Forwarded": {"for=192.0.2.60, for=_hidden"}}, "10.0.0.1"},
+		{"forwarded unknown", proxy, http.Header{"Forwarded": {"for=unknown"}}, "10.0.0.1"},
+		{"forwarded element without for", proxy, http.Header{"Forwarded": {"for=192.0.2.60, proto=https"}}, "10.0.0.1"},
+		{"forwarded wins", proxy, http.Header{"Forwarded": {"for=192.0.2.60"}, "X-Forwarded-For": {"198.51.100.1"}}, "192.0.2.60"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := remoteIP(tc.remoteAddr, tc.header); got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRemoteIPWithoutTrustedProxies(t *testing.T) {
+	httphelpers.SetTrustedProxies(nil)
+
+	got := remoteIP("10.0.0.1:443", http.Header{"X-Forwarded-For": {"203.0.113.7"}, "Forwarded": {"for=203.0.113.7"}})
+	if got != "10.0.0.1" {
+		t.Errorf("got %s, want the peer", got)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := httphelpers.ParseTrustedProxies("10.0.0.0/8, 192.168.1.1 10.1.2.3/16,::ffff:172.16.0.0/108 2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.1/32"),
+		netip.MustParsePrefix("10.1.0.0/16"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	}
+	if !reflect.DeepEqual(prefixes, want) {
+		t.Errorf("got %v, want %v", prefixes, want)
+	}
+
+	for _, val := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0.256"} {
+		if _, err := httphelpers.ParseTrustedProxies(val); err == nil {
+			t.Errorf("%q was accepted", val)
+		}
+	}
+}
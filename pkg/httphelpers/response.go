@@ -2,9 +2,11 @@ package httphelpers
 
 import (
 	"encoding/json"
-	"encoding/xml"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,9 +19,10 @@ var (
 )
 
 const (
-	ContentTypeJSON ContentType = "application/json"
-	ContentTypeXML  ContentType = "application/xml"
-	ContentTypeHTML ContentType = "text/html"
+	ContentTypeJSON    ContentType = "application/json"
+	ContentTypeXML     ContentType = "application/xml"
+	ContentTypeMsgPack ContentType = "application/msgpack"
+	ContentTypeHTML    ContentType = "text/html"
 )
 
 // StatusOKResponse sets an empty 200 response
@@ -29,7 +32,7 @@ func StatusOKResponse(c *gin.Context) {
 
 // StatusCreatedResponse sets a 201 response and loads a JSON payload containing `{"id":id}`
 func StatusCreatedResponse[T int | int64 | string](c *gin.Context, id T) {
-	c.JSON(http.StatusCreated, gin.H{"id": id})
+	CustomStatusJSONPayloadResponse(c, http.StatusCreated, gin.H{"id": id})
 }
 
 // StatusNoContentResponse sets an empy 204 response
@@ -37,47 +40,63 @@ func StatusNoContentResponse(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-// StatusBadRequestResponse sets a 400 response and loads a JSON payload containing
-// `{"error":"msg"}“
+// StatusBadRequestResponse sets a 400 bad_request problem with msg as detail
 func StatusBadRequestResponse(c *gin.Context, msg string) {
-	c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+	ProblemResponse(c, CodeBadRequest, msg)
 }
 
-// StatusUnauthorizedResponse sets a 401 response and loads a JSON payload containing
-// `{"error":"unauthorized"}“
+// StatusBadRequestErrorsResponse sets a 400 bad_request problem listing the
+// field errors in its errors member
+func StatusBadRequestErrorsResponse(c *gin.Context, errors map[string]string) {
+	p := NewProblem(CodeBadRequest, "the request has invalid fields")
+	p.Errors = errors
+	WriteProblem(c, p)
+}
+
+// StatusUnauthorizedResponse sets a 401 unauthorized problem
 func StatusUnauthorizedResponse(c *gin.Context) {
-	c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	ProblemResponse(c, CodeUnauthorized, "you must be authenticated to access this resource")
 }
 
-// StatusForbiddenResponse sets a 403 response and loads a JSON payload containing
-// `{"error":"forbidden"}“
+// InvalidCredentialsResponse sets a 401 invalid_credentials problem
+//
+// It is used for unknown emails and wrong passwords alike so they can't be told apart
+func InvalidCredentialsResponse(c *gin.Context) {
+	ProblemResponse(c, CodeInvalidCredentials, "invalid authentication credentials")
+}
+
+// StatusForbiddenResponse sets a 403 forbidden problem
 func StatusForbiddenResponse(c *gin.Context) {
-	c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	ProblemResponse(c, CodeForbidden, "you do not have permission to access this resource")
 }
 
-// StatusNotFoundResponse sets a 404 response and loads a JSON payload containing
-// `{"error":"not found"}“
+// StatusNotFoundResponse sets a 404 not_found problem
 func StatusNotFoundResponse(c *gin.Context) {
-	CustomStatusJSONPayloadResponse(c, http.StatusNotFound,
-		map[string]string{"error": "not found"})
+	ProblemResponse(c, CodeNotFound, "the requested resource could not be found")
 }
 
-// StatusConflictResponse sets a 409 response and loads a JSON payload containing
-// `{"error":"the resource you are trying to edit has been modified by another user, please try again"}“
+// StatusConflictResponse sets a 409 edit_conflict problem
 func StatusConflictResponse(c *gin.Context) {
-	c.JSON(http.StatusConflict, gin.H{"error": "the resource you are trying to edit has been modified by another user, please try again"})
+	ProblemResponse(c, CodeEditConflict, "the resource you are trying to edit has been modified by another user, please try again")
 }
 
-// StatusUnprocesableEntities sets a 422 response and loads a payload containing the errors
+// StatusUnprocesableEntities sets a 422 validation_failed problem listing the
+// field errors in its errors member
 func StatusUnprocesableEntities(c *gin.Context, errors map[string]string) {
-	c.JSON(http.StatusUnprocessableEntity, gin.H{"errors": errors})
+	p := NewProblem(CodeValidationFailed, "the request has invalid fields")
+	p.Errors = errors
+	WriteProblem(c, p)
 }
 
-// StatusInternalServerErrorResponse sets an empty 500 response and loads errors into context,
-// in order to be accessible to middlewares
+// StatusInternalServerErrorResponse sets a 500 internal_error problem and loads errors into context,
+// in order to be accessible to middlewares. The error itself is never shown to the client.
 func StatusInternalServerErrorResponse(c *gin.Context, err error) {
 	c.Error(err)
-	c.Status(http.StatusInternalServerError)
+	if c.Writer.Written() {
+		// Too late to change the response, the error is only logged
+		return
+	}
+	ProblemResponse(c, CodeInternalError, "the server encountered a problem and could not process your request")
 }
 
 // StatusOKJSONPayloadResponse is a shorthand for CustomStatusJSONPayloadResponse with status 200
@@ -94,47 +113,23 @@ func StatusCreatedJSONPayload(c *gin.Context, payload any) error {
 	return CustomStatusJSONPayloadResponse(c, http.StatusCreated, payload)
 }
 
-// StatusBadRequestJSONPayloadResponse is a shorthand for CustomStatusJSONPayloadResponse with status 400
-//
-// If you do not wish to handle the error, and are ok with a 400 response on error, feel free to use c.JSON(http.StatusBadRequest, payload)
-func StatusBadRequestJSONPayloadResponse(c *gin.Context, payload any) error {
-	return CustomStatusJSONPayloadResponse(c, http.StatusBadRequest, payload)
-}
-
-// StatusUnauthorizedJSONPayloadResponse is a shorthand for CustomStatusJSONPayloadResponse with status 401
-//
-// If you do not wish to handle the error, and are ok with a 400 response on error, feel free to use c.JSON(http.StatusUnauthorized, payload)
-func StatusUnauthorizedJSONPayloadResponse(c *gin.Context, payload any) error {
-	return CustomStatusJSONPayloadResponse(c, http.StatusUnauthorized, payload)
-}
-
-// StatusJSONPayloadResponse is a shorthand for CustomStatusJSONPayloadResponse with status 403
-//
-// If you do not wish to handle the error, and are ok with a 400 response on error, feel free to use c.JSON(http.StatusForbidden, payload)
-func StatusForbiddenJSONPayloadResponse(c *gin.Context, payload any) error {
-	return CustomStatusJSONPayloadResponse(c, http.StatusForbidden, payload)
-}
-
+// StatusMethodNotAllowedResponse sets a 405 method_not_allowed problem
 func StatusMethodNotAllowedResponse(c *gin.Context) {
-	c.JSON(http.StatusForbidden, gin.H{"error": "not allowed"})
-}
-
-// StatusNotFoundResponse is a shorthand for CustomStatusPayloadResponse with status 404
-// If you do not wish to handle the error, and are ok with a 400 response on error, feel free to use c.JSON(http.StatusNotFound, payload)
-func StatusNotFoundPayloadResponse(c *gin.Context, payload any) {
-	CustomStatusPayloadResponse(c, http.StatusNotFound, payload, ContentTypeJSON)
+	ProblemResponse(c, CodeMethodNotAllowed, "the "+c.Request.Method+" method is not supported for this resource")
 }
 
-// CustomStatusJSONPayloadResponse is a shorthand for CustomStatusPayloadResponse with ContentTypeJSON
+// CustomStatusJSONPayloadResponse writes payload as JSON, or in another format
+// when the client's Accept header asks for one, see WriteResponse
 //
 // If you do not wish to handle the error, and are ok with a 400 response on error, feel free to use c.JSON(status, payload)
 func CustomStatusJSONPayloadResponse(c *gin.Context, status int, payload any) error {
-	return CustomStatusPayloadResponse(c, status, payload, ContentTypeJSON)
+	return WriteResponse(c, status, payload, nil)
 }
 
 // If you do not want to handle the error, and are ok with a 400 response on error, feel free to use gin context's functions
 // such as c.JSON, c.XML, etc.
-// Valid ContentType: "application/json", "application/xml", "text/html"
+// Valid ContentType: "text/html" and the content types of the registered
+// encoders, "application/json", "application/xml" and "application/msgpack" by default
 //
 // "text/html" expects a string as payload
 func CustomStatusPayloadResponse(c *gin.Context, status int, payload any, contentType ContentType) error {
@@ -148,11 +143,6 @@ func CustomStatusPayloadResponse(c *gin.Context, status int, payload any, conten
 		if err != nil {
 			return err
 		}
-	case ContentTypeXML:
-		pL, err = xml.Marshal(payload)
-		if err != nil {
-			return err
-		}
 	case ContentTypeHTML:
 		str, ok := payload.(string)
 		if !ok {
@@ -160,7 +150,14 @@ func CustomStatusPayloadResponse(c *gin.Context, status int, payload any, conten
 		}
 		pL = []byte(str)
 	default:
-		return ErrUnknownContentType
+		encoder, ok := encoderFor(contentType)
+		if !ok {
+			return ErrUnknownContentType
+		}
+		pL, err = encoder.Marshal(payload)
+		if err != nil {
+			return err
+		}
 	}
 	c.Status(status)
 	c.Header("Content-Type", string(contentType))
@@ -168,7 +165,14 @@ func CustomStatusPayloadResponse(c *gin.Context, status int, payload any, conten
 	return err
 }
 
-func RateLimitExceededResponse(c *gin.Context) {
-	message := "rate limit exceeded"
-	CustomStatusJSONPayloadResponse(c, http.StatusTooManyRequests, gin.H{"error": message})
+// RateLimitExceededResponse sets a 429 rate_limited problem with a Retry-After header
+func RateLimitExceededResponse(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	ProblemResponse(c, CodeRateLimited, "rate limit exceeded")
+}
+
+// LoginThrottledResponse sets a 429 login_throttled problem with a Retry-After header
+func LoginThrottledResponse(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	ProblemResponse(c, CodeLoginThrottled, "too many failed login attempts, please try again later")
 }
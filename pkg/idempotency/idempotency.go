@@ -0,0 +1,50 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"time"
+)
+
+// Response is what a request with an idempotency key produced, replayed to
+// the retries of that request
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Record is the state of a key. Response is nil while the first request is
+// being processed.
+type Record struct {
+	Fingerprint []byte
+	Response    *Response
+}
+
+// Store keeps idempotency keys for ttl. Keys are unique within a scope, e.g.
+// per user, so clients cannot see each other's responses.
+type Store interface {
+	// Lock claims key for a new request with fingerprint. When the key is
+	// already claimed, and has neither expired nor been abandoned by a crashed
+	// instance, it returns the existing record and false.
+	Lock(ctx context.Context, scope, key string, fingerprint []byte, ttl time.Duration) (Record, bool, error)
+	// Save stores the response of the request holding the key
+	Save(ctx context.Context, scope, key string, response Response) error
+	// Unlock forgets a key whose request failed, so it can be retried
+	Unlock(ctx context.Context, scope, key string) error
+	// Prune deletes expired keys
+	Prune(ctx context.Context) error
+}
+
+// Fingerprint identifies a request by its method, target and body, so a key
+// reused for another request can be told apart from a retry
+func Fingerprint(method, target string, body []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(target))
+	h.Write([]byte{0})
+	h.Write(body)
+	return h.Sum(nil)
+}
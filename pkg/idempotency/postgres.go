@@ -0,0 +1,158 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lockTimeout is how long a key stays claimed without a response. It is
+// longer than any request may take, past it the instance holding the key is
+// assumed to have crashed.
+const lockTimeout = time.Minute
+
+// PostgresStore keeps keys in the idempotency_keys table, so retries are
+// recognised whichever instance they reach
+type PostgresStore struct {
+	DB *sqlx.DB
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{
+		DB: db,
+	}
+}
+
+func (s *PostgresStore) Lock(ctx context.Context, scope, key string, fingerprint []byte, ttl time.Duration,
+) (Record, bool, error) {
+	// The conflicting row is only taken over when it expired or was abandoned
+	query := `
+        INSERT INTO idempotency_keys AS k (scope, key, fingerprint, expires_at)
+        VALUES ($1, $2, $3, now() + make_interval(secs => $4))
+        ON CONFLICT (scope, key) DO UPDATE SET
+            fingerprint = EXCLUDED.fingerprint,
+            status = NULL,
+            header = NULL,
+            body = NULL,
+            created_at = now(),
+            expires_at = EXCLUDED.expires_at
+        WHERE k.expires_at < now()
+            OR (k.status IS NULL AND k.created_at < now() - make_interval(secs => $5))
+        RETURNING true`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// The existing row can expire and be pruned between the two statements,
+	// the second attempt then claims the key
+	for attempt := 0; attempt < 2; attempt++ {
+		var locked bool
+		err := s.DB.GetContext(ctx, &locked, query, scope, key, fingerprint, ttl.Seconds(), lockTimeout.Seconds())
+		if err == nil {
+			return Record{Fingerprint: fingerprint}, true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Record{}, false, err
+		}
+
+		record, err := s.get(ctx, scope, key)
+		if err == nil {
+			return record, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Record{}, false, err
+		}
+	}
+
+	return Record{}, false, errors.New("idempotency: key changed concurrently")
+}
+
+func (s *PostgresStore) get(ctx context.Context, scope, key string) (Record, error) {
+	query := `
+        SELECT fingerprint, status, header, body
+        FROM idempotency_keys
+        WHERE scope = $1 AND key = $2`
+
+	var row struct {
+		Fingerprint []byte        `db:"fingerprint"`
+		Status      sql.NullInt32 `db:"status"`
+		Header      []byte        `db:"header"`
+		Body        []byte        `db:"body"`
+	}
+
+	err := s.DB.GetContext(ctx, &row, query, scope, key)
+	if err != nil {
+		return Record{}, err
+	}
+
+	record := Record{Fingerprint: row.Fingerprint}
+	if row.Status.Valid {
+		response := &Response{Status: int(row.Status.Int32), Body: row.Body}
+		if row.Header != nil {
+			err = json.Unmarshal(row.Header, &response.Header)
+			if err != nil {
+				return Record{}, err
+			}
+		}
+		record.Response = response
+	}
+
+	return record, nil
+}
+
+func (s *PostgresStore) Save(ctx context.Context, scope, key string, response Response) error {
+	query := `
+        UPDATE idempotency_keys
+        SET status = $3, header = $4, body = $5
+        WHERE scope = $1 AND key = $2`
+
+	header := response.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	js, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	body := response.Body
+	if body == nil {
+		body = []byte{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// lib/pq sends []byte as bytea, jsonb needs the text
+	_, err = s.DB.ExecContext(ctx, query, scope, key, response.Status, string(js), body)
+	return err
+}
+
+func (s *PostgresStore) Unlock(ctx context.Context, scope, key string) error {
+	query := `
+        DELETE FROM idempotency_keys
+        WHERE scope = $1 AND key = $2 AND status IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+func (s *PostgresStore) Prune(ctx context.Context) error {
+	query := `
+        DELETE FROM idempotency_keys
+        WHERE expires_at < now()`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,54 @@
+package jsonlog
+
+import (
+	"time"
+)
+
+// Attr is a typed property of a log line. Values keep their JSON type, so
+// numbers and booleans can be queried as such.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+func Int(key string, value int) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+func Float64(key string, value float64) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// Duration is written in milliseconds, with a fractional part
+func Duration(key string, value time.Duration) Attr {
+	return Attr{Key: key, Value: float64(value) / float64(time.Millisecond)}
+}
+
+func Time(key string, value time.Time) Attr {
+	return Attr{Key: key, Value: value.UTC().Format(time.RFC3339Nano)}
+}
+
+// Err adds the message of err under the key error
+func Err(err error) Attr {
+	return Attr{Key: "error", Value: err.Error()}
+}
+
+// Any keeps value as is, it must be marshallable to JSON
+func Any(key string, value any) Attr {
+	if err, ok := value.(error); ok {
+		return Attr{Key: key, Value: err.Error()}
+	}
+	return Attr{Key: key, Value: value}
+}
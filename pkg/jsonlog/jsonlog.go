@@ -2,17 +2,22 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -20,62 +25,162 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
 		return "FATAL"
+	case LevelOff:
+		return "OFF"
 	default:
 		return ""
 	}
 }
 
-type Logger struct {
+// ParseLevel reads a level name, ignoring case
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, errors.New("unknown log level, must be one of debug, info, warn, error, fatal or off")
+}
+
+// sink is shared by a logger and its children, so they write whole lines to the
+// same output and changing the level of one changes it for all
+type sink struct {
 	out      io.Writer
-	minLevel Level
 	mu       sync.Mutex
+	minLevel atomic.Int32
+	sampler  atomic.Pointer[sampler]
+}
+
+// The zero Logger writes INFO and above to stderr
+var defaultSink = &sink{out: os.Stderr}
+
+type Logger struct {
+	sink  *sink
+	attrs []Attr
+	// sampleKey splits the sampling counts of lines sharing a level and message
+	sampleKey string
 }
 
 func New(out io.Writer, minLevel Level) *Logger {
-	return &Logger{
-		out:      out,
-		minLevel: minLevel,
+	s := &sink{out: out}
+	s.minLevel.Store(int32(minLevel))
+
+	return &Logger{sink: s}
+}
+
+func (l *Logger) getSink() *sink {
+	if l.sink == nil {
+		return defaultSink
 	}
+	return l.sink
+}
+
+// With returns a child logger adding attrs to every line. It shares the output,
+// level and sampling of l.
+func (l *Logger) With(attrs ...Attr) *Logger {
+	child := &Logger{sink: l.getSink(), sampleKey: l.sampleKey}
+	child.attrs = append(child.attrs, l.attrs...)
+	child.attrs = append(child.attrs, attrs...)
+
+	return child
+}
+
+// SetLevel changes the minimum level of l, its parent and its children. It is
+// safe to call while logging.
+func (l *Logger) SetLevel(level Level) {
+	l.getSink().minLevel.Store(int32(level))
+}
+
+func (l *Logger) Level() Level {
+	return Level(l.getSink().minLevel.Load())
+}
+
+// Enabled reports whether lines of level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+func (l *Logger) Debug(message string, attrs ...Attr) {
+	l.print(LevelDebug, message, nil, attrs)
+}
+
+func (l *Logger) Info(message string, attrs ...Attr) {
+	l.print(LevelInfo, message, nil, attrs)
+}
+
+func (l *Logger) Warn(message string, attrs ...Attr) {
+	l.print(LevelWarn, message, nil, attrs)
+}
+
+func (l *Logger) Error(err error, attrs ...Attr) {
+	l.print(LevelError, err.Error(), nil, attrs)
 }
 
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
-	l.print(LevelInfo, message, properties)
+	l.print(LevelInfo, message, properties, nil)
 }
 
 func (l *Logger) PrintError(err error, properties map[string]string) {
-	l.print(LevelError, err.Error(), properties)
+	l.print(LevelError, err.Error(), properties, nil)
 }
 
+// PrintFatal writes the error with a stack trace and exits
 func (l *Logger) PrintFatal(err error, properties map[string]string) {
-	l.print(LevelFatal, err.Error(), properties)
+	l.print(LevelFatal, err.Error(), properties, nil)
 	os.Exit(1)
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
+func (l *Logger) print(level Level, message string, properties map[string]string, attrs []Attr) (int, error) {
+	s := l.getSink()
+
+	if !l.Enabled(level) {
 		return 0, nil
 	}
 
+	if level < LevelError {
+		if sampler := s.sampler.Load(); sampler != nil && !sampler.keep(level, message, l.sampleKey) {
+			return 0, nil
+		}
+	}
+
+	var props map[string]any
+	if n := len(l.attrs) + len(attrs) + len(properties); n > 0 {
+		props = make(map[string]any, n)
+		for _, attr := range l.attrs {
+			props[attr.Key] = attr.Value
+		}
+		for k, v := range properties {
+			props[k] = v
+		}
+		for _, attr := range attrs {
+			props[attr.Key] = attr.Value
+		}
+	}
+
 	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
+		Level      string         `json:"level"`
+		Time       string         `json:"time"`
+		Message    string         `json:"message"`
+		Properties map[string]any `json:"properties,omitempty"`
+		Trace      string         `json:"trace,omitempty"`
 	}{
 		Level:      level.String(),
 		Time:       time.Now().UTC().Format(time.RFC3339),
 		Message:    message,
-		Properties: properties,
+		Properties: props,
 	}
 
-	if level >= LevelError {
+	if level >= LevelFatal {
 		aux.Trace = string(debug.Stack())
 	}
 
@@ -86,12 +191,12 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 		line = []byte(LevelError.String() + ": unable to marshal log message: " + err.Error())
 	}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return l.out.Write(append(line, '\n'))
+	return s.out.Write(append(line, '\n'))
 }
 
 func (l *Logger) Write(message []byte) (n int, err error) {
-	return l.print(LevelError, string(message), nil)
+	return l.print(LevelError, string(message), nil, nil)
 }
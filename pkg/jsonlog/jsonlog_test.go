@@ -0,0 +1,195 @@
+package jsonlog_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight/pkg/jsonlog"
+)
+
+var timeField = regexp.MustCompile(`"time":"[^"]*"`)
+
+// lines returns the lines written to buf, their time replaced by <time>
+func lines(buf *bytes.Buffer) []string {
+	out := strings.TrimSuffix(timeField.ReplaceAllString(buf.String(), `"time":"<time>"`), "\n")
+	if out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+func TestLineFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelDebug).With(jsonlog.String("request_id", "abc"), jsonlog.Int("status", 0))
+
+	logger.Info("request served",
+		jsonlog.Int("status", 200),
+		jsonlog.Bool("cached", false),
+		jsonlog.Duration("duration", 1500*time.Microsecond),
+		jsonlog.Time("at", time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))),
+		jsonlog.Any("cause", errors.New("boom")),
+	)
+	logger.PrintInfo("legacy", map[string]string{"request_id": "overridden"})
+	logger.Error(errors.New("failed"))
+	jsonlog.New(&buf, jsonlog.LevelInfo).Info("bare")
+
+	want := []string{
+		`{"level":"INFO","time":"<time>","message":"request served","properties":{"at":"2024-05-01T10:00:00Z","cached":false,"cause":"boom","duration":1.5,"request_id":"abc","status":200}}`,
+		`{"level":"INFO","time":"<time>","message":"legacy","properties":{"request_id":"overridden","status":0}}`,
+		`{"level":"ERROR","time":"<time>","message":"failed","properties":{"request_id":"abc","status":0}}`,
+		`{"level":"INFO","time":"<time>","message":"bare"}`,
+	}
+	assertLines(t, lines(&buf), want)
+
+	if !regexp.MustCompile(`"time":"\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ"`).Match(buf.Bytes()) {
+		t.Errorf("got %s, want RFC 3339 UTC times", buf.String())
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelWarn)
+	child := logger.With(jsonlog.String("component", "mailer"))
+
+	logAll := func(l *jsonlog.Logger) {
+		l.Debug("debug")
+		l.Info("info")
+		l.Warn("warn")
+		l.Error(errors.New("error"))
+	}
+
+	logAll(logger)
+	assertLines(t, levels(&buf), []string{"WARN", "ERROR"})
+
+	// Children share the level of their parent
+	buf.Reset()
+	child.SetLevel(jsonlog.LevelDebug)
+	logAll(logger)
+	assertLines(t, levels(&buf), []string{"DEBUG", "INFO", "WARN", "ERROR"})
+
+	buf.Reset()
+	logger.SetLevel(jsonlog.LevelOff)
+	logAll(child)
+	assertLines(t, levels(&buf), nil)
+
+	if logger.Enabled(jsonlog.LevelFatal) {
+		t.Error("fatal lines are enabled at level OFF")
+	}
+}
+
+func levels(buf *bytes.Buffer) []string {
+	var got []string
+	for _, line := range lines(buf) {
+		level := regexp.MustCompile(`"level":"(\w+)"`).FindStringSubmatch(line)
+		got = append(got, level[1])
+	}
+	return got
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"debug", "INFO", "Warn", "error", "fatal", "off"} {
+		level, err := jsonlog.ParseLevel(name)
+		if err != nil {
+			t.Errorf("%q: %v", name, err)
+			continue
+		}
+		if !strings.EqualFold(level.String(), name) {
+			t.Errorf("%q: got %s", name, level)
+		}
+	}
+
+	if _, err := jsonlog.ParseLevel("verbose"); err == nil {
+		t.Error("an unknown level was accepted")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelDebug)
+	logger.SetSampling(jsonlog.Sampling{Initial: 2, Thereafter: 3, Tick: time.Hour})
+
+	for i := 0; i < 10; i++ {
+		logger.Info("busy", jsonlog.Int("i", i))
+		logger.Warn("busy", jsonlog.Int("i", i))
+		logger.Error(errors.New("busy"), jsonlog.Int("i", i))
+	}
+	logger.Info("quiet")
+
+	// The first 2, then every 3rd: lines 1, 2, 5 and 8
+	count := map[string]int{}
+	for _, line := range lines(&buf) {
+		level := regexp.MustCompile(`"level":"(\w+)","time":"<time>","message":"(\w+)"`).FindStringSubmatch(line)
+		count[level[1]+" "+level[2]]++
+	}
+	want := map[string]int{"INFO busy": 4, "WARN busy": 4, "ERROR busy": 10, "INFO quiet": 1}
+	for key, n := range want {
+		if count[key] != n {
+			t.Errorf("got %d %q lines, want %d", count[key], key, n)
+		}
+	}
+
+	info := regexp.MustCompile(`"level":"INFO","time":"<time>","message":"busy","properties":\{"i":(\d)\}`)
+	var kept []string
+	for _, match := range info.FindAllStringSubmatch(strings.Join(lines(&buf), "\n"), -1) {
+		kept = append(kept, match[1])
+	}
+	assertLines(t, kept, []string{"0", "1", "4", "7"})
+}
+
+func TestSampleBy(t *testing.T) {
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelInfo)
+	logger.SetSampling(jsonlog.Sampling{Initial: 1, Tick: time.Hour})
+
+	routes := []*jsonlog.Logger{logger.SampleBy("GET /v1/movies"), logger.SampleBy("GET /v1/healthcheck")}
+	for i := 0; i < 5; i++ {
+		for _, route := range routes {
+			route.Info("request")
+		}
+		logger.Info("request")
+	}
+
+	// Each key keeps its first line, Thereafter being zero drops the rest
+	if got := len(lines(&buf)); got != 3 {
+		t.Errorf("got %d lines, want 3", got)
+	}
+
+	buf.Reset()
+	logger.SetSampling(jsonlog.Sampling{})
+	for i := 0; i < 5; i++ {
+		routes[0].Info("request")
+	}
+	if got := len(lines(&buf)); got != 5 {
+		t.Errorf("got %d lines with sampling off, want 5", got)
+	}
+}
+
+func TestContext(t *testing.T) {
+	fallback := jsonlog.New(&bytes.Buffer{}, jsonlog.LevelInfo)
+	logger := fallback.With(jsonlog.String("request_id", "abc"))
+
+	if got := jsonlog.FromContext(context.Background(), fallback); got != fallback {
+		t.Error("an empty context did not return the fallback")
+	}
+	if got := jsonlog.FromContext(jsonlog.NewContext(context.Background(), logger), fallback); got != logger {
+		t.Error("the stored logger was not returned")
+	}
+}
+
+func assertLines(t *testing.T, got, want []string) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d:\ngot  %s\nwant %s", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package jsonlog
+
+import (
+	"sync"
+	"time"
+)
+
+// Sampling limits noisy lines. In every Tick, the first Initial lines with the
+// same level and message are written, then one in Thereafter, none when
+// Thereafter is zero. Errors are never sampled. Lines logged through SampleBy
+// are counted apart for each key.
+type Sampling struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration
+}
+
+type sampler struct {
+	Sampling
+
+	mu     sync.Mutex
+	resets time.Time
+	counts map[samplingKey]int
+}
+
+type samplingKey struct {
+	level   Level
+	message string
+	key     string
+}
+
+// SampleBy returns a child logger whose lines are sampled apart from the lines
+// of other keys with the same level and message, e.g. one key per route so a
+// busy route does not crowd the others out.
+func (l *Logger) SampleBy(key string) *Logger {
+	child := l.With()
+	child.sampleKey = key
+
+	return child
+}
+
+// SetSampling changes the sampling of l, its parent and its children. A zero
+// Initial turns sampling off.
+func (l *Logger) SetSampling(sampling Sampling) {
+	if sampling.Initial <= 0 {
+		l.getSink().sampler.Store(nil)
+		return
+	}
+
+	if sampling.Tick <= 0 {
+		sampling.Tick = time.Second
+	}
+
+	l.getSink().sampler.Store(&sampler{
+		Sampling: sampling,
+		counts:   map[samplingKey]int{},
+	})
+}
+
+func (s *sampler) keep(level Level, message, sampleKey string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Counts are dropped every tick, which also bounds the map to the
+	// messages of one tick
+	now := time.Now()
+	if !now.Before(s.resets) {
+		s.counts = map[samplingKey]int{}
+		s.resets = now.Add(s.Tick)
+	}
+
+	key := samplingKey{level: level, message: message, key: sampleKey}
+	s.counts[key]++
+	n := s.counts[key]
+
+	if n <= s.Initial {
+		return true
+	}
+
+	return s.Thereafter > 0 && (n-s.Initial)%s.Thereafter == 0
+}
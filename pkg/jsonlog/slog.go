@@ -0,0 +1,93 @@
+//go:build go1.21
+
+package jsonlog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogHandler lets code using log/slog write through l. Attributes of groups
+// are flattened with dotted keys.
+func (l *Logger) SlogHandler() slog.Handler {
+	return &slogHandler{logger: l}
+}
+
+type slogHandler struct {
+	logger *Logger
+	prefix string
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(fromSlogLevel(level))
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := make([]Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = appendSlogAttr(attrs, h.prefix, a)
+		return true
+	})
+
+	_, err := h.logger.print(fromSlogLevel(r.Level), r.Message, nil, attrs)
+	return err
+}
+
+func (h *slogHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	var attrs []Attr
+	for _, a := range as {
+		attrs = appendSlogAttr(attrs, h.prefix, a)
+	}
+
+	return &slogHandler{logger: h.logger.With(attrs...), prefix: h.prefix}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &slogHandler{logger: h.logger, prefix: h.prefix + name + "."}
+}
+
+func appendSlogAttr(attrs []Attr, prefix string, a slog.Attr) []Attr {
+	value := a.Value.Resolve()
+
+	if value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, member := range value.Group() {
+			attrs = appendSlogAttr(attrs, prefix, member)
+		}
+		return attrs
+	}
+
+	if a.Key == "" {
+		return attrs
+	}
+
+	switch value.Kind() {
+	case slog.KindDuration:
+		return append(attrs, Duration(prefix+a.Key, value.Duration()))
+	case slog.KindTime:
+		return append(attrs, Time(prefix+a.Key, value.Time()))
+	default:
+		return append(attrs, Any(prefix+a.Key, value.Any()))
+	}
+}
+
+// fromSlogLevel maps slog levels, which are spaced by 4, to the nearest level
+// at or below them
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
@@ -0,0 +1,47 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+)
+
+// Denylist is an in-process set of revoked token IDs. Entries are kept until
+// the token they refer to would have expired anyway, so the set stays small.
+type Denylist struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+func NewDenylist() *Denylist {
+	return &Denylist{
+		entries: make(map[string]time.Time),
+	}
+}
+
+func (d *Denylist) Add(jti string, expiry time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries[jti] = expiry
+}
+
+func (d *Denylist) Contains(jti string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, found := d.entries[jti]
+	return found
+}
+
+// Prune drops every entry whose token has already expired
+func (d *Denylist) Prune() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for jti, expiry := range d.entries {
+		if now.After(expiry) {
+			delete(d.entries, jti)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package jwt_test
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight/pkg/jwt"
+)
+
+var encoding = base64.RawURLEncoding
+
+type testClaims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role"`
+}
+
+func newClaims(ttl time.Duration) testClaims {
+	now := time.Now()
+	return testClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "jti-1",
+			Subject:   "42",
+			Issuer:    "greenlight",
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+		Role: "admin",
+	}
+}
+
+func hs256Key(t *testing.T, kid string) jwt.Key {
+	t.Helper()
+
+	key, err := jwt.NewHS256Key(kid, []byte(strings.Repeat(kid, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// ed25519PEM returns the PKCS #8 private and PKIX public keys of a new pair
+func ed25519PEM(t *testing.T) (private, public []byte, publicKey ed25519.PublicKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	der, err = x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	return private, public, pub
+}
+
+func eddsaKey(t *testing.T, kid string, pemBytes []byte) jwt.Key {
+	t.Helper()
+
+	key, err := jwt.NewEdDSAKey(kid, pemBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func keyset(t *testing.T, signingKid string, keys ...jwt.Key) *jwt.Keyset {
+	t.Helper()
+
+	ks, err := jwt.NewKeyset(signingKid, keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func sign(t *testing.T, ks *jwt.Keyset, claims testClaims) string {
+	t.Helper()
+
+	token, err := ks.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// forge builds a token from a raw header and claims, signed with an HMAC secret
+func forge(t *testing.T, header map[string]string, claims testClaims, secret []byte) string {
+	t.Helper()
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := encoding.EncodeToString(h) + "." + encoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+
+	return input + "." + encoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSignParse(t *testing.T) {
+	private, _, _ := ed25519PEM(t)
+
+	for _, key := range []jwt.Key{hs256Key(t, "hs"), eddsaKey(t, "ed", private)} {
+		t.Run(key.Alg, func(t *testing.T) {
+			ks := keyset(t, key.ID, key)
+			want := newClaims(time.Minute)
+			token := sign(t, ks, want)
+
+			if !jwt.LooksLikeJWT(token) {
+				t.Fatalf("got %q, want a compact JWS", token)
+			}
+
+			header, err := encoding.DecodeString(strings.Split(token, ".")[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantHeader := `{"alg":"` + key.Alg + `","typ":"JWT","kid":"` + key.ID + `"}`
+			if string(header) != wantHeader {
+				t.Errorf("got header %s, want %s", header, wantHeader)
+			}
+
+			var got testClaims
+			err = ks.Parse(token, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("got claims %+v, want %+v", got, want)
+			}
+			if !got.Expiry().Equal(time.Unix(want.ExpiresAt, 0)) {
+				t.Errorf("got expiry %v, want %v", got.Expiry(), time.Unix(want.ExpiresAt, 0))
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	ks := keyset(t, "hs", hs256Key(t, "hs"))
+	token := sign(t, ks, newClaims(time.Minute))
+	parts := strings.Split(token, ".")
+
+	tampered := newClaims(time.Minute)
+	tampered.Role = "superuser"
+	payload, err := json.Marshal(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"two segments", parts[0] + "." + parts[1], jwt.ErrMalformedToken},
+		{"header not base64", "!!." + parts[1] + "." + parts[2], jwt.ErrMalformedToken},
+		{"header not json", encoding.EncodeToString([]byte("nope")) + "." + parts[1] + "." + parts[2], jwt.ErrMalformedToken},
+		{"tampered payload", parts[0] + "." + encoding.EncodeToString(payload) + "." + parts[2], jwt.ErrInvalidSignature},
+		{"tampered signature", parts[0] + "." + parts[1] + "." + encoding.EncodeToString([]byte("signature")), jwt.ErrInvalidSignature},
+		{"no signature", parts[0] + "." + parts[1] + ".", jwt.ErrInvalidSignature},
+		{"expired", sign(t, ks, newClaims(-time.Second)), jwt.ErrExpiredToken},
+		{"unknown kid", forge(t, map[string]string{"alg": "HS256", "typ": "JWT", "kid": "other"}, newClaims(time.Minute), []byte(strings.Repeat("hs", 32))), jwt.ErrUnknownKey},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var claims testClaims
+			err := ks.Parse(tc.token, &claims)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("got error %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+// TestAlgorithmPinned checks that the algorithm comes from the key, so a token
+// cannot pick a weaker one or reuse a public key as an HMAC secret
+func TestAlgorithmPinned(t *testing.T) {
+	private, _, publicKey := ed25519PEM(t)
+	ks := keyset(t, "ed", eddsaKey(t, "ed", private))
+	claims := newClaims(time.Minute)
+
+	for _, tc := range []struct {
+		name   string
+		header map[string]string
+	}{
+		{"public key as hmac secret", map[string]string{"alg": "HS256", "typ": "JWT", "kid": "ed"}},
+		{"none", map[string]string{"alg": "none", "typ": "JWT", "kid": "ed"}},
+		{"no alg", map[string]string{"typ": "JWT", "kid": "ed"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			token := forge(t, tc.header, claims, publicKey)
+
+			var got testClaims
+			err := ks.Parse(token, &got)
+			if !errors.Is(err, jwt.ErrInvalidSignature) {
+				t.Errorf("got error %v, want %v", err, jwt.ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+// TestKeyRotation signs with a new key while tokens of the retired one, kept as
+// a public key, still verify until they expire
+func TestKeyRotation(t *testing.T) {
+	oldPrivate, oldPublic, _ := ed25519PEM(t)
+	newPrivate, _, _ := ed25519PEM(t)
+
+	before := keyset(t, "2024", eddsaKey(t, "2024", oldPrivate))
+	oldToken := sign(t, before, newClaims(time.Minute))
+
+	after := keyset(t, "2025", eddsaKey(t, "2025", newPrivate), eddsaKey(t, "2024", oldPublic))
+	newToken := sign(t, after, newClaims(time.Minute))
+
+	for name, token := range map[string]string{"old token": oldToken, "new token": newToken} {
+		var claims testClaims
+		err := after.Parse(token, &claims)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	if !strings.Contains(string(mustDecodeHeader(t, newToken)), `"kid":"2025"`) {
+		t.Error("the new token was not signed with the new key")
+	}
+
+	// The old instances do not know the new key yet
+	var claims testClaims
+	err := before.Parse(newToken, &claims)
+	if !errors.Is(err, jwt.ErrUnknownKey) {
+		t.Errorf("got error %v, want %v", err, jwt.ErrUnknownKey)
+	}
+
+	// A retired key only verifies
+	_, err = jwt.NewKeyset("2024", eddsaKey(t, "2024", oldPublic))
+	if !errors.Is(err, jwt.ErrNoSigningKey) {
+		t.Errorf("got error %v signing with a public key, want %v", err, jwt.ErrNoSigningKey)
+	}
+	_, err = jwt.NewKeyset("2026", eddsaKey(t, "2025", newPrivate))
+	if !errors.Is(err, jwt.ErrUnknownKey) {
+		t.Errorf("got error %v for a missing signing key, want %v", err, jwt.ErrUnknownKey)
+	}
+}
+
+func mustDecodeHeader(t *testing.T, token string) []byte {
+	t.Helper()
+
+	header, err := encoding.DecodeString(strings.Split(token, ".")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+	private, public, _ := ed25519PEM(t)
+
+	write := func(name string, content []byte) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, content, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	secret := write("secret", []byte(strings.Repeat("s", 32)+"\n"))
+	short := write("short", []byte("too short"))
+	privatePath := write("private.pem", private)
+	publicPath := write("public.pem", public)
+
+	keys, err := jwt.LoadKeys([]string{"a:HS256:" + secret, "b:EdDSA:" + privatePath, "c:EdDSA:" + publicPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || keys[0].ID != "a" || keys[0].Alg != jwt.AlgHS256 || keys[1].Alg != jwt.AlgEdDSA {
+		t.Fatalf("got keys %+v", keys)
+	}
+
+	for _, tc := range []struct {
+		spec string
+		err  error
+	}{
+		{"a:HS256", jwt.ErrInvalidKeySpec},
+		{":HS256:" + secret, jwt.ErrInvalidKeySpec},
+		{"a:HS256:" + short, jwt.ErrShortSecret},
+		{"a:EdDSA:" + secret, jwt.ErrInvalidPEM},
+		{"a:HS256:" + filepath.Join(dir, "missing"), os.ErrNotExist},
+	} {
+		_, err := jwt.LoadKeys([]string{tc.spec})
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: got error %v, want %v", tc.spec, err, tc.err)
+		}
+	}
+
+	_, err = jwt.LoadKeys([]string{"a:RS256:" + secret})
+	if err == nil {
+		t.Error("an unsupported algorithm was accepted")
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	d := jwt.NewDenylist()
+
+	d.Add("revoked", time.Now().Add(time.Minute))
+	d.Add("expired", time.Now().Add(-time.Second))
+
+	if !d.Contains("revoked") || !d.Contains("expired") {
+		t.Fatal("added token IDs are not denied")
+	}
+	if d.Contains("other") {
+		t.Fatal("a token ID that was never added is denied")
+	}
+
+	d.Prune()
+
+	if !d.Contains("revoked") {
+		t.Error("prune dropped a token that has not expired")
+	}
+	if d.Contains("expired") {
+		t.Error("prune kept a token that has expired")
+	}
+}
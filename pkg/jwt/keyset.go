@@ -0,0 +1,142 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrInvalidKeySpec = errors.New("invalid key spec, expected kid:alg:path")
+	ErrShortSecret    = errors.New("HS256 secret must be at least 32 bytes long")
+	ErrInvalidPEM     = errors.New("invalid PEM encoded ed25519 key")
+)
+
+// Key is a named signing or verification key. Ed25519 keys loaded from a public
+// key only verify tokens, which is how retired keys are kept around after a rotation.
+type Key struct {
+	ID         string
+	Alg        string
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+type Keyset struct {
+	keys       map[string]Key
+	signingKid string
+}
+
+func NewKeyset(signingKid string, keys ...Key) (*Keyset, error) {
+	ks := &Keyset{
+		keys:       make(map[string]Key, len(keys)),
+		signingKid: signingKid,
+	}
+
+	for _, key := range keys {
+		ks.keys[key.ID] = key
+	}
+
+	key, ok := ks.keys[signingKid]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q: %w", signingKid, ErrUnknownKey)
+	}
+	if key.Alg == AlgEdDSA && key.privateKey == nil {
+		return nil, fmt.Errorf("signing key %q: %w", signingKid, ErrNoSigningKey)
+	}
+
+	return ks, nil
+}
+
+func (ks *Keyset) key(kid string) (Key, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func (ks *Keyset) signingKey() (Key, bool) {
+	return ks.key(ks.signingKid)
+}
+
+func NewHS256Key(kid string, secret []byte) (Key, error) {
+	if len(secret) < 32 {
+		return Key{}, ErrShortSecret
+	}
+
+	return Key{ID: kid, Alg: AlgHS256, secret: secret}, nil
+}
+
+// NewEdDSAKey builds a key from a PEM block holding either a PKCS #8 private key
+// or a PKIX public key.
+func NewEdDSAKey(kid string, pemBytes []byte) (Key, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return Key{}, ErrInvalidPEM
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		priv, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return Key{}, ErrInvalidPEM
+		}
+		return Key{ID: kid, Alg: AlgEdDSA, privateKey: priv, publicKey: priv.Public().(ed25519.PublicKey)}, nil
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		pub, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return Key{}, ErrInvalidPEM
+		}
+		return Key{ID: kid, Alg: AlgEdDSA, publicKey: pub}, nil
+	default:
+		return Key{}, ErrInvalidPEM
+	}
+}
+
+// LoadKeys parses specs of the form "kid:alg:path" and reads each key from disk.
+// HS256 files hold the raw secret, EdDSA files hold a PEM encoded key.
+func LoadKeys(specs []string) ([]Key, error) {
+	keys := make([]Key, 0, len(specs))
+
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, ErrInvalidKeySpec
+		}
+
+		kid, alg, path := parts[0], parts[1], parts[2]
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var key Key
+		switch alg {
+		case AlgHS256:
+			key, err = NewHS256Key(kid, bytes.TrimSpace(content))
+		case AlgEdDSA:
+			key, err = NewEdDSAKey(kid, content)
+		default:
+			err = fmt.Errorf("unsupported algorithm %q", alg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
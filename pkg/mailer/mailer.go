@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"embed"
 	"html/template"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-mail/mail/v2"
@@ -12,6 +13,21 @@ import (
 //go:embed templates
 var templateFS embed.FS
 
+var sent, failed atomic.Int64
+
+// Stats counts the results of Send since startup
+type Stats struct {
+	Sent   int64
+	Failed int64
+}
+
+func GetStats() Stats {
+	return Stats{
+		Sent:   sent.Load(),
+		Failed: failed.Load(),
+	}
+}
+
 type Mailer struct {
 	dialer *mail.Dialer
 	sender string
@@ -28,6 +44,17 @@ func New(host string, port int, username, password, sender string) Mailer {
 }
 
 func (m Mailer) Send(recipient, templateFile string, data any) error {
+	err := m.send(recipient, templateFile, data)
+	if err != nil {
+		failed.Add(1)
+		return err
+	}
+
+	sent.Add(1)
+	return nil
+}
+
+func (m Mailer) send(recipient, templateFile string, data any) error {
 	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
 	if err != nil {
 		return err
@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the OpenMetrics 1.0 text format
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// DefaultBuckets are request duration buckets in seconds, from 5ms to 10s
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one value of a func metric
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Value is the single, unlabelled sample of a func metric
+func Value(v float64) []Sample {
+	return []Sample{{Value: v}}
+}
+
+type family interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families and writes them in the OpenMetrics text
+// format, in the order they were registered
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.families = append(r.families, f)
+}
+
+// CounterFunc registers a counter read from fn at every scrape. name has no
+// _total suffix, it is added to the samples.
+func (r *Registry) CounterFunc(name, help string, fn func() []Sample) {
+	r.register(&funcFamily{name: name, help: help, typ: "counter", suffix: "_total", fn: fn})
+}
+
+// GaugeFunc registers a gauge read from fn at every scrape
+func (r *Registry) GaugeFunc(name, help string, fn func() []Sample) {
+	r.register(&funcFamily{name: name, help: help, typ: "gauge", fn: fn})
+}
+
+// Histogram registers a histogram with one series per combination of values
+// of labels
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		labels:  labels,
+		series:  map[string]*series{},
+	}
+	r.register(h)
+
+	return h
+}
+
+func (r *Registry) WriteTo(w *bufio.Writer) error {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	for _, f := range families {
+		f.write(w)
+	}
+	w.WriteString("# EOF\n")
+
+	return w.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(bufio.NewWriter(w))
+	})
+}
+
+type funcFamily struct {
+	name   string
+	help   string
+	typ    string
+	suffix string
+	fn     func() []Sample
+}
+
+func (f *funcFamily) write(w *bufio.Writer) {
+	writeHeader(w, f.name, f.typ, f.help)
+	for _, sample := range f.fn() {
+		writeSample(w, f.name+f.suffix, sample.Labels, sample.Value)
+	}
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	labels  []string
+
+	mu     sync.Mutex
+	series map[string]*series
+	order  []string
+}
+
+type series struct {
+	labels []Label
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Observe adds value to the series of labelValues, given in the order of the
+// labels of the histogram
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &series{counts: make([]uint64, len(h.buckets))}
+		for i, name := range h.labels {
+			var v string
+			if i < len(labelValues) {
+				v = labelValues[i]
+			}
+			s.labels = append(s.labels, Label{Name: name, Value: v})
+		}
+		h.series[key] = s
+		h.order = append(h.order, key)
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	writeHeader(w, h.name, "histogram", h.help)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range h.order {
+		s := h.series[key]
+		labels := append(append([]Label(nil), s.labels...), Label{Name: "le"})
+
+		for i, bound := range h.buckets {
+			labels[len(labels)-1].Value = formatFloat(bound)
+			writeSample(w, h.name+"_bucket", labels, float64(s.counts[i]))
+		}
+		labels[len(labels)-1].Value = "+Inf"
+		writeSample(w, h.name+"_bucket", labels, float64(s.count))
+
+		writeSample(w, h.name+"_count", s.labels, float64(s.count))
+		writeSample(w, h.name+"_sum", s.labels, s.sum)
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, typ, help string) {
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+	if help != "" {
+		w.WriteString("# HELP " + name + " " + escape(help, false) + "\n")
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels []Label, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label.Name + `="` + escape(label.Value, true) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escape(s string, quotes bool) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	if quotes {
+		r = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	}
+	return r.Replace(s)
+}
@@ -0,0 +1,102 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"greenlight/pkg/metrics"
+)
+
+const golden = `# TYPE greenlight_http_requests counter
+# HELP greenlight_http_requests Requests served.
+greenlight_http_requests_total{code="200"} 3
+greenlight_http_requests_total{code="500"} 1
+# TYPE greenlight_db_open_connections gauge
+# HELP greenlight_db_open_connections Open connections\nto \\ the DB
+greenlight_db_open_connections 4
+# TYPE greenlight_uptime_seconds gauge
+greenlight_uptime_seconds 1.5e+06
+# TYPE greenlight_http_request_duration_seconds histogram
+# HELP greenlight_http_request_duration_seconds Request durations.
+greenlight_http_request_duration_seconds_bucket{method="GET",route="/v1/movies",le="0.1"} 0
+greenlight_http_request_duration_seconds_bucket{method="GET",route="/v1/movies",le="0.5"} 2
+greenlight_http_request_duration_seconds_bucket{method="GET",route="/v1/movies",le="1"} 2
+greenlight_http_request_duration_seconds_bucket{method="GET",route="/v1/movies",le="+Inf"} 2
+greenlight_http_request_duration_seconds_count{method="GET",route="/v1/movies"} 2
+greenlight_http_request_duration_seconds_sum{method="GET",route="/v1/movies"} 0.75
+greenlight_http_request_duration_seconds_bucket{method="POST",route="/v1/\"quoted\"\\path",le="0.1"} 0
+greenlight_http_request_duration_seconds_bucket{method="POST",route="/v1/\"quoted\"\\path",le="0.5"} 0
+greenlight_http_request_duration_seconds_bucket{method="POST",route="/v1/\"quoted\"\\path",le="1"} 0
+greenlight_http_request_duration_seconds_bucket{method="POST",route="/v1/\"quoted\"\\path",le="+Inf"} 1
+greenlight_http_request_duration_seconds_count{method="POST",route="/v1/\"quoted\"\\path"} 1
+greenlight_http_request_duration_seconds_sum{method="POST",route="/v1/\"quoted\"\\path"} 2
+# EOF
+`
+
+func TestOpenMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+
+	r.CounterFunc("greenlight_http_requests", "Requests served.", func() []metrics.Sample {
+		return []metrics.Sample{
+			{Labels: []metrics.Label{{Name: "code", Value: "200"}}, Value: 3},
+			{Labels: []metrics.Label{{Name: "code", Value: "500"}}, Value: 1},
+		}
+	})
+	r.GaugeFunc("greenlight_db_open_connections", "Open connections\nto \\ the DB", func() []metrics.Sample {
+		return metrics.Value(4)
+	})
+	r.GaugeFunc("greenlight_uptime_seconds", "", func() []metrics.Sample {
+		return metrics.Value(1_500_000)
+	})
+
+	// Buckets are sorted, and an observation equal to a bound falls in it
+	h := r.Histogram("greenlight_http_request_duration_seconds", "Request durations.", []float64{1, 0.1, 0.5}, "method", "route")
+	h.Observe(0.25, "GET", "/v1/movies")
+	h.Observe(0.5, "GET", "/v1/movies")
+	h.Observe(2, "POST", `/v1/"quoted"\path`)
+
+	srv := httptest.NewServer(r.Handler())
+	t.Cleanup(srv.Close)
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if got := res.Header.Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("got Content-Type %q, want %q", got, metrics.ContentType)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, want := strings.Split(string(body), "\n"), strings.Split(golden, "\n")
+	for i := 0; i < len(got) || i < len(want); i++ {
+		var g, w string
+		if i < len(got) {
+			g = got[i]
+		}
+		if i < len(want) {
+			w = want[i]
+		}
+		if g != w {
+			t.Errorf("line %d:\ngot  %s\nwant %s", i+1, g, w)
+		}
+	}
+}
+
+// TestEmptyRegistry still ends with the EOF marker OpenMetrics requires
+func TestEmptyRegistry(t *testing.T) {
+	rr := httptest.NewRecorder()
+	metrics.NewRegistry().Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := rr.Body.String(); got != "# EOF\n" {
+		t.Errorf("got %q, want %q", got, "# EOF\n")
+	}
+}
@@ -2,32 +2,60 @@ package middlewares
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"strings"
 
+	apikeysmodels "greenlight/internal/apikeys/models"
+	apikeysserviceerrors "greenlight/internal/apikeys/serviceerrors"
+	permissionsmodels "greenlight/internal/permissions/models"
 	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+	"greenlight/internal/users/serviceerrors"
 	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/jwt"
 	"greenlight/pkg/validator"
 
 	"github.com/gin-gonic/gin"
 )
 
 type UserRepo interface {
-	GetForToken(ctx context.Context, tokenScope string, tokenPlaintext string) (models.User, error)
+	GetForAuthenticationToken(ctx context.Context, tokenPlaintext string) (models.User, int64, error)
 }
 
-func Authenticate(userRepo UserRepo) gin.HandlerFunc {
+type JWTVerifier interface {
+	VerifyAuthenticationToken(ctx context.Context, token string) (models.User, permissionsmodels.Permissions, int64, error)
+}
+
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, plaintext string) (int64, models.User, permissionsmodels.Permissions, error)
+}
+
+// Authenticate resolves the bearer token or API key into a user. When jwtVerifier
+// is not nil, tokens shaped like a JWT are verified locally and never reach the database.
+// The admin behind an impersonation token is stored in the context along with the user.
+func Authenticate(userRepo UserRepo, jwtVerifier JWTVerifier, apiKeyVerifier APIKeyVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("Vary", "Authorization")
+		c.Writer.Header().Add("Vary", "Authorization")
+		c.Writer.Header().Add("Vary", "X-API-Key")
 
 		authorizationHeader := c.GetHeader("Authorization")
-		if authorizationHeader == "" {
+		apiKeyHeader := c.GetHeader("X-API-Key")
+		if authorizationHeader == "" && apiKeyHeader == "" {
 			httphelpers.ContextSetUser(c, models.AnonymousUser)
 			return
 		}
 
+		if apiKeyHeader != "" {
+			authenticateAPIKey(c, apiKeyVerifier, apiKeyHeader)
+			return
+		}
+
 		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) == 2 && strings.ToLower(headerParts[0]) == "apikey" {
+			authenticateAPIKey(c, apiKeyVerifier, headerParts[1])
+			return
+		}
+
 		if len(headerParts) != 2 || strings.ToLower(headerParts[0]) != "bearer" {
 			httphelpers.StatusUnauthorizedResponse(c)
 			c.Abort()
@@ -36,6 +64,27 @@ func Authenticate(userRepo UserRepo) gin.HandlerFunc {
 
 		token := headerParts[1]
 
+		if jwtVerifier != nil && jwt.LooksLikeJWT(token) {
+			user, permissions, orgID, err := jwtVerifier.VerifyAuthenticationToken(c, token)
+			if err != nil {
+				switch {
+				case errors.Is(err, serviceerrors.ErrInvalidToken):
+					httphelpers.StatusUnauthorizedResponse(c)
+				default:
+					httphelpers.StatusInternalServerErrorResponse(c, err)
+				}
+				c.Abort()
+				return
+			}
+
+			httphelpers.ContextSetUser(c, user)
+			httphelpers.ContextSetPermissions(c, permissions)
+			if orgID != 0 {
+				httphelpers.ContextSetTokenOrganization(c, orgID)
+			}
+			return
+		}
+
 		v := validator.New()
 		if models.ValidateTokenPlaintext(v, token); !v.Valid() {
 			httphelpers.StatusUnauthorizedResponse(c)
@@ -43,10 +92,10 @@ func Authenticate(userRepo UserRepo) gin.HandlerFunc {
 			return
 		}
 
-		user, err := userRepo.GetForToken(c, models.ScopeAuthentication, token)
+		user, impersonatorID, err := userRepo.GetForAuthenticationToken(c, token)
 		if err != nil {
 			switch {
-			case errors.Is(err, sql.ErrNoRows):
+			case errors.Is(err, repoerrors.ErrTokenNotFound):
 				httphelpers.StatusUnauthorizedResponse(c)
 			default:
 				httphelpers.StatusInternalServerErrorResponse(c, err)
@@ -56,5 +105,33 @@ func Authenticate(userRepo UserRepo) gin.HandlerFunc {
 		}
 
 		httphelpers.ContextSetUser(c, user)
+		if impersonatorID != 0 {
+			httphelpers.ContextSetImpersonator(c, impersonatorID)
+		}
+	}
+}
+
+func authenticateAPIKey(c *gin.Context, apiKeyVerifier APIKeyVerifier, plaintext string) {
+	v := validator.New()
+	if apikeysmodels.ValidateAPIKeyPlaintext(v, plaintext); !v.Valid() || apiKeyVerifier == nil {
+		httphelpers.StatusUnauthorizedResponse(c)
+		c.Abort()
+		return
+	}
+
+	keyID, user, permissions, err := apiKeyVerifier.VerifyAPIKey(c, plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, apikeysserviceerrors.ErrInvalidAPIKey):
+			httphelpers.StatusUnauthorizedResponse(c)
+		default:
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+		}
+		c.Abort()
+		return
 	}
+
+	httphelpers.ContextSetUser(c, user)
+	httphelpers.ContextSetPermissions(c, permissions)
+	httphelpers.ContextSetAPIKeyID(c, keyID)
 }
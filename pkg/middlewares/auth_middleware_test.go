@@ -0,0 +1,38 @@
+package middlewares_test
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAuthenticateKeepsVary runs Authenticate after the middlewares that come
+// before it in cmd/web, whose Vary values must survive
+func TestAuthenticateKeepsVary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	engine := gin.New()
+	engine.Use(
+		middlewares.Compress(middlewares.CompressConfig{MinSize: 1024, Level: gzip.DefaultCompression}),
+		middlewares.CORS(corsConfig()),
+		middlewares.Authenticate(unknownTokens{}, nil, nil),
+	)
+	engine.GET("/v1/healthcheck", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil)
+	r.Header.Set("Origin", trustedOrigin)
+	rr := httptest.NewRecorder()
+	engine.ServeHTTP(rr, r)
+
+	res := &http.Response{Header: rr.Header()}
+	for _, header := range []string{"Accept-Encoding", "Origin", "Authorization", "X-API-Key"} {
+		if !varies(res, header) {
+			t.Errorf("response does not vary on %s, got Vary %q", header, rr.Header().Values("Vary"))
+		}
+	}
+}
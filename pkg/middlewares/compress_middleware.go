@@ -0,0 +1,308 @@
+package middlewares
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// Compressor is a content coding Compress can apply to responses
+type Compressor interface {
+	// Encoding is the Accept-Encoding token, e.g. gzip
+	Encoding() string
+	// NewWriter compresses into w, closing it flushes the compressed stream
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+type CompressConfig struct {
+	// MinSize is the body size from which responses are compressed, smaller
+	// ones are not worth the CPU and often grow
+	MinSize int
+	// Level is the compression level, from 1 to 9, or gzip.DefaultCompression
+	// for the default of each coding
+	Level int
+	// Compressors in order of preference, DefaultCompressors(Level) when empty
+	Compressors []Compressor
+}
+
+func (cfg CompressConfig) Validate() error {
+	if cfg.MinSize < 0 {
+		return errors.New("compression minimum size must not be negative")
+	}
+	if cfg.Level != gzip.DefaultCompression && (cfg.Level < gzip.BestSpeed || cfg.Level > gzip.BestCompression) {
+		return errors.New("compression level must be between 1 and 9, or -1 for the default")
+	}
+	return nil
+}
+
+// DefaultCompressors returns brotli, gzip and deflate, brotli first as it
+// makes the smallest bodies for the same CPU
+func DefaultCompressors(level int) []Compressor {
+	brotliLevel := level
+	if level == gzip.DefaultCompression {
+		brotliLevel = brotli.DefaultCompression
+	}
+
+	return []Compressor{
+		newPooledCompressor("br", func(w io.Writer) flushWriter {
+			return brotli.NewWriterLevel(w, brotliLevel)
+		}),
+		newPooledCompressor("gzip", func(w io.Writer) flushWriter {
+			gz, _ := gzip.NewWriterLevel(w, level)
+			return gz
+		}),
+		newPooledCompressor("deflate", func(w io.Writer) flushWriter {
+			zw, _ := zlib.NewWriterLevel(w, level)
+			return zw
+		}),
+	}
+}
+
+// Compress compresses response bodies of at least cfg.MinSize bytes with the
+// coding the Accept-Encoding header prefers. Bodies are buffered until they
+// reach MinSize, so the size is known before the headers are sent. Responses
+// that already have a Content-Encoding, are not text-like or are flushed
+// early by the handler are sent as is.
+func Compress(cfg CompressConfig) gin.HandlerFunc {
+	compressors := cfg.Compressors
+	if len(compressors) == 0 {
+		compressors = DefaultCompressors(cfg.Level)
+	}
+
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		compressor := negotiateCompressor(c.GetHeader("Accept-Encoding"), compressors)
+		if compressor == nil || c.Request.Method == http.MethodHead || c.GetHeader("Range") != "" {
+			c.Next()
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: c.Writer,
+			compressor:     compressor,
+			minSize:        cfg.MinSize,
+		}
+		c.Writer = cw
+		// Restore the writer even on panic, so RecoverPanic writes its response
+		// without going through the buffer
+		defer func() {
+			c.Writer = cw.ResponseWriter
+		}()
+
+		c.Next()
+
+		cw.finish()
+	}
+}
+
+// negotiateCompressor returns the compressor with the highest q value in
+// accept, ties going to the order of compressors, or nil for identity
+func negotiateCompressor(accept string, compressors []Compressor) Compressor {
+	if accept == "" {
+		return nil
+	}
+
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.EqualFold(name, "q") {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err == nil {
+				q = parsed
+			}
+		}
+		qualities[coding] = q
+	}
+
+	var (
+		best  Compressor
+		bestQ float64
+	)
+	for _, compressor := range compressors {
+		q, ok := qualities[compressor.Encoding()]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = compressor, q
+		}
+	}
+
+	return best
+}
+
+type compressWriter struct {
+	gin.ResponseWriter
+	compressor Compressor
+	minSize    int
+
+	buf     []byte
+	decided bool
+	cw      io.WriteCloser
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.cw != nil {
+			return w.cw.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minSize {
+		err := w.decide(true)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if f, ok := w.cw.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Written() bool {
+	return len(w.buf) > 0 || w.ResponseWriter.Written()
+}
+
+func (w *compressWriter) Size() int {
+	if !w.decided && len(w.buf) > 0 {
+		return len(w.buf)
+	}
+	return w.ResponseWriter.Size()
+}
+
+// decide sends the headers, compressing the body when compress is set and
+// the response allows it, and writes the buffered body
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+
+	header := w.Header()
+	if compress && compressible(w.Status(), header) {
+		header.Set("Content-Encoding", w.compressor.Encoding())
+		header.Del("Content-Length")
+		w.cw = w.compressor.NewWriter(w.ResponseWriter)
+	}
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	buf := w.buf
+	w.buf = nil
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.cw != nil {
+		w.cw.Close()
+	}
+}
+
+func compressible(status int, header http.Header) bool {
+	if status == http.StatusNoContent || status == http.StatusNotModified || status < http.StatusOK {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"),
+		mediaType == "application/msgpack",
+		mediaType == "application/javascript",
+		mediaType == "application/openmetrics-text":
+		return true
+	}
+
+	return false
+}
+
+type flushWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// pooledCompressor reuses writers, brotli, gzip and zlib allocate hundreds of
+// KiB each
+type pooledCompressor struct {
+	encoding string
+	pool     sync.Pool
+}
+
+func newPooledCompressor(encoding string, newWriter func(w io.Writer) flushWriter) *pooledCompressor {
+	return &pooledCompressor{
+		encoding: encoding,
+		pool: sync.Pool{New: func() any {
+			return newWriter(io.Discard)
+		}},
+	}
+}
+
+func (p *pooledCompressor) Encoding() string {
+	return p.encoding
+}
+
+func (p *pooledCompressor) NewWriter(w io.Writer) io.WriteCloser {
+	fw := p.pool.Get().(flushWriter)
+	fw.Reset(w)
+	return &pooledWriter{flushWriter: fw, pool: &p.pool}
+}
+
+type pooledWriter struct {
+	flushWriter
+	pool *sync.Pool
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.flushWriter.Close()
+	w.flushWriter.Reset(io.Discard)
+	w.pool.Put(w.flushWriter)
+	return err
+}
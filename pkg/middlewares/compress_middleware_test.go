@@ -0,0 +1,108 @@
+package middlewares_test
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"greenlight/pkg/middlewares"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func newCompressEngine(body string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	engine := gin.New()
+	engine.Use(middlewares.Compress(middlewares.CompressConfig{MinSize: 1024, Level: gzip.DefaultCompression}))
+	engine.GET("/", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", []byte(body))
+	})
+
+	return engine
+}
+
+func decompress(t *testing.T, encoding string, body io.Reader) string {
+	t.Helper()
+
+	var (
+		r   io.Reader
+		err error
+	)
+	switch encoding {
+	case "br":
+		r = brotli.NewReader(body)
+	case "gzip":
+		r, err = gzip.NewReader(body)
+	case "deflate":
+		r, err = zlib.NewReader(body)
+	default:
+		r = body
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCompressNegotiation(t *testing.T) {
+	body := `{"movies":"` + strings.Repeat("greenlight ", 200) + `"}`
+	engine := newCompressEngine(body)
+
+	for _, tc := range []struct {
+		accept string
+		want   string
+	}{
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"*", "br"},
+		{"identity", ""},
+		{"", ""},
+	} {
+		// Run twice so pooled writers are reused
+		for i := 0; i < 2; i++ {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", tc.accept)
+			rr := httptest.NewRecorder()
+			engine.ServeHTTP(rr, r)
+
+			encoding := rr.Header().Get("Content-Encoding")
+			if encoding != tc.want {
+				t.Fatalf("Accept-Encoding %q: got Content-Encoding %q, want %q", tc.accept, encoding, tc.want)
+			}
+			if encoding != "" && rr.Body.Len() >= len(body) {
+				t.Errorf("Accept-Encoding %q: %d bytes compressed to %d", tc.accept, len(body), rr.Body.Len())
+			}
+			if got := decompress(t, encoding, rr.Body); got != body {
+				t.Fatalf("Accept-Encoding %q: the body did not round trip", tc.accept)
+			}
+		}
+	}
+}
+
+func TestCompressMinSize(t *testing.T) {
+	engine := newCompressEngine(`{"status":"available"}`)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "br, gzip")
+	rr := httptest.NewRecorder()
+	engine.ServeHTTP(rr, r)
+
+	if encoding := rr.Header().Get("Content-Encoding"); encoding != "" {
+		t.Errorf("got Content-Encoding %q for a body under the minimum size", encoding)
+	}
+	if !varies(&http.Response{Header: rr.Header()}, "Accept-Encoding") {
+		t.Error("response does not vary on Accept-Encoding")
+	}
+}
@@ -1,35 +1,192 @@
 package middlewares
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func EnableCors(trustedOrigins ...string) gin.HandlerFunc {
+// CORSConfig is the cross-origin policy of the API
+type CORSConfig struct {
+	// AllowedOrigins are origins like https://example.com. A * in place of the
+	// leftmost host label matches any subdomains, https://*.example.com, and *
+	// alone matches every origin.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read besides the
+	// CORS-safelisted ones
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and authorization headers
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response, zero leaves
+	// it to the browser
+	MaxAge time.Duration
+}
+
+// Validate refuses malformed origin patterns, and credentials allowed for any
+// origin, which would let every site act as the user
+func (cfg CORSConfig) Validate() error {
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			if cfg.AllowCredentials {
+				return errors.New("cors: credentials cannot be allowed for every origin")
+			}
+			continue
+		}
+
+		scheme, host, ok := strings.Cut(origin, "://")
+		if !ok || scheme == "" || host == "" || strings.ContainsAny(host, "/?#") {
+			return fmt.Errorf("cors: invalid origin %q", origin)
+		}
+		if strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return fmt.Errorf("cors: invalid origin pattern %q, * can only replace the leftmost host label", origin)
+		}
+	}
+
+	return nil
+}
+
+// CORS applies cfg to every request. Preflight requests are answered with 204
+// and stop there, other requests from an allowed origin get the
+// Access-Control-Allow-Origin and Access-Control-Expose-Headers headers and go
+// on. Requests from other origins go on untouched, the browser blocks them.
+func CORS(cfg CORSConfig) gin.HandlerFunc {
+	var (
+		anyOrigin    bool
+		exactOrigins = map[string]bool{}
+		wildcards    []originPattern
+	)
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "://*.")
+			wildcards = append(wildcards, originPattern{scheme: scheme + "://", suffix: "." + host})
+		default:
+			exactOrigins[origin] = true
+		}
+	}
+
+	allowed := func(origin string) bool {
+		origin = strings.ToLower(origin)
+		if anyOrigin || exactOrigins[origin] {
+			return true
+		}
+		for _, pattern := range wildcards {
+			if pattern.matches(origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	methods := map[string]bool{}
+	for _, method := range cfg.AllowedMethods {
+		methods[strings.ToUpper(method)] = true
+	}
+
+	anyHeader := false
+	headers := map[string]bool{}
+	for _, header := range cfg.AllowedHeaders {
+		if header == "*" {
+			anyHeader = true
+		}
+		headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	// With credentials, a wildcard response is ignored by browsers
+	allowOrigin := func(origin string) string {
+		if anyOrigin && !cfg.AllowCredentials {
+			return "*"
+		}
+		return origin
+	}
+
 	return func(c *gin.Context) {
-		if c.Request.Method != http.MethodOptions {
+		h := c.Writer.Header()
+
+		if !anyOrigin || cfg.AllowCredentials {
+			h.Add("Vary", "Origin")
+		}
+
+		origin := c.GetHeader("Origin")
+		requestMethod := c.GetHeader("Access-Control-Request-Method")
+		preflight := c.Request.Method == http.MethodOptions && requestMethod != ""
+
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" || !allowed(origin) {
+			c.Next()
 			return
 		}
 
-		c.Writer.Header().Add("Vary", "Origin")
-		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
-		origin := c.Request.Header.Get("Origin")
+		if !preflight {
+			h.Set("Access-Control-Allow-Origin", allowOrigin(origin))
+			if cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			c.Next()
+			return
+		}
 
-		for _, trustedOrigin := range trustedOrigins {
-			if origin == trustedOrigin {
-				c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-				if c.Request.Method == http.MethodOptions {
-					c.Writer.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE")
-					c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-					c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization")
-					c.Writer.WriteHeader(http.StatusOK)
-					return
-				}
+		// A refused preflight gets no CORS headers, so the browser does not
+		// send the actual request
+		if !methods[strings.ToUpper(requestMethod)] {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
 
-				break
+		requestHeaders := c.GetHeader("Access-Control-Request-Headers")
+		for _, header := range strings.Split(requestHeaders, ",") {
+			header = strings.TrimSpace(header)
+			if header != "" && !anyHeader && !headers[http.CanonicalHeaderKey(header)] {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
 			}
 		}
-		c.AbortWithStatus(http.StatusOK)
+
+		h.Set("Access-Control-Allow-Origin", allowOrigin(origin))
+		if cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		h.Set("Access-Control-Allow-Methods", allowMethods)
+		if requestHeaders != "" {
+			h.Set("Access-Control-Allow-Headers", requestHeaders)
+		}
+		if cfg.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", maxAge)
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
 	}
 }
+
+// originPattern matches the origins of scheme with a host ending in suffix,
+// suffix starting with a dot so at least one subdomain label is required
+type originPattern struct {
+	scheme string
+	suffix string
+}
+
+func (p originPattern) matches(origin string) bool {
+	host, ok := strings.CutPrefix(origin, p.scheme)
+	return ok && len(host) > len(p.suffix) && strings.HasSuffix(host, p.suffix)
+}
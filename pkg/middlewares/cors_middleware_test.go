@@ -0,0 +1,239 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+const trustedOrigin = "http://localhost:9000"
+
+// newCORSServer serves the endpoints the cmd/web/cors pages call
+func newCORSServer(t *testing.T, cfg middlewares.CORSConfig) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	err := cfg.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := gin.New()
+	engine.Use(middlewares.CORS(cfg))
+	engine.GET("/v1/healthcheck", func(c *gin.Context) {
+		c.Header(middlewares.RequestIDHeader, "request-id")
+		c.JSON(http.StatusOK, gin.H{"status": "available"})
+	})
+	engine.POST("/v1/tokens/authentication", func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"authentication_token": "token"})
+	})
+
+	srv := httptest.NewServer(engine)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func corsConfig() middlewares.CORSConfig {
+	return middlewares.CORSConfig{
+		AllowedOrigins: []string{trustedOrigin, "https://*.example.com"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"Authorization", "Content-Type", "X-API-Key", "traceparent", middlewares.RequestIDHeader},
+		ExposedHeaders: []string{middlewares.RequestIDHeader},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+func do(t *testing.T, method, url string, header http.Header) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res
+}
+
+func varies(res *http.Response, header string) bool {
+	for _, value := range res.Header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), header) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TestCORSSimple replays cmd/web/cors/simple, a GET without preflight
+func TestCORSSimple(t *testing.T) {
+	srv := newCORSServer(t, corsConfig())
+
+	for _, tc := range []struct {
+		name        string
+		origin      string
+		allowOrigin string
+	}{
+		{"trusted origin", trustedOrigin, trustedOrigin},
+		{"subdomain", "https://app.example.com", "https://app.example.com"},
+		{"bare domain of a wildcard", "https://example.com", ""},
+		{"untrusted origin", "http://evil.test", ""},
+		{"no origin", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.origin != "" {
+				header.Set("Origin", tc.origin)
+			}
+			res := do(t, http.MethodGet, srv.URL+"/v1/healthcheck", header)
+
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("got status %d, want %d", res.StatusCode, http.StatusOK)
+			}
+			if got := res.Header.Get("Access-Control-Allow-Origin"); got != tc.allowOrigin {
+				t.Errorf("got Access-Control-Allow-Origin %q, want %q", got, tc.allowOrigin)
+			}
+			if !varies(res, "Origin") {
+				t.Error("response does not vary on Origin")
+			}
+
+			exposed := res.Header.Get("Access-Control-Expose-Headers")
+			if tc.allowOrigin != "" && !strings.Contains(exposed, middlewares.RequestIDHeader) {
+				t.Errorf("got Access-Control-Expose-Headers %q, want it to include %s", exposed, middlewares.RequestIDHeader)
+			}
+			if tc.allowOrigin == "" && exposed != "" {
+				t.Errorf("got Access-Control-Expose-Headers %q for a refused origin", exposed)
+			}
+		})
+	}
+}
+
+// TestCORSPreflight replays cmd/web/cors/preflight, a JSON POST the browser
+// checks with OPTIONS first
+func TestCORSPreflight(t *testing.T) {
+	srv := newCORSServer(t, corsConfig())
+
+	for _, tc := range []struct {
+		name           string
+		origin         string
+		method         string
+		headers        string
+		allowed        bool
+		allowedHeaders string
+	}{
+		{"trusted origin", trustedOrigin, "POST", "content-type", true, "content-type"},
+		{"api key and trace context", trustedOrigin, "POST", "content-type, x-api-key, traceparent", true, "content-type, x-api-key, traceparent"},
+		{"untrusted origin", "http://evil.test", "POST", "content-type", false, ""},
+		{"method not allowed", trustedOrigin, "OPTIONS", "", false, ""},
+		{"header not allowed", trustedOrigin, "POST", "content-type, x-custom", false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Origin", tc.origin)
+			header.Set("Access-Control-Request-Method", tc.method)
+			if tc.headers != "" {
+				header.Set("Access-Control-Request-Headers", tc.headers)
+			}
+			res := do(t, http.MethodOptions, srv.URL+"/v1/tokens/authentication", header)
+
+			// A preflight from an untrusted origin goes on to the router, which
+			// has no OPTIONS routes
+			if tc.origin == trustedOrigin && res.StatusCode != http.StatusNoContent {
+				t.Errorf("got status %d, want %d", res.StatusCode, http.StatusNoContent)
+			}
+			for _, vary := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+				if !varies(res, vary) {
+					t.Errorf("response does not vary on %s", vary)
+				}
+			}
+
+			allowOrigin := res.Header.Get("Access-Control-Allow-Origin")
+			if !tc.allowed {
+				if allowOrigin != "" {
+					t.Errorf("got Access-Control-Allow-Origin %q for a refused preflight", allowOrigin)
+				}
+				return
+			}
+
+			if allowOrigin != tc.origin {
+				t.Errorf("got Access-Control-Allow-Origin %q, want %q", allowOrigin, tc.origin)
+			}
+			if got := res.Header.Get("Access-Control-Allow-Methods"); !strings.Contains(got, tc.method) {
+				t.Errorf("got Access-Control-Allow-Methods %q, want it to include %s", got, tc.method)
+			}
+			if got := res.Header.Get("Access-Control-Allow-Headers"); got != tc.allowedHeaders {
+				t.Errorf("got Access-Control-Allow-Headers %q, want %q", got, tc.allowedHeaders)
+			}
+			if got := res.Header.Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("got Access-Control-Max-Age %q, want %q", got, "600")
+			}
+			if got := res.Header.Get("Access-Control-Allow-Credentials"); got != "" {
+				t.Errorf("got Access-Control-Allow-Credentials %q without credentials allowed", got)
+			}
+		})
+	}
+}
+
+func TestCORSCredentials(t *testing.T) {
+	cfg := corsConfig()
+	cfg.AllowCredentials = true
+	srv := newCORSServer(t, cfg)
+
+	header := http.Header{}
+	header.Set("Origin", trustedOrigin)
+	res := do(t, http.MethodGet, srv.URL+"/v1/healthcheck", header)
+
+	if got := res.Header.Get("Access-Control-Allow-Origin"); got != trustedOrigin {
+		t.Errorf("got Access-Control-Allow-Origin %q, want %q", got, trustedOrigin)
+	}
+	if got := res.Header.Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("got Access-Control-Allow-Credentials %q, want %q", got, "true")
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	cfg := corsConfig()
+	cfg.AllowedOrigins = []string{"*"}
+	srv := newCORSServer(t, cfg)
+
+	header := http.Header{}
+	header.Set("Origin", "http://anywhere.test")
+	res := do(t, http.MethodGet, srv.URL+"/v1/healthcheck", header)
+
+	if got := res.Header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("got Access-Control-Allow-Origin %q, want %q", got, "*")
+	}
+	if varies(res, "Origin") {
+		t.Error("a wildcard response varies on Origin")
+	}
+
+	// Browsers ignore a wildcard on credentialed responses, so the
+	// configuration is refused
+	cfg.AllowCredentials = true
+	if err := cfg.Validate(); err == nil {
+		t.Error("credentials were allowed for every origin")
+	}
+}
+
+func TestCORSValidate(t *testing.T) {
+	for _, origin := range []string{"localhost:9000", "http://", "http://example.com/path", "http://app.*.example.com", "https://**.example.com"} {
+		cfg := middlewares.CORSConfig{AllowedOrigins: []string{origin}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("origin %q was accepted", origin)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/idempotency"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotentRequestBytes = 1_048_576
+)
+
+// Idempotency honours the Idempotency-Key header on unsafe methods. The first
+// request with a key runs and its response is stored for ttl, retries with the
+// same key get that response back with Idempotent-Replayed: true. A key reused
+// for a different request gets a 422, and a retry arriving while the first
+// request still runs gets a 409. Server errors are not stored, so the client
+// can retry them. Keys are scoped per user, or per client IP for anonymous
+// requests, so it must come after Authenticate.
+func Idempotency(store idempotency.Store, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !unsafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		// Keys follow the rules of request IDs, they end up in the same places
+		if !validRequestID(key) {
+			httphelpers.StatusBadRequestResponse(c, "invalid "+IdempotencyKeyHeader+" header")
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentRequestBytes+1))
+		if err != nil {
+			httphelpers.StatusBadRequestResponse(c, "unable to read the request body")
+			c.Abort()
+			return
+		}
+		if len(body) > maxIdempotentRequestBytes {
+			httphelpers.StatusBadRequestResponse(c, fmt.Sprintf("body must not be larger than %d bytes", maxIdempotentRequestBytes))
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The target, not the route template, so a key reused on another :id
+		// is told apart from a retry
+		fingerprint := idempotency.Fingerprint(c.Request.Method, c.Request.URL.RequestURI(), body)
+		scope := RateLimitByUser(c)
+
+		record, locked, err := store.Lock(c.Request.Context(), scope, key, fingerprint, ttl)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			c.Abort()
+			return
+		}
+
+		if !locked {
+			switch {
+			case !bytes.Equal(record.Fingerprint, fingerprint):
+				httphelpers.ProblemResponse(c, httphelpers.CodeIdempotencyKeyReused,
+					"this idempotency key was already used for a different request")
+			case record.Response == nil:
+				httphelpers.ProblemResponse(c, httphelpers.CodeIdempotencyKeyInUse,
+					"a request with this idempotency key is still being processed, please try again later")
+			default:
+				replayResponse(c, *record.Response)
+			}
+			c.Abort()
+			return
+		}
+
+		// The client may be gone by the time the response is stored, which is
+		// when a retry is most likely
+		ctx := context.Background()
+
+		before := c.Writer.Header().Clone()
+		w := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		saved := false
+		defer func() {
+			c.Writer = w.ResponseWriter
+			if !saved {
+				err := store.Unlock(ctx, scope, key)
+				if err != nil {
+					c.Error(err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		if w.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		err = store.Save(ctx, scope, key, idempotency.Response{
+			Status: w.Status(),
+			Header: addedHeaders(before, w.Header()),
+			Body:   w.body.Bytes(),
+		})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		saved = true
+	}
+}
+
+func unsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+func replayResponse(c *gin.Context, response idempotency.Response) {
+	for key, values := range response.Header {
+		for _, value := range values {
+			c.Writer.Header().Add(key, value)
+		}
+	}
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Status(response.Status)
+	c.Writer.Write(response.Body)
+}
+
+// encodingHeaders describe how the response was sent rather than the body
+// captured, which is before any compression by Compress. Replaying them would
+// label the plain body as compressed.
+var encodingHeaders = map[string]bool{
+	"Content-Encoding": true,
+	"Content-Length":   true,
+	"Vary":             true,
+}
+
+// addedHeaders returns the headers set by the handler, leaving out those of
+// the middlewares before Idempotency, e.g. the request ID, and the encoding
+// headers, which the middlewares set again on replay
+func addedHeaders(before, after http.Header) http.Header {
+	added := http.Header{}
+	for key, values := range after {
+		if encodingHeaders[key] {
+			continue
+		}
+
+		previous := before[key]
+		if len(values) >= len(previous) {
+			values = values[len(previous):]
+		}
+		if len(values) > 0 {
+			added[key] = values
+		}
+	}
+	return added
+}
+
+// captureWriter keeps a copy of the response body
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
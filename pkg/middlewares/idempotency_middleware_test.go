@@ -0,0 +1,174 @@
+package middlewares_test
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"greenlight/pkg/idempotency"
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryStore keeps keys until the test ends, ignoring the ttl
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]idempotency.Record
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: map[string]idempotency.Record{}}
+}
+
+func (s *memoryStore) Lock(ctx context.Context, scope, key string, fingerprint []byte, ttl time.Duration) (idempotency.Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[scope+key]; ok {
+		return record, false, nil
+	}
+	s.records[scope+key] = idempotency.Record{Fingerprint: fingerprint}
+	return idempotency.Record{}, true, nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, scope, key string, response idempotency.Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.records[scope+key]
+	record.Response = &response
+	s.records[scope+key] = record
+	return nil
+}
+
+func (s *memoryStore) Unlock(ctx context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, scope+key)
+	return nil
+}
+
+func (s *memoryStore) Prune(ctx context.Context) error {
+	return nil
+}
+
+// TestIdempotencyReplayCompressed replays a response large enough for Compress,
+// which sits before Idempotency in the chain
+func TestIdempotencyReplayCompressed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	body := `{"movie":{"title":"` + strings.Repeat("Casablanca ", 200) + `"}}`
+	calls := 0
+
+	engine := gin.New()
+	engine.Use(
+		middlewares.Compress(middlewares.CompressConfig{MinSize: 1024, Level: gzip.DefaultCompression}),
+		middlewares.Idempotency(newMemoryStore(), time.Hour),
+	)
+	engine.POST("/v1/movies", func(c *gin.Context) {
+		calls++
+		c.Header("Location", "/v1/movies/1")
+		c.Data(http.StatusCreated, "application/json", []byte(body))
+	})
+
+	post := func(acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/movies", strings.NewReader(`{"title":"Casablanca"}`))
+		r.Header.Set(middlewares.IdempotencyKeyHeader, "create-casablanca")
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		engine.ServeHTTP(rr, r)
+		return rr
+	}
+
+	first := post("gzip")
+	if first.Code != http.StatusCreated || first.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("got status %d and Content-Encoding %q, want %d and gzip",
+			first.Code, first.Header().Get("Content-Encoding"), http.StatusCreated)
+	}
+	if got := decompress(t, "gzip", first.Body); got != body {
+		t.Fatal("the first response did not round trip")
+	}
+
+	// The retry negotiates its own coding, or none
+	for _, acceptEncoding := range []string{"gzip", "br", ""} {
+		retry := post(acceptEncoding)
+
+		if retry.Code != http.StatusCreated {
+			t.Errorf("Accept-Encoding %q: got status %d, want %d", acceptEncoding, retry.Code, http.StatusCreated)
+		}
+		if retry.Header().Get(middlewares.IdempotentReplayedHeader) != "true" {
+			t.Errorf("Accept-Encoding %q: the response was not replayed", acceptEncoding)
+		}
+		if got := retry.Header().Get("Location"); got != "/v1/movies/1" {
+			t.Errorf("Accept-Encoding %q: got Location %q, want %q", acceptEncoding, got, "/v1/movies/1")
+		}
+		if got := retry.Header().Values("Vary"); len(got) != 1 {
+			t.Errorf("Accept-Encoding %q: got Vary %q, want it once", acceptEncoding, got)
+		}
+
+		encoding := retry.Header().Get("Content-Encoding")
+		if encoding != strings.TrimSpace(acceptEncoding) {
+			t.Errorf("Accept-Encoding %q: got Content-Encoding %q", acceptEncoding, encoding)
+		}
+		if got := decompress(t, encoding, retry.Body); got != body {
+			t.Errorf("Accept-Encoding %q: the replayed body did not round trip", acceptEncoding)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("the handler ran %d times, want 1", calls)
+	}
+}
+
+// TestIdempotencyKeyReusedOnAnotherID sends the same key and body to two movies,
+// the second request must not be answered with the first one's response
+func TestIdempotencyKeyReusedOnAnotherID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var patched []string
+
+	engine := gin.New()
+	engine.Use(middlewares.Idempotency(newMemoryStore(), time.Hour))
+	engine.PATCH("/v1/movies/:id", func(c *gin.Context) {
+		patched = append(patched, c.Param("id"))
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id")})
+	})
+
+	patch := func(target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(`{"year":1942}`))
+		r.Header.Set(middlewares.IdempotencyKeyHeader, "fix-year")
+		rr := httptest.NewRecorder()
+		engine.ServeHTTP(rr, r)
+		return rr
+	}
+
+	if rr := patch("/v1/movies/1"); rr.Code != http.StatusOK {
+		t.Fatalf("first request: got status %d, want %d", rr.Code, http.StatusOK)
+	}
+	if rr := patch("/v1/movies/1"); rr.Header().Get(middlewares.IdempotentReplayedHeader) != "true" {
+		t.Fatal("the retry was not replayed")
+	}
+
+	for _, target := range []string{"/v1/movies/2", "/v1/movies/1?fields=title"} {
+		rr := patch(target)
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: got status %d, want %d", target, rr.Code, http.StatusUnprocessableEntity)
+		}
+		if rr.Header().Get(middlewares.IdempotentReplayedHeader) != "" {
+			t.Errorf("%s: the first response was replayed", target)
+		}
+	}
+
+	if len(patched) != 1 {
+		t.Errorf("the handler ran for %v, want only the first request", patched)
+	}
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"context"
+
+	"greenlight/pkg/httphelpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ImpersonationAuditor interface {
+	AuditImpersonatedRequest(ctx context.Context, impersonatorID, userID int64, ip string, details map[string]any) error
+}
+
+// AuditImpersonation records every unsafe request made through an impersonation
+// token in the audit log, once it is served, so refused ones are recorded too.
+// It must come after Authenticate.
+func AuditImpersonation(auditor ImpersonationAuditor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		impersonatorID, ok := httphelpers.ContextGetImpersonator(c)
+		if !ok || !unsafeMethod(c.Request.Method) {
+			return
+		}
+
+		user, err := httphelpers.ContextGetUser(c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		// The client may be gone, the entry is written anyway
+		err = auditor.AuditImpersonatedRequest(context.Background(), impersonatorID, user.ID,
+			httphelpers.RemoteIP(c), map[string]any{
+				"method": c.Request.Method,
+				"path":   c.Request.URL.Path,
+				"route":  route,
+				"status": c.Writer.Status(),
+			})
+		if err != nil {
+			c.Error(err)
+		}
+	}
+}
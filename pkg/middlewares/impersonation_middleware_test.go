@@ -0,0 +1,144 @@
+package middlewares_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	permissionsmodels "greenlight/internal/permissions/models"
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+	"greenlight/pkg/authz"
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ownToken          = strings.Repeat("O", 26)
+	impersonatedToken = strings.Repeat("I", 26)
+)
+
+const (
+	aliceID = 1
+	adminID = 99
+)
+
+type sessions struct{}
+
+func (sessions) GetForAuthenticationToken(ctx context.Context, tokenPlaintext string) (models.User, int64, error) {
+	alice := models.User{ID: aliceID, Email: "alice@example.com", Activated: true}
+
+	switch tokenPlaintext {
+	case ownToken:
+		return alice, 0, nil
+	case impersonatedToken:
+		return alice, adminID, nil
+	default:
+		return models.User{}, 0, repoerrors.ErrTokenNotFound
+	}
+}
+
+type noPermissions struct{}
+
+func (noPermissions) GetAllForUser(ctx context.Context, userID int64) (permissionsmodels.Permissions, error) {
+	return permissionsmodels.Permissions{}, nil
+}
+
+type auditEntry struct {
+	impersonatorID, userID int64
+	details                map[string]any
+}
+
+type fakeAuditor struct {
+	mu      sync.Mutex
+	entries []auditEntry
+}
+
+func (a *fakeAuditor) AuditImpersonatedRequest(ctx context.Context, impersonatorID, userID int64, ip string,
+	details map[string]any,
+) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries = append(a.entries, auditEntry{impersonatorID, userID, details})
+	return nil
+}
+
+func TestImpersonation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	auditor := &fakeAuditor{}
+	policies := authz.New()
+
+	engine := gin.New()
+	engine.Use(
+		middlewares.Authenticate(sessions{}, nil, nil),
+		middlewares.AuditImpersonation(auditor),
+		middlewares.Authorize(policies, noPermissions{}, middlewares.MFARequirement{}),
+	)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	v1 := authz.NewGroup(engine.Group("/v1"), policies)
+	v1.GET("/users/me", authz.Activated(), ok)
+	v1.PUT("/users", authz.Activated().OwnerOnly(), ok)
+	v1.POST("/api-keys", authz.Activated().OwnerOnly(), ok)
+	v1.PATCH("/organizations/:id", authz.Activated(), ok)
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		target  string
+		token   string
+		status  int
+		audited bool
+	}{
+		{"owner changes the email", http.MethodPut, "/v1/users", ownToken, http.StatusOK, false},
+		{"owner creates an api key", http.MethodPost, "/v1/api-keys", ownToken, http.StatusOK, false},
+		{"impersonator changes the email", http.MethodPut, "/v1/users", impersonatedToken, http.StatusForbidden, true},
+		{"impersonator creates an api key", http.MethodPost, "/v1/api-keys", impersonatedToken, http.StatusForbidden, true},
+		{"impersonator makes another change", http.MethodPatch, "/v1/organizations/7", impersonatedToken, http.StatusOK, true},
+		{"impersonator reads", http.MethodGet, "/v1/users/me", impersonatedToken, http.StatusOK, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			auditor.entries = nil
+
+			r := httptest.NewRequest(tc.method, tc.target, nil)
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+			rr := httptest.NewRecorder()
+			engine.ServeHTTP(rr, r)
+
+			if rr.Code != tc.status {
+				t.Fatalf("got status %d, want %d: %s", rr.Code, tc.status, rr.Body)
+			}
+			if rr.Code == http.StatusForbidden {
+				var problem struct{ Code string }
+				json.Unmarshal(rr.Body.Bytes(), &problem)
+				if problem.Code != "impersonated" {
+					t.Errorf("got problem code %q, want %q", problem.Code, "impersonated")
+				}
+			}
+
+			if !tc.audited {
+				if len(auditor.entries) != 0 {
+					t.Errorf("got audit entries %+v, want none", auditor.entries)
+				}
+				return
+			}
+
+			if len(auditor.entries) != 1 {
+				t.Fatalf("got %d audit entries, want 1", len(auditor.entries))
+			}
+			entry := auditor.entries[0]
+			if entry.impersonatorID != adminID || entry.userID != aliceID {
+				t.Errorf("got impersonator %d and user %d, want %d and %d", entry.impersonatorID, entry.userID, adminID, aliceID)
+			}
+			if entry.details["path"] != tc.target || entry.details["status"] != tc.status {
+				t.Errorf("got details %v, want path %s and status %d", entry.details, tc.target, tc.status)
+			}
+		})
+	}
+}
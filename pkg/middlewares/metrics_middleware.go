@@ -2,49 +2,19 @@ package middlewares
 
 import (
 	"expvar"
-	"net/http"
 	"strconv"
 	"time"
 
+	"greenlight/pkg/metrics"
+
 	"github.com/gin-gonic/gin"
 )
 
-type metricsResponseWriter struct {
-	wrapped       http.ResponseWriter
-	statusCode    int
-	headerWritten bool
-}
-
-func newMetricsResponseWriter(w http.ResponseWriter) *metricsResponseWriter {
-	return &metricsResponseWriter{
-		wrapped:    w,
-		statusCode: http.StatusOK,
-	}
-}
-
-func (mw *metricsResponseWriter) Header() http.Header {
-	return mw.wrapped.Header()
-}
-
-func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
-	mw.wrapped.WriteHeader(statusCode)
-
-	if !mw.headerWritten {
-		mw.statusCode = statusCode
-		mw.headerWritten = true
-	}
-}
-
-func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
-	mw.headerWritten = true
-	return mw.wrapped.Write(b)
-}
-
-func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
-	return mw.wrapped
-}
-
-func Metrics() gin.HandlerFunc {
+// Metrics updates the expvar counters and observes the duration of every
+// request in requestDuration, labelled by route template, method and status.
+// Unmatched requests share the route label "unmatched", so scanners cannot
+// create a series per path.
+func Metrics(requestDuration *metrics.Histogram) gin.HandlerFunc {
 	var (
 		totalRequestsReceived           = expvar.NewInt("total_requests_received")
 		totalResponsesSent              = expvar.NewInt("total_responses_sent")
@@ -54,11 +24,17 @@ func Metrics() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		totalRequestsReceived.Add(1)
-		mw := newMetricsResponseWriter(c.Writer)
 		c.Next()
+		duration := time.Since(start)
+		status := strconv.Itoa(c.Writer.Status())
 		totalResponsesSent.Add(1)
-		totalResponsesSentByStatus.Add(strconv.Itoa(mw.statusCode), 1)
-		duration := time.Since(start).Microseconds()
-		totalProcessingTimeMicroseconds.Add(duration)
+		totalResponsesSentByStatus.Add(status, 1)
+		totalProcessingTimeMicroseconds.Add(duration.Microseconds())
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		requestDuration.Observe(duration.Seconds(), route, c.Request.Method, status)
 	}
 }
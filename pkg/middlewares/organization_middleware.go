@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"greenlight/internal/organizations/models"
+	"greenlight/internal/organizations/serviceerrors"
+	"greenlight/pkg/httphelpers"
+
+	"github.com/gin-gonic/gin"
+)
+
+const OrganizationHeader = "X-Organization-ID"
+
+type OrganizationResolver interface {
+	Resolve(ctx context.Context, userID, orgID int64) (models.Scope, error)
+}
+
+// ActiveOrganization resolves the organization the request acts on and stores
+// its scope in the context. The organization comes from the token or from the
+// X-Organization-ID header, and the user must be a member of it. Users with a
+// single membership may omit both.
+func ActiveOrganization(resolver OrganizationResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", OrganizationHeader)
+
+		user, err := httphelpers.ContextGetUser(c)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			c.Abort()
+			return
+		}
+
+		if user.IsAnonymous() {
+			httphelpers.StatusUnauthorizedResponse(c)
+			c.Abort()
+			return
+		}
+
+		var orgID int64
+
+		if header := c.GetHeader(OrganizationHeader); header != "" {
+			orgID, err = strconv.ParseInt(header, 10, 64)
+			if err != nil || orgID < 1 {
+				httphelpers.StatusBadRequestResponse(c, "invalid "+OrganizationHeader+" header")
+				c.Abort()
+				return
+			}
+		}
+
+		if tokenOrgID, ok := httphelpers.ContextGetTokenOrganization(c); ok {
+			if orgID != 0 && orgID != tokenOrgID {
+				httphelpers.ProblemResponse(c, httphelpers.CodeForbidden, "token is bound to another organization")
+				c.Abort()
+				return
+			}
+			orgID = tokenOrgID
+		}
+
+		scope, err := resolver.Resolve(c.Request.Context(), user.ID, orgID)
+		if err != nil {
+			switch {
+			case errors.Is(err, serviceerrors.ErrOrgRequired):
+				httphelpers.StatusBadRequestResponse(c, err.Error())
+			case errors.Is(err, serviceerrors.ErrNotMember):
+				httphelpers.ProblemResponse(c, httphelpers.CodeForbidden, err.Error())
+			default:
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+			}
+			c.Abort()
+			return
+		}
+
+		httphelpers.ContextSetScope(c, scope)
+
+		c.Next()
+	}
+}
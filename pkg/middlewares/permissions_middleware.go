@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"greenlight/internal/permissions/models"
+	"greenlight/pkg/authz"
 	"greenlight/pkg/httphelpers"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +14,31 @@ type PermissionsRepo interface {
 	GetAllForUser(ctx context.Context, userID int64) (models.Permissions, error)
 }
 
+type MFAChecker interface {
+	IsEnabled(ctx context.Context, userID int64) (bool, error)
+}
+
+// MFARequirement makes the routes guarded by one of Permissions also need a user
+// with two-factor authentication enabled. The zero value requires nothing.
+type MFARequirement struct {
+	Checker     MFAChecker
+	Permissions []string
+}
+
+func (r MFARequirement) covers(code string) bool {
+	if r.Checker == nil {
+		return false
+	}
+
+	for _, permission := range r.Permissions {
+		if permission == code {
+			return true
+		}
+	}
+
+	return false
+}
+
 func RequireAuthenticatedUser(next gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, err := httphelpers.ContextGetUser(c)
@@ -42,25 +68,30 @@ func RequireActivatedUser(next gin.HandlerFunc) gin.HandlerFunc {
 		}
 
 		if user.IsAnonymous() {
-			httphelpers.StatusForbiddenJSONPayloadResponse(c, map[string]any{"error": "auth needed"})
+			httphelpers.StatusUnauthorizedResponse(c)
 			c.Abort()
 
 			return
 		}
 
 		if !user.Activated {
-			httphelpers.StatusForbiddenJSONPayloadResponse(c, map[string]any{"error": "activation required"})
+			httphelpers.ProblemResponse(c, httphelpers.CodeActivationRequired,
+				"your user account must be activated to access this resource")
 			c.Abort()
 			return
 		}
 
-		c.Next()
+		next(c)
 	}
 
 	return RequireAuthenticatedUser(fn)
 }
 
 func RequirePermission(permissionsRepo PermissionsRepo, code string) gin.HandlerFunc {
+	return requirePermission(permissionsRepo, code, func(c *gin.Context) { c.Next() })
+}
+
+func requirePermission(permissionsRepo PermissionsRepo, code string, next gin.HandlerFunc) gin.HandlerFunc {
 	fn := func(c *gin.Context) {
 		user, err := httphelpers.ContextGetUser(c)
 		if err != nil {
@@ -69,21 +100,98 @@ func RequirePermission(permissionsRepo PermissionsRepo, code string) gin.Handler
 			return
 		}
 
-		permissions, err := permissionsRepo.GetAllForUser(c, user.ID)
+		permissions, ok := httphelpers.ContextGetPermissions(c)
+		if !ok {
+			permissions, err = permissionsRepo.GetAllForUser(c, user.ID)
+			if err != nil {
+				httphelpers.StatusInternalServerErrorResponse(c, err)
+				c.Abort()
+				return
+			}
+			httphelpers.ContextSetPermissions(c, permissions)
+		}
+
+		if !permissions.Include(code) {
+			httphelpers.StatusForbiddenResponse(c)
+			c.Abort()
+			return
+		}
+
+		next(c)
+	}
+
+	return RequireActivatedUser(fn)
+}
+
+// requireMFA refuses users who have not enabled two-factor authentication. It
+// runs after the user has been authenticated.
+func requireMFA(checker MFAChecker, next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := httphelpers.ContextGetUser(c)
 		if err != nil {
 			httphelpers.StatusInternalServerErrorResponse(c, err)
 			c.Abort()
 			return
 		}
 
-		if !permissions.Include(code) {
-			httphelpers.StatusForbiddenResponse(c)
+		enabled, err := checker.IsEnabled(c, user.ID)
+		if err != nil {
+			httphelpers.StatusInternalServerErrorResponse(c, err)
+			c.Abort()
+			return
+		}
+
+		if !enabled {
+			httphelpers.ProblemResponse(c, httphelpers.CodeMFARequired,
+				"enable two-factor authentication to access this resource")
 			c.Abort()
 			return
 		}
 
-		c.Next()
+		next(c)
 	}
+}
 
-	return RequireActivatedUser(fn)
+// Authorize enforces the policy declared for the matched route. Requests that
+// matched no route carry on to the 404 and 405 handlers, and a matched route
+// without a policy is refused, although Policies.Verify makes that impossible
+// at startup. Permission routes covered by mfa also need two-factor
+// authentication, and owner only routes refuse impersonated requests.
+func Authorize(policies *authz.Policies, permissionsRepo PermissionsRepo, mfa MFARequirement) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fullPath := c.FullPath()
+		if fullPath == "" {
+			c.Next()
+			return
+		}
+
+		policy, ok := policies.Lookup(c.Request.Method, fullPath)
+		if !ok {
+			httphelpers.StatusForbiddenResponse(c)
+			c.Abort()
+			return
+		}
+
+		if _, impersonated := httphelpers.ContextGetImpersonator(c); impersonated && policy.Owner {
+			httphelpers.ProblemResponse(c, httphelpers.CodeImpersonated,
+				"this action can only be taken by the account owner, not while impersonating them")
+			c.Abort()
+			return
+		}
+
+		switch policy.Level {
+		case authz.LevelPublic:
+			c.Next()
+		case authz.LevelAuthenticated:
+			RequireAuthenticatedUser(func(c *gin.Context) { c.Next() })(c)
+		case authz.LevelActivated:
+			RequireActivatedUser(func(c *gin.Context) { c.Next() })(c)
+		case authz.LevelPermission:
+			next := func(c *gin.Context) { c.Next() }
+			if mfa.covers(policy.Permission) {
+				next = requireMFA(mfa.Checker, next)
+			}
+			requirePermission(permissionsRepo, policy.Permission, next)(c)
+		}
+	}
 }
@@ -1,69 +1,113 @@
 package middlewares
 
 import (
-	"net"
-	"sync"
-	"time"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 
 	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/ratelimit"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
 )
 
-type client struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
+// RateLimitKey identifies the client a request is counted against
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimitByIP counts requests per client IP
+func RateLimitByIP(c *gin.Context) string {
+	return "ip:" + httphelpers.RemoteIP(c)
 }
 
-func RateLimit(enabled bool) gin.HandlerFunc {
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
+// RateLimitByUser counts requests per authenticated user, anonymous requests
+// per client IP
+func RateLimitByUser(c *gin.Context) string {
+	user, err := httphelpers.ContextGetUser(c)
+	if err != nil || user.IsAnonymous() {
+		return RateLimitByIP(c)
+	}
+
+	return "user:" + strconv.FormatInt(user.ID, 10)
+}
 
-	go func() {
-		for {
-			time.Sleep(time.Minute)
+// RateLimitByAPIKey counts requests per API key, so every key of a user has its
+// own budget. Other requests are counted as RateLimitByUser does.
+func RateLimitByAPIKey(c *gin.Context) string {
+	id, ok := httphelpers.ContextGetAPIKeyID(c)
+	if !ok {
+		return RateLimitByUser(c)
+	}
 
-			mu.Lock()
+	return "apikey:" + strconv.FormatInt(id, 10)
+}
 
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
+// RateLimitPolicy limits the routes whose template starts with Prefix. An
+// empty prefix matches every request, unknown routes included. Name keeps the
+// buckets of policies that would otherwise share them apart, like the ones of
+// two RateLimit middlewares.
+type RateLimitPolicy struct {
+	Name   string
+	Prefix string
+	Limit  ratelimit.Limit
+	Key    RateLimitKey
+}
 
-			mu.Unlock()
+// RateLimit counts each request against the policy with the longest matching
+// prefix, so a route group can have a stricter or looser limit than the rest of
+// the API. Policies keep separate buckets. It needs the user set by
+// Authenticate to key by user or API key. Store errors let the request through.
+func RateLimit(store ratelimit.Store, logger *jsonlog.Logger, policies ...RateLimitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, ok := matchRateLimitPolicy(policies, c.FullPath())
+		if !ok {
+			c.Next()
+			return
 		}
-	}()
 
-	return func(c *gin.Context) {
-		if enabled {
-			ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
-			if err != nil {
-				httphelpers.StatusInternalServerErrorResponse(c, err)
-				c.Abort()
-				return
-			}
-
-			mu.Lock()
-
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{limiter: rate.NewLimiter(2, 4)}
-			}
-			clients[ip].lastSeen = time.Now()
-
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
-				httphelpers.RateLimitExceededResponse(c)
-				c.Abort()
-				return
-			}
-
-			mu.Unlock()
+		key := policy.Prefix + "|" + policy.Key(c)
+		if policy.Name != "" {
+			key = policy.Name + ":" + key
+		}
 
+		result, err := store.Take(c.Request.Context(), key, policy.Limit)
+		if err != nil {
+			logger.PrintError(err, map[string]string{"middleware": "rate limit"})
+			c.Next()
+			return
 		}
+
+		window := int(math.Ceil(policy.Limit.Window().Seconds()))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", result.Limit, window))
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+
+		if !result.Allowed {
+			httphelpers.RateLimitExceededResponse(c, result.RetryAfter)
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
+
+func matchRateLimitPolicy(policies []RateLimitPolicy, path string) (RateLimitPolicy, bool) {
+	var (
+		match RateLimitPolicy
+		found bool
+	)
+	for _, policy := range policies {
+		if !strings.HasPrefix(path, policy.Prefix) {
+			continue
+		}
+		if !found || len(policy.Prefix) > len(match.Prefix) {
+			match = policy
+			found = true
+		}
+	}
+
+	return match, found
+}
@@ -0,0 +1,100 @@
+package middlewares_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"greenlight/internal/users/models"
+	"greenlight/internal/users/repoerrors"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/middlewares"
+	"greenlight/pkg/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+type unknownTokens struct{}
+
+func (unknownTokens) GetForAuthenticationToken(ctx context.Context, tokenPlaintext string) (models.User, int64, error) {
+	return models.User{}, 0, repoerrors.ErrTokenNotFound
+}
+
+// TestRateLimitBeforeAuthenticate sprays bad tokens, which Authenticate turns
+// into 401s before any limiter keyed by user runs
+func TestRateLimitBeforeAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := ratelimit.NewMemoryStore()
+	logger := jsonlog.New(io.Discard, jsonlog.LevelOff)
+
+	engine := gin.New()
+	engine.Use(
+		middlewares.RateLimit(store, logger, middlewares.RateLimitPolicy{
+			Name:  "preauth",
+			Limit: ratelimit.Limit{Rate: 0.1, Burst: 3},
+			Key:   middlewares.RateLimitByIP,
+		}),
+		middlewares.Authenticate(unknownTokens{}, nil, nil),
+		middlewares.RateLimit(store, logger, middlewares.RateLimitPolicy{
+			Limit: ratelimit.Limit{Rate: 0.1, Burst: 3},
+			Key:   middlewares.RateLimitByUser,
+		}),
+	)
+	engine.GET("/v1/movies", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	var statuses []int
+	for i := 0; i < 5; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+		r.RemoteAddr = "203.0.113.7:1234"
+		r.Header.Set("Authorization", "Bearer "+strings.Repeat("A", 26))
+
+		rr := httptest.NewRecorder()
+		engine.ServeHTTP(rr, r)
+		statuses = append(statuses, rr.Code)
+	}
+
+	want := []int{401, 401, 401, 429, 429}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("got statuses %v, want %v", statuses, want)
+		}
+	}
+
+	// Another client is not affected
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+	r.RemoteAddr = "198.51.100.1:1234"
+	rr := httptest.NewRecorder()
+	engine.ServeHTTP(rr, r)
+	if rr.Code != http.StatusOK {
+		t.Errorf("another client got status %d, want %d", rr.Code, http.StatusOK)
+	}
+}
+
+// TestRateLimitPolicyNames checks that two limiters with the same prefix and
+// key do not share buckets when named
+func TestRateLimitPolicyNames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := ratelimit.NewMemoryStore()
+	logger := jsonlog.New(io.Discard, jsonlog.LevelOff)
+	limit := ratelimit.Limit{Rate: 0.1, Burst: 2}
+
+	engine := gin.New()
+	engine.Use(
+		middlewares.RateLimit(store, logger, middlewares.RateLimitPolicy{Name: "preauth", Limit: limit, Key: middlewares.RateLimitByIP}),
+		middlewares.RateLimit(store, logger, middlewares.RateLimitPolicy{Limit: limit, Key: middlewares.RateLimitByIP}),
+	)
+	engine.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		engine.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want %d", i, rr.Code, http.StatusOK)
+		}
+	}
+}
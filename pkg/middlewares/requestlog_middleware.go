@@ -0,0 +1,121 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength = 128
+)
+
+// RequestID keeps the X-Request-ID sent by the client or a proxy, or makes a
+// new one when it is missing or malformed. The ID is stored in the request
+// context and echoed in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		httphelpers.ContextSetRequestID(c, id)
+		c.Header(RequestIDHeader, id)
+
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	// Printable ASCII without spaces, so IDs cannot forge log lines
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// LogRequests writes one line per request once it is served, and one line per
+// error the handlers pushed into c.Errors, e.g. through
+// httphelpers.StatusInternalServerErrorResponse. It must come after RequestID
+// and Trace and before RecoverPanic, so recovered panics are logged too. A
+// child logger carrying the request and trace IDs is stored in the request
+// context for jsonlog.FromContext.
+func LogRequests(logger *jsonlog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestLogger := logger
+		if id, ok := httphelpers.ContextGetRequestID(c); ok {
+			requestLogger = logger.With(jsonlog.String("request_id", id))
+		}
+		if traceID, spanID := tracing.IDs(c.Request.Context()); traceID != "" {
+			requestLogger = requestLogger.With(jsonlog.String("trace_id", traceID), jsonlog.String("span_id", spanID))
+		}
+		c.Request = c.Request.WithContext(jsonlog.NewContext(c.Request.Context(), requestLogger))
+
+		c.Next()
+
+		if user, err := httphelpers.ContextGetUser(c); err == nil && !user.IsAnonymous() {
+			requestLogger = requestLogger.With(jsonlog.Int64("user_id", user.ID))
+		}
+		if impersonatorID, ok := httphelpers.ContextGetImpersonator(c); ok {
+			requestLogger = requestLogger.With(jsonlog.Int64("impersonator_id", impersonatorID))
+		}
+
+		// Unmatched requests have no route template, log the raw path instead
+		route := jsonlog.String("route", c.FullPath())
+		if c.FullPath() == "" {
+			route = jsonlog.String("path", c.Request.URL.Path)
+		}
+
+		for _, err := range c.Errors {
+			requestLogger.Error(err.Err, jsonlog.String("method", c.Request.Method), route)
+		}
+
+		// gin reports -1 bytes when nothing was written
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+
+		// Request lines are sampled per route and status, so the flood of one
+		// route does not hide the rare requests of others, nor its own errors.
+		// Unmatched paths share one key, a scan cannot grow the counts.
+		sampleKey := c.Request.Method + " " + c.FullPath() + " " + strconv.Itoa(c.Writer.Status())
+
+		requestLogger.SampleBy(sampleKey).Info("request",
+			jsonlog.String("method", c.Request.Method),
+			route,
+			jsonlog.Int("status", c.Writer.Status()),
+			jsonlog.Duration("latency_ms", time.Since(start)),
+			jsonlog.Int("bytes", size),
+			jsonlog.String("client_ip", httphelpers.RemoteIP(c)),
+		)
+	}
+}
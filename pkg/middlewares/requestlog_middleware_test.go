@@ -0,0 +1,116 @@
+package middlewares_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/jsonlog"
+	"greenlight/pkg/middlewares"
+
+	"github.com/gin-gonic/gin"
+)
+
+type logLine struct {
+	Level      string         `json:"level"`
+	Message    string         `json:"message"`
+	Properties map[string]any `json:"properties"`
+}
+
+func readLogLines(t *testing.T, buf *bytes.Buffer) []logLine {
+	t.Helper()
+
+	var lines []logLine
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line logLine
+		err := json.Unmarshal(scanner.Bytes(), &line)
+		if err != nil {
+			t.Fatalf("%v: %s", err, scanner.Text())
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// TestLogRequestsSampling floods one route with sampling on, and expects the
+// other routes, statuses and errors to still be logged
+func TestLogRequestsSampling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	logger := jsonlog.New(&buf, jsonlog.LevelInfo)
+	logger.SetSampling(jsonlog.Sampling{Initial: 2, Thereafter: 0, Tick: time.Minute})
+
+	engine := gin.New()
+	engine.Use(middlewares.RequestID(), middlewares.LogRequests(logger))
+	engine.GET("/v1/healthcheck", func(c *gin.Context) {
+		if c.Query("fail") != "" {
+			httphelpers.StatusInternalServerErrorResponse(c, errors.New("database is down"))
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	engine.GET("/v1/movies/:id", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+
+	get := func(target, requestID string) {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set(middlewares.RequestIDHeader, requestID)
+		engine.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	for i := 0; i < 10; i++ {
+		get("/v1/healthcheck", "flood")
+	}
+	get("/v1/movies/1", "movie")
+	get("/v1/healthcheck?fail=1", "failure")
+
+	type seen struct {
+		route  string
+		status float64
+	}
+	requests := map[seen]int{}
+	var errorLine *logLine
+
+	lines := readLogLines(t, &buf)
+	for i, line := range lines {
+		switch line.Message {
+		case "request":
+			route, _ := line.Properties["route"].(string)
+			status, _ := line.Properties["status"].(float64)
+			requests[seen{route, status}]++
+
+			if route == "/v1/movies/:id" && line.Properties["request_id"] != "movie" {
+				t.Errorf("got request_id %v, want %q", line.Properties["request_id"], "movie")
+			}
+		case "database is down":
+			errorLine = &lines[i]
+		}
+	}
+
+	if n := requests[seen{"/v1/healthcheck", 200}]; n != 2 {
+		t.Errorf("got %d lines for the flooded route, want 2", n)
+	}
+	if n := requests[seen{"/v1/movies/:id", 404}]; n != 1 {
+		t.Errorf("got %d lines for another route, want 1", n)
+	}
+	if n := requests[seen{"/v1/healthcheck", 500}]; n != 1 {
+		t.Errorf("got %d lines for another status of the flooded route, want 1", n)
+	}
+
+	if errorLine == nil {
+		t.Fatal("the error pushed into c.Errors was not logged")
+	}
+	if errorLine.Level != "ERROR" || errorLine.Properties["request_id"] != "failure" {
+		t.Errorf("got error line %+v, want an ERROR with request_id %q", *errorLine, "failure")
+	}
+}
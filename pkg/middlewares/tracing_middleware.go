@@ -0,0 +1,76 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"greenlight/pkg/httphelpers"
+	"greenlight/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace starts the server span of every request, continuing the trace of a
+// W3C traceparent header when the client sent one. It must come first, so
+// every other middleware runs inside the span. The span is named after the
+// route template, unmatched requests share the name "METHOD unmatched".
+func Trace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("http.target", c.Request.URL.Path),
+				attribute.String("net.sock.peer.addr", httphelpers.RemoteIP(c)),
+			),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if id, ok := httphelpers.ContextGetRequestID(c); ok {
+			span.SetAttributes(attribute.String("request_id", id))
+		}
+
+		for _, err := range c.Errors {
+			span.RecordError(err.Err)
+		}
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// Traced runs handler in a span of its own. Middlewares calling c.Next() have
+// the rest of the chain as children of their span.
+func Traced(name string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, span := tracing.Start(c.Request.Context(), "middleware "+name)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+
+		handler(c)
+
+		if c.IsAborted() {
+			span.SetAttributes(attribute.Bool("aborted", true))
+		}
+	}
+}
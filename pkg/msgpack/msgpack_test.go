@@ -0,0 +1,145 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"greenlight/pkg/msgpack"
+)
+
+// unhex decodes a space separated hex dump
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMarshal(t *testing.T) {
+	five := 5
+	var nilPointer *int
+
+	for _, tc := range []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"nil", nil, "c0"},
+		{"false", false, "c2"},
+		{"true", true, "c3"},
+
+		{"positive fixint", 0, "00"},
+		{"largest positive fixint", 127, "7f"},
+		{"uint 8", 128, "cc 80"},
+		{"largest uint 8", uint8(255), "cc ff"},
+		{"uint 16", 256, "cd 01 00"},
+		{"uint 32", 65536, "ce 00 01 00 00"},
+		{"uint 64", int64(1) << 32, "cf 00 00 00 01 00 00 00 00"},
+		{"largest uint 64", uint64(math.MaxUint64), "cf ff ff ff ff ff ff ff ff"},
+		{"negative fixint", -1, "ff"},
+		{"smallest negative fixint", -32, "e0"},
+		{"int 8", -33, "d0 df"},
+		{"smallest int 8", int8(math.MinInt8), "d0 80"},
+		{"int 16", -129, "d1 ff 7f"},
+		{"int 32", -32769, "d2 ff ff 7f ff"},
+		{"int 64", int64(math.MinInt64), "d3 80 00 00 00 00 00 00 00"},
+
+		{"float 32", float32(1.5), "ca 3f c0 00 00"},
+		{"float 64", 1.5, "cb 3f f8 00 00 00 00 00 00"},
+
+		{"json integer", json.Number("42"), "2a"},
+		{"json negative integer", json.Number("-1"), "ff"},
+		{"json uint 64", json.Number("18446744073709551615"), "cf ff ff ff ff ff ff ff ff"},
+		{"json float", json.Number("1.5"), "cb 3f f8 00 00 00 00 00 00"},
+
+		{"empty string", "", "a0"},
+		{"fixstr", "hi", "a2 68 69"},
+		{"bin 8", []byte{1, 2}, "c4 02 01 02"},
+		{"nil bytes", []byte(nil), "c0"},
+
+		{"fixarray", []int{1, 2, 3}, "93 01 02 03"},
+		{"array", [2]bool{true, false}, "92 c3 c2"},
+		{"empty array", []any{}, "90"},
+		{"nil slice", []string(nil), "c0"},
+
+		{"fixmap sorted by key", map[string]any{"b": 1, "a": nil}, "82 a1 61 c0 a1 62 01"},
+		{"nested", map[string]any{"ids": []any{json.Number("1")}}, "81 a3 69 64 73 91 01"},
+		{"nil map", map[string]int(nil), "c0"},
+
+		{"pointer", &five, "05"},
+		{"nil pointer", nilPointer, "c0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := msgpack.Marshal(tc.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := unhex(t, tc.want); !bytes.Equal(got, want) {
+				t.Errorf("got % x, want % x", got, want)
+			}
+		})
+	}
+}
+
+// TestMarshalLengths checks the headers of values too long for the fix formats
+func TestMarshalLengths(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		v      any
+		header string
+		length int
+	}{
+		{"str 8", strings.Repeat("a", 32), "d9 20", 2 + 32},
+		{"str 16", strings.Repeat("a", 256), "da 01 00", 3 + 256},
+		{"str 32", strings.Repeat("a", 65536), "db 00 01 00 00", 5 + 65536},
+		{"bin 16", make([]byte, 256), "c5 01 00", 3 + 256},
+		{"bin 32", make([]byte, 65536), "c6 00 01 00 00", 5 + 65536},
+		{"array 16", make([]bool, 16), "dc 00 10", 3 + 16},
+		{"array 32", make([]bool, 65536), "dd 00 01 00 00", 5 + 65536},
+		{"map 16", sixteenKeys(), "de 00 10", 3 + 16*3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := msgpack.Marshal(tc.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header := unhex(t, tc.header); !bytes.HasPrefix(got, header) {
+				t.Errorf("got header % x, want % x", got[:len(header)], header)
+			}
+			if len(got) != tc.length {
+				t.Errorf("got %d bytes, want %d", len(got), tc.length)
+			}
+		})
+	}
+}
+
+// sixteenKeys returns a map of one-letter keys to nil
+func sixteenKeys() map[string]any {
+	m := make(map[string]any)
+	for i := 0; i < 16; i++ {
+		m[string(rune('a'+i))] = nil
+	}
+	return m
+}
+
+func TestMarshalUnsupported(t *testing.T) {
+	for name, v := range map[string]any{
+		"struct":         struct{ ID int }{1},
+		"int map key":    map[int]string{1: "a"},
+		"func":           func() {},
+		"invalid number": json.Number("one"),
+		"nested struct":  []any{struct{}{}},
+	} {
+		_, err := msgpack.Marshal(v)
+		if err == nil {
+			t.Errorf("%s: got no error", name)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys are refetched at most this often when a token names an unknown kid
+const keyRefreshInterval = time.Minute
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type keyCache struct {
+	uri    string
+	client *Client
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	lastRefresh time.Time
+}
+
+func newKeyCache(uri string, client *Client) *keyCache {
+	return &keyCache{
+		uri:    uri,
+		client: client,
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+func (kc *keyCache) get(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+
+	if key, ok := kc.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(kc.lastRefresh) < keyRefreshInterval {
+		return nil, ErrUnknownSigningKey
+	}
+
+	err := kc.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := kc.keys[kid]
+	if !ok {
+		return nil, ErrUnknownSigningKey
+	}
+
+	return key, nil
+}
+
+func (kc *keyCache) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, kc.uri, nil)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err = kc.client.do(req, &set)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	kc.keys = keys
+	kc.lastRefresh = time.Now()
+
+	return nil
+}
+
+func (cl *Client) verifyIDToken(ctx context.Context, meta *discovery, raw, nonce string) (Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	if header.Alg != "RS256" {
+		return Claims{}, ErrUnsupportedAlg
+	}
+
+	key, err := cl.keys.get(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	switch {
+	case claims.Issuer != meta.Issuer,
+		!claims.Audience.contains(cl.cfg.ClientID),
+		time.Now().Unix() >= claims.ExpiresAt,
+		claims.Nonce != nonce,
+		claims.Subject == "":
+		return Claims{}, ErrInvalidIDToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,287 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDiscovery         = errors.New("unable to discover provider configuration")
+	ErrExchange          = errors.New("authorization code exchange failed")
+	ErrMissingIDToken    = errors.New("token response has no id_token")
+	ErrInvalidIDToken    = errors.New("invalid id token")
+	ErrUnsupportedAlg    = errors.New("unsupported id token algorithm")
+	ErrUnknownSigningKey = errors.New("id token signed with an unknown key")
+)
+
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims are the ID token claims the login flow relies on
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// Client drives the authorization code flow against one provider. Provider metadata
+// and keys are fetched lazily and cached, so a provider being down does not
+// prevent the API from starting.
+type Client struct {
+	cfg        Config
+	httpClient *http.Client
+
+	mu   sync.Mutex
+	meta *discovery
+	keys *keyCache
+}
+
+func NewClient(cfg Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &Client{
+		cfg:        cfg,
+		httpClient: httpClient,
+	}
+}
+
+func (cl *Client) Name() string {
+	return cl.cfg.Name
+}
+
+// AuthCodeURL returns the URL to send the user to, carrying the PKCE challenge
+// derived from verifier
+func (cl *Client) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := cl.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", cl.cfg.ClientID)
+	params.Set("redirect_uri", cl.cfg.RedirectURL)
+	params.Set("scope", strings.Join(cl.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", S256Challenge(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return meta.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the verified ID
+// token claims
+func (cl *Client) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	meta, err := cl.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cl.cfg.RedirectURL)
+	form.Set("client_id", cl.cfg.ClientID)
+	form.Set("code_verifier", verifier)
+	if cl.cfg.ClientSecret != "" {
+		form.Set("client_secret", cl.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens tokenResponse
+	err = cl.do(req, &tokens)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+
+	if tokens.IDToken == "" {
+		return Claims{}, ErrMissingIDToken
+	}
+
+	return cl.verifyIDToken(ctx, meta, tokens.IDToken, nonce)
+}
+
+func (cl *Client) discover(ctx context.Context) (*discovery, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.meta != nil {
+		return cl.meta, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(cl.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta discovery
+	err = cl.do(req, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	if meta.Issuer != cl.cfg.Issuer {
+		return nil, fmt.Errorf("%w: issuer mismatch %q", ErrDiscovery, meta.Issuer)
+	}
+
+	cl.meta = &meta
+	cl.keys = newKeyCache(meta.JWKSURI, cl)
+
+	return cl.meta, nil
+}
+
+func (cl *Client) do(req *http.Request, dst any) error {
+	resp, err := cl.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+
+	return json.Unmarshal(body, dst)
+}
+
+// RandomString returns a URL safe random string, suitable for state, nonce and
+// PKCE verifiers
+func RandomString() (string, error) {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// audience accepts both the string and the array form of the aud claim
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseConfig reads a provider from a comma separated list of key=value pairs:
+// name, issuer, client-id, client-secret, redirect-url and scopes (space separated)
+func ParseConfig(spec string) (Config, error) {
+	var cfg Config
+
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return Config{}, fmt.Errorf("invalid provider setting %q", pair)
+		}
+
+		switch strings.TrimSpace(key) {
+		case "name":
+			cfg.Name = value
+		case "issuer":
+			cfg.Issuer = value
+		case "client-id":
+			cfg.ClientID = value
+		case "client-secret":
+			cfg.ClientSecret = value
+		case "redirect-url":
+			cfg.RedirectURL = value
+		case "scopes":
+			cfg.Scopes = strings.Fields(value)
+		default:
+			return Config{}, fmt.Errorf("unknown provider setting %q", key)
+		}
+	}
+
+	if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return Config{}, errors.New("provider needs at least name, issuer, client-id and redirect-url")
+	}
+
+	return cfg, nil
+}
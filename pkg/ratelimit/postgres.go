@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PostgresStore shares buckets between instances through the rate_limits
+// table. A request costs one statement, the decision is taken by the database
+// using its own clock, so instance clock skew does not matter.
+type PostgresStore struct {
+	DB *sqlx.DB
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{
+		DB: db,
+	}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	// In the SET list r.tat is the stored value, so allowed and tat are both
+	// decided on the TAT before this request. Times are epoch seconds.
+	query := `
+        INSERT INTO rate_limits AS r (key, tat, allowed)
+        VALUES ($1, extract(epoch FROM now())::float8 + $2, true)
+        ON CONFLICT (key) DO UPDATE SET
+            allowed = greatest(r.tat, extract(epoch FROM now())::float8) + $2 - $3 <= extract(epoch FROM now())::float8,
+            tat = CASE
+                WHEN greatest(r.tat, extract(epoch FROM now())::float8) + $2 - $3 <= extract(epoch FROM now())::float8
+                THEN greatest(r.tat, extract(epoch FROM now())::float8) + $2
+                ELSE r.tat
+            END
+        RETURNING tat, allowed, extract(epoch FROM now())::float8 AS now`
+
+	var row struct {
+		TAT     float64 `db:"tat"`
+		Allowed bool    `db:"allowed"`
+		Now     float64 `db:"now"`
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := s.DB.GetContext(ctx, &row, query, key, limit.interval().Seconds(), limit.Window().Seconds())
+	if err != nil {
+		return Result{}, err
+	}
+
+	now := fromEpoch(row.Now)
+	tat := fromEpoch(row.TAT)
+
+	if row.Allowed {
+		return result(now, tat, limit), nil
+	}
+
+	return Result{
+		Allowed:    false,
+		Limit:      limit.Burst,
+		Remaining:  0,
+		Reset:      tat.Sub(now),
+		RetryAfter: tat.Add(limit.interval()).Add(-limit.Window()).Sub(now),
+	}, nil
+}
+
+func (s *PostgresStore) Prune(ctx context.Context) error {
+	query := `
+        DELETE FROM rate_limits
+        WHERE tat < extract(epoch FROM now())::float8`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, query)
+	return err
+}
+
+func fromEpoch(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// The Postgres tests need a migrated database, e.g. the one make
+// db/migrations/up prepares
+const testDSNEnv = "GREENLIGHT_TEST_DB_DSN"
+
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSNEnv)
+	}
+
+	db, err := sqlx.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	key := fmt.Sprintf("test:%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM rate_limits WHERE key = $1`, key)
+	})
+
+	s := NewPostgresStore(db)
+	ctx := context.Background()
+	// Slow enough that nothing refills while the test runs
+	limit := Limit{Rate: 0.01, Burst: 3}
+
+	for i, remaining := range []int{2, 1, 0} {
+		result, err := s.Take(ctx, key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed || result.Remaining != remaining {
+			t.Fatalf("request %d: got %+v, want allowed with %d remaining", i, result, remaining)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := s.Take(ctx, key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed {
+			t.Fatalf("refused request %d was allowed", i)
+		}
+
+		// The refusals must not move the TAT, the wait stays one interval
+		interval := limit.interval()
+		if result.RetryAfter <= interval-time.Second || result.RetryAfter > interval {
+			t.Errorf("refused request %d: got RetryAfter %v, want about %v", i, result.RetryAfter, interval)
+		}
+		if result.Reset <= limit.Window()-time.Second || result.Reset > limit.Window() {
+			t.Errorf("refused request %d: got Reset %v, want about %v", i, result.Reset, limit.Window())
+		}
+	}
+
+	err = s.Prune(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.Take(ctx, key, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Error("prune forgot a bucket that was still refilling")
+	}
+}
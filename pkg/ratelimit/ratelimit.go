@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Burst requests at once, refilled at Rate requests per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit reads a limit written as rate:burst, e.g. 0.5:10
+func ParseLimit(val string) (Limit, error) {
+	rps, burst, ok := strings.Cut(val, ":")
+	if !ok {
+		return Limit{}, errors.New("rate limit must be written as rate:burst")
+	}
+
+	var (
+		limit Limit
+		err   error
+	)
+	limit.Rate, err = strconv.ParseFloat(rps, 64)
+	if err != nil {
+		return Limit{}, err
+	}
+	limit.Burst, err = strconv.Atoi(burst)
+	if err != nil {
+		return Limit{}, err
+	}
+
+	return limit, limit.Validate()
+}
+
+func (l Limit) Validate() error {
+	if l.Rate <= 0 || math.IsInf(l.Rate, 0) || math.IsNaN(l.Rate) {
+		return errors.New("rate limit rate must be a positive number")
+	}
+	if l.Burst < 1 {
+		return errors.New("rate limit burst must be at least 1")
+	}
+	return nil
+}
+
+// interval is the time one request takes to refill
+func (l Limit) interval() time.Duration {
+	return time.Duration(float64(time.Second) / l.Rate)
+}
+
+// Window is the time an empty bucket takes to refill completely
+func (l Limit) Window() time.Duration {
+	return time.Duration(l.Burst) * l.interval()
+}
+
+// Result is the outcome of taking one request from a bucket
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until a request is allowed again, zero when allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps one bucket per key. Backends implement the generic cell rate
+// algorithm, so a bucket is a single timestamp: the theoretical arrival time
+// (TAT) of the next request once the bucket is drained.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Prune forgets the buckets that refilled completely, run it periodically
+	Prune(ctx context.Context) error
+}
+
+// decide applies GCRA to the stored TAT and returns the new TAT, the zero time
+// meaning it is unchanged
+func decide(now, tat time.Time, limit Limit) (time.Time, Result) {
+	interval := limit.interval()
+	window := limit.Window()
+
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+	allowAt := next.Add(-window)
+
+	if now.Before(allowAt) {
+		return time.Time{}, Result{
+			Allowed:    false,
+			Limit:      limit.Burst,
+			Remaining:  0,
+			Reset:      tat.Sub(now),
+			RetryAfter: allowAt.Sub(now),
+		}
+	}
+
+	return next, result(now, next, limit)
+}
+
+// result describes an allowed request that moved the TAT to next
+func result(now, next time.Time, limit Limit) Result {
+	remaining := int(math.Floor(float64(now.Sub(next.Add(-limit.Window()))) / float64(limit.interval())))
+
+	return Result{
+		Allowed:   true,
+		Limit:     limit.Burst,
+		Remaining: max(remaining, 0),
+		Reset:     next.Sub(now),
+	}
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	for _, tc := range []struct {
+		val   string
+		limit Limit
+		ok    bool
+	}{
+		{"0.5:10", Limit{Rate: 0.5, Burst: 10}, true},
+		{"2:1", Limit{Rate: 2, Burst: 1}, true},
+		{"2", Limit{}, false},
+		{"x:10", Limit{}, false},
+		{"2:x", Limit{}, false},
+		{"2:1.5", Limit{}, false},
+		{"0:10", Limit{}, false},
+		{"-1:10", Limit{}, false},
+		{"NaN:10", Limit{}, false},
+		{"Inf:10", Limit{}, false},
+		{"2:0", Limit{}, false},
+	} {
+		limit, err := ParseLimit(tc.val)
+		if tc.ok && (err != nil || limit != tc.limit) {
+			t.Errorf("%q: got %+v and error %v, want %+v", tc.val, limit, err, tc.limit)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("%q: got %+v, want an error", tc.val, limit)
+		}
+	}
+}
+
+func TestLimitWindow(t *testing.T) {
+	limit := Limit{Rate: 4, Burst: 10}
+	if got := limit.interval(); got != 250*time.Millisecond {
+		t.Errorf("got interval %v, want 250ms", got)
+	}
+	if got := limit.Window(); got != 2500*time.Millisecond {
+		t.Errorf("got window %v, want 2.5s", got)
+	}
+}
+
+// TestDecide drains a bucket of 3 refilled once a second, one decision at a time
+func TestDecide(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 3}
+	t0 := time.Unix(1_700_000_000, 0)
+	var tat time.Time
+
+	for _, tc := range []struct {
+		name string
+		now  time.Duration
+		want Result
+	}{
+		{"empty bucket", 0, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{"second request", 0, Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+		{"burst exhausted", 0, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{"over the burst", 0, Result{Allowed: false, Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+		{"half refilled", 500 * time.Millisecond, Result{Allowed: false, Limit: 3, Remaining: 0, Reset: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		{"one refilled", time.Second, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{"two refilled", 3 * time.Second, Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+		{"full again", 10 * time.Second, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+	} {
+		next, got := decide(t0.Add(tc.now), tat, limit)
+		if got != tc.want {
+			t.Fatalf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+
+		if !got.Allowed {
+			if !next.IsZero() {
+				t.Fatalf("%s: a refused request moved the TAT to %v", tc.name, next)
+			}
+			continue
+		}
+		tat = next
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	limit := Limit{Rate: 2, Burst: 2}
+
+	take := func(key string) Result {
+		t.Helper()
+		result, err := s.Take(ctx, key, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	for i := 0; i < 2; i++ {
+		if result := take("alice"); !result.Allowed {
+			t.Fatalf("request %d was refused within the burst", i)
+		}
+	}
+	result := take("alice")
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("got %+v, want a refusal with RetryAfter 500ms", result)
+	}
+
+	if result := take("bob"); !result.Allowed || result.Remaining != 1 {
+		t.Errorf("another key got %+v, want a full bucket", result)
+	}
+
+	now = now.Add(result.RetryAfter)
+	if result := take("alice"); !result.Allowed {
+		t.Errorf("got %+v after RetryAfter, want the request allowed", result)
+	}
+
+	// Buckets are forgotten once they have refilled completely
+	now = now.Add(time.Second - time.Nanosecond)
+	s.Prune(ctx)
+	if _, ok := s.buckets["alice"]; !ok {
+		t.Error("a bucket still refilling was pruned")
+	}
+	now = now.Add(2 * time.Nanosecond)
+	s.Prune(ctx)
+	if len(s.buckets) != 0 {
+		t.Errorf("got buckets %v after they refilled, want none", s.buckets)
+	}
+}
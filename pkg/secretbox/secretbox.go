@@ -0,0 +1,73 @@
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+var (
+	ErrInvalidKey        = errors.New("key must be 32 hex encoded bytes")
+	ErrMalformedCipher   = errors.New("malformed ciphertext")
+	ErrDecryptionFailure = errors.New("unable to decrypt value")
+)
+
+// Box encrypts small secrets at rest with AES-256-GCM. The nonce is prepended to
+// the ciphertext.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func New(key []byte) (*Box, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Box{aead: aead}, nil
+}
+
+func NewFromHex(hexKey string) (*Box, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	return New(key)
+}
+
+func (b *Box) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (b *Box) Open(ciphertext []byte) ([]byte, error) {
+	nonceSize := b.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, ErrMalformedCipher
+	}
+
+	plaintext, err := b.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], nil)
+	if err != nil {
+		return nil, ErrDecryptionFailure
+	}
+
+	return plaintext, nil
+}
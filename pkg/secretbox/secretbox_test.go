@@ -0,0 +1,114 @@
+package secretbox_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"greenlight/pkg/secretbox"
+)
+
+const hexKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func newBox(t *testing.T, key string) *secretbox.Box {
+	t.Helper()
+
+	box, err := secretbox.NewFromHex(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func TestRoundTrip(t *testing.T) {
+	box := newBox(t, hexKey)
+	plaintext := []byte("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ")
+
+	first, err := box.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := box.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(first, plaintext) {
+		t.Error("the ciphertext contains the plaintext")
+	}
+	if bytes.Equal(first, second) {
+		t.Error("sealing twice gave the same ciphertext, the nonce was reused")
+	}
+
+	for _, ciphertext := range [][]byte{first, second} {
+		got, err := box.Open(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("got %q, want %q", got, plaintext)
+		}
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	box := newBox(t, hexKey)
+
+	ciphertext, err := box.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flip := func(i int) []byte {
+		tampered := bytes.Clone(ciphertext)
+		tampered[i] ^= 0x01
+		return tampered
+	}
+
+	otherKey := newBox(t, strings.Repeat("ff", 32))
+	otherCiphertext, err := otherKey.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		ciphertext []byte
+		err        error
+	}{
+		{"nonce tampered", flip(0), secretbox.ErrDecryptionFailure},
+		{"ciphertext tampered", flip(12), secretbox.ErrDecryptionFailure},
+		{"tag tampered", flip(len(ciphertext) - 1), secretbox.ErrDecryptionFailure},
+		{"tag cut", ciphertext[:len(ciphertext)-1], secretbox.ErrDecryptionFailure},
+		{"shorter than a nonce", ciphertext[:11], secretbox.ErrMalformedCipher},
+		{"empty", nil, secretbox.ErrMalformedCipher},
+		{"other key", otherCiphertext, secretbox.ErrDecryptionFailure},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := box.Open(tc.ciphertext)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("got error %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	for _, key := range []string{"", "not hex", hexKey[:62], hexKey + "00", strings.Repeat("0", 32)} {
+		_, err := secretbox.NewFromHex(key)
+		if !errors.Is(err, secretbox.ErrInvalidKey) {
+			t.Errorf("key %q: got error %v, want %v", key, err, secretbox.ErrInvalidKey)
+		}
+	}
+
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = secretbox.New(key[:16])
+	if !errors.Is(err, secretbox.ErrInvalidKey) {
+		t.Errorf("got error %v for an AES-128 key, want %v", err, secretbox.ErrInvalidKey)
+	}
+}
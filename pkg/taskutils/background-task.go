@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 
 	"greenlight/pkg/jsonlog"
 )
@@ -15,6 +16,23 @@ var Logger *jsonlog.Logger
 // logFunc LogFunc
 var wg = sync.WaitGroup{}
 
+var started, running, panicked atomic.Int64
+
+// Stats counts the tasks run through BackgroundTask and Background
+type Stats struct {
+	Started  int64
+	Running  int64
+	Panicked int64
+}
+
+func GetStats() Stats {
+	return Stats{
+		Started:  started.Load(),
+		Running:  running.Load(),
+		Panicked: panicked.Load(),
+	}
+}
+
 func init() {
 	// logFunc = func(v any) { log.Default().Print(v) }
 }
@@ -35,9 +53,13 @@ func SetLogger(f LogFunc) {
 // a graceful exit, you should use a goroutine.
 func BackgroundTask(task func()) {
 	wg.Add(1)
+	started.Add(1)
+	running.Add(1)
 	defer func() {
 		defer wg.Done()
+		defer running.Add(-1)
 		if err := recover(); err != nil {
+			panicked.Add(1)
 			if Logger != nil {
 				Logger.PrintError(fmt.Errorf("%s", err), nil)
 			} else {
@@ -50,9 +72,13 @@ func BackgroundTask(task func()) {
 }
 
 func Background(fn func()) {
+	started.Add(1)
+	running.Add(1)
 	go func() {
 		defer func() {
+			running.Add(-1)
 			if err := recover(); err != nil {
+				panicked.Add(1)
 				if Logger != nil {
 					Logger.PrintError(fmt.Errorf("%s", err), nil)
 				} else {
@@ -0,0 +1,136 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight/pkg/totp"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 appendix B test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// TestCodeRFC6238 checks the appendix B vectors. The RFC lists 8 digit codes,
+// their last 6 digits are the 6 digit codes.
+func TestCodeRFC6238(t *testing.T) {
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		step := totp.Step(time.Unix(tc.unix, 0))
+		got, err := totp.Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := tc.code[2:]; got != want {
+			t.Errorf("T=%d: got %s, want %s", tc.unix, got, want)
+		}
+	}
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+	got, err := totp.Code(strings.ToLower(rfcSecret), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "287082" {
+		t.Errorf("got %s, want 287082", got)
+	}
+
+	_, err = totp.Code("not base32!", 1)
+	if err == nil {
+		t.Error("an invalid secret was accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totp.Step(now)
+
+	code := func(step int64) string {
+		c, err := totp.Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	for _, tc := range []struct {
+		name string
+		code string
+		step int64
+		ok   bool
+	}{
+		{"current step", code(current), current, true},
+		{"previous step", code(current - 1), current - 1, true},
+		{"next step", code(current + 1), current + 1, true},
+		{"two steps old", code(current - 2), 0, false},
+		{"two steps ahead", code(current + 2), 0, false},
+		{"too short", code(current)[:5], 0, false},
+		{"too long", code(current) + "0", 0, false},
+		{"empty", "", 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := totp.Validate(rfcSecret, tc.code, now)
+			if ok != tc.ok || step != tc.step {
+				t.Errorf("got step %d and %t, want %d and %t", step, ok, tc.step, tc.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != totp.SecretLen {
+		t.Errorf("got a %d byte secret, want %d", len(key), totp.SecretLen)
+	}
+
+	other, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == secret {
+		t.Error("two secrets are equal")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := totp.ProvisioningURI("Greenlight", "alice@example.com", rfcSecret)
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Greenlight:alice@example.com" {
+		t.Errorf("got %s, want an otpauth://totp/Greenlight:alice@example.com URI", uri)
+	}
+
+	want := url.Values{
+		"secret":    {rfcSecret},
+		"issuer":    {"Greenlight"},
+		"algorithm": {"SHA1"},
+		"digits":    {"6"},
+		"period":    {"30"},
+	}
+	if got := u.Query(); got.Encode() != want.Encode() {
+		t.Errorf("got parameters %s, want %s", got.Encode(), want.Encode())
+	}
+}
@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if len(body) == 0 {
+			t.Error("the collector got an empty export")
+		}
+		requests <- r
+	}))
+	defer collector.Close()
+
+	shutdown, err := Setup(Config{
+		Exporter:    ExporterOTLP,
+		Endpoint:    collector.URL + "/v1/traces",
+		ServiceName: "greenlight",
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := Start(context.Background(), "test")
+	span.End()
+
+	err = shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-requests:
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("got path %q, want %q", r.URL.Path, "/v1/traces")
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/x-protobuf" {
+			t.Errorf("got Content-Type %q, want %q", got, "application/x-protobuf")
+		}
+	default:
+		t.Fatal("no spans were exported")
+	}
+}
+
+func TestOTLPExporterEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:4318", "ftp://localhost/v1/traces", "http:///v1/traces"} {
+		_, err := newOTLPExporter(endpoint)
+		if err == nil {
+			t.Errorf("endpoint %q was accepted", endpoint)
+		}
+	}
+}